@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grandcat/zeroconf"
+)
+
+// mdnsService is the DNS-SD service type servers advertise
+const mdnsService = "_opendeck._tcp"
+
+// discoverTimeout is how long to listen for server announcements
+const discoverTimeout = 3 * time.Second
+
+// DiscoveredServer is a server found on the local network
+type DiscoveredServer struct {
+	Name     string
+	Hostname string
+	Port     string
+	HTTPS    bool
+}
+
+// discoveredServer reads a server's address and TXT records
+func discoveredServer(entry *zeroconf.ServiceEntry) DiscoveredServer {
+	server := DiscoveredServer{
+		Name:     entry.Instance,
+		Hostname: strings.TrimSuffix(entry.HostName, "."),
+		Port:     strconv.Itoa(entry.Port),
+		HTTPS:    true,
+	}
+	// Addresses work even where .local names do not resolve. IPv6 ones are
+	// often link-local and cannot be dialed without their interface, so
+	// the name is kept for them if there is one.
+	if len(entry.AddrIPv4) > 0 {
+		server.Hostname = entry.AddrIPv4[0].String()
+	} else if len(entry.AddrIPv6) > 0 && server.Hostname == "" {
+		server.Hostname = entry.AddrIPv6[0].String()
+	}
+	for _, record := range entry.Text {
+		key, value, _ := strings.Cut(record, "=")
+		switch key {
+		case "name":
+			server.Name = value
+		case "scheme":
+			server.HTTPS = value != "http"
+		}
+	}
+	return server
+}
+
+// discoverServers browses the local network for servers
+func discoverServers() ([]DiscoveredServer, error) {
+	resolver, err := zeroconf.NewResolver(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), discoverTimeout)
+	defer cancel()
+	entries := make(chan *zeroconf.ServiceEntry)
+	if err := resolver.Browse(ctx, mdnsService, "local.", entries); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var servers []DiscoveredServer
+	for {
+		select {
+		case entry := <-entries:
+			if entry == nil {
+				continue
+			}
+			server := discoveredServer(entry)
+			addr := net.JoinHostPort(server.Hostname, server.Port)
+			if !seen[addr] {
+				seen[addr] = true
+				servers = append(servers, server)
+			}
+		case <-ctx.Done():
+			sort.Slice(servers, func(i, j int) bool { return servers[i].Name < servers[j].Name })
+			return servers, nil
+		}
+	}
+}
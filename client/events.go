@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Event types pushed by the server
+const (
+	EventScriptAdded   = "script.added"
+	EventScriptRemoved = "script.removed"
+	EventScriptUpdated = "script.updated"
+	EventButtonState   = "button.state"
+	EventRunStarted    = "run.started"
+	EventRunFinished   = "run.finished"
+	// EventProfileSwitched has no task, only the profile switched to
+	EventProfileSwitched = "profile.switched"
+)
+
+// ButtonRunning is the button state of tasks with a run in progress
+const ButtonRunning = "running"
+
+// TriggerClient is the trigger of runs requested by clients
+const TriggerClient = "client"
+
+// reconnectDelay is how long to wait before reconnecting to the event stream
+const reconnectDelay = 5 * time.Second
+
+// Event is a change pushed by the server
+type Event struct {
+	Type     string     `json:"type"`
+	ScriptID int        `json:"scriptId"`
+	Script   *Script    `json:"script"`
+	State    string     `json:"state"`
+	Run      *RunResult `json:"run"`
+	Profile  string     `json:"profile"`
+}
+
+// eventsURL returns the WebSocket URL of a server's event stream
+func eventsURL(hostname, port string) string {
+	scheme := "ws://"
+	if useHTTPS() {
+		scheme = "wss://"
+	}
+	return scheme + net.JoinHostPort(hostname, port) + "/api/v1/events"
+}
+
+// dialEvents connects to a server's event stream
+func dialEvents(hostname, port string) (*websocket.Conn, error) {
+	dialer := websocket.Dialer{
+		TLSClientConfig:  tlsConfig(hostname, port),
+		HandshakeTimeout: 10 * time.Second,
+	}
+	header := http.Header{}
+	if token := preferences.String(tokenKey(hostname, port)); token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+
+	conn, response, err := dialer.Dial(eventsURL(hostname, port), header)
+	if response != nil && response.StatusCode == http.StatusUnauthorized {
+		return nil, errUnauthorized
+	}
+	return conn, err
+}
+
+// listenEvents calls handle for every event the server sends until stop is
+// closed. Events sent while disconnected are lost, so after reconnecting
+// reconnected is called instead and listening ends.
+func listenEvents(hostname, port string, stop chan struct{}, handle func(Event), reconnected func()) {
+	dropped := false
+	for !stopped(stop) {
+		conn, err := dialEvents(hostname, port)
+		if err == errUnauthorized {
+			return
+		}
+		if err == nil && dropped {
+			conn.Close()
+			reconnected()
+			return
+		}
+		if err == nil {
+			go func() {
+				<-stop
+				conn.Close()
+			}()
+			for {
+				var e Event
+				if err = conn.ReadJSON(&e); err != nil {
+					break
+				}
+				handle(e)
+			}
+			conn.Close()
+		}
+
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		fmt.Println("Lost event stream:", err)
+		dropped = true
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
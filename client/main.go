@@ -1,17 +1,17 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
+	"net"
 	"os"
-	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/container"
-	"fyne.io/fyne/v2/data/binding"
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
@@ -29,11 +29,18 @@ type CustomTask struct {
 	ID    int    `json:"id"`
 }
 
+// allTasks is the profile selection that shows every task
+const allTasks = "All tasks"
+
 var (
 	tabs        *container.AppTabs
 	window      fyne.Window
 	fyne_app    fyne.App
 	preferences fyne.Preferences
+	// stop_events ends the event stream of the current tasks tab, it is
+	// replaced by every build of the tab
+	stop_events chan struct{}
+	events_mu   sync.Mutex
 )
 
 func main() {
@@ -52,20 +59,51 @@ func main() {
 
 func initializePreferences() {
 	preferences = fyne_app.Preferences()
-	if hostname := preferences.String("hostname"); len(hostname) == 0 {
-		fyne_app.Preferences().SetString("hostname", "localhost")
-	}
-	if port := preferences.String("port"); len(port) == 0 {
-		fyne_app.Preferences().SetString("port", "9212")
-	}
+	migrateServers()
 	window.SetFullScreen(preferences.Bool("fullscreen"))
 
+	// the tasks tab is only rebuilt when the current server or the list of
+	// servers changed. Preferences such as tokens and pinned fingerprints
+	// are written while the tab is built, and listeners run in goroutines
+	// of their own.
+	var mu sync.Mutex
+	shown, names := currentServer(), serverNames()
 	fyne_app.Preferences().AddChangeListener(func() {
-		buildScriptsTab()
+		mu.Lock()
+		server, server_names := currentServer(), serverNames()
+		changed := server != shown || !slices.Equal(server_names, names)
+		shown, names = server, server_names
+		mu.Unlock()
+
+		if changed {
+			buildScriptsTab()
+		}
 		window.SetFullScreen(preferences.Bool("fullscreen"))
 	})
 }
 
+// replaceEvents stops the event stream of the previous tasks tab and
+// returns the stop channel of the one being built
+func replaceEvents() chan struct{} {
+	events_mu.Lock()
+	defer events_mu.Unlock()
+	if stop_events != nil {
+		close(stop_events)
+	}
+	stop_events = make(chan struct{})
+	return stop_events
+}
+
+// stopped reports whether stop was closed because the tab was built again
+func stopped(stop chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
 func buildGui() {
 	tabs = container.NewAppTabs()
 	scripts_tab := container.NewTabItem("Tasks", container.NewVBox())
@@ -82,19 +120,21 @@ func buildGui() {
 }
 
 func buildScriptsTab() {
-	hostname := preferences.String("hostname")
-	port := preferences.String("port")
-	url := "http://" + hostname + ":" + port
+	server := currentServer()
+	hostname, port := server.Hostname, server.Port
+	url := serverURL(hostname, port)
 
-	scripts, err := getScripts(hostname, port)
-	if err != nil {
-		fmt.Println(err)
-		setFallbackContainer(0, "Failed to load tasks. Try again?")
-		return
-	}
+	stop := replaceEvents()
 
-	// create bottom widget bar
+	// create bottom widget bar, the server can be switched even if it
+	// cannot be reached
 	connection_lbl := widget.NewLabel("Connected to: " + url)
+	server_sel := widget.NewSelect(serverNames(), nil)
+	server_sel.SetSelected(server.Name)
+	server_sel.OnChanged = selectServer
+	// lists the profiles once the tasks are loaded
+	profile_sel := widget.NewSelect(nil, nil)
+	profile_sel.Hide()
 	refresh_btn := widget.NewButtonWithIcon("", theme.ViewRefreshIcon(), func() {
 		buildScriptsTab()
 	})
@@ -103,6 +143,8 @@ func buildScriptsTab() {
 		layout.NewCustomPaddedLayout(4, 4, 4, 4),
 		container.NewHBox(
 			close_btn,
+			server_sel,
+			profile_sel,
 			layout.NewSpacer(),
 			connection_lbl,
 			layout.NewSpacer(),
@@ -110,67 +152,320 @@ func buildScriptsTab() {
 		),
 	)
 
-	// create task list
-	var containers []fyne.CanvasObject
-	for _, s := range scripts {
-		title := strings.TrimSuffix(s, filepath.Ext(s))
-		button := widget.NewButton(title, func() {
+	scripts, err := getScripts(hostname, port)
+	// a newer build of the tab replaced this one while loading
+	if stopped(stop) {
+		return
+	}
+	if err != nil {
+		var fingerprintErr *FingerprintError
+		switch {
+		case errors.Is(err, errUnauthorized):
+			setPairingContainer(0, hostname, port)
+		case errors.As(err, &fingerprintErr):
+			setFingerprintContainer(0, hostname, port, fingerprintErr)
+		default:
+			fmt.Println(err)
+			setFallbackContainer(0, "Failed to load tasks from "+server.Name+". Try again?")
+		}
+		tabs.Items[0].Content = container.NewBorder(btn_box, nil, nil, nil, tabs.Items[0].Content)
+		return
+	}
+	// servers without profiles show every task
+	profiles, err := getProfile(hostname, port)
+	if err != nil {
+		fmt.Println("Failed to load profile:", err)
+	}
+	if stopped(stop) {
+		return
+	}
+
+	// create task list, buttons are kept by task ID so events can update
+	// them. mu guards the task list against events arriving while the
+	// profile is switched.
+	var mu sync.Mutex
+	buttons := map[int]*widget.Button{}
+	cells := map[int]fyne.CanvasObject{}
+	tags := map[int][]string{}
+	profile := profiles.Active
+	grid := container.NewGridWrap(fyne.NewSize(256, 192))
+
+	// showProfile shows the tasks of the active profile and lists the
+	// profiles that can be switched to
+	showProfile := func() {
+		var names []string
+		for id, cell := range cells {
+			if profile == "" || slices.Contains(tags[id], profile) {
+				cell.Show()
+			} else {
+				cell.Hide()
+			}
+			for _, tag := range tags[id] {
+				if !slices.Contains(names, tag) {
+					names = append(names, tag)
+				}
+			}
+		}
+		if profile != "" && !slices.Contains(names, profile) {
+			names = append(names, profile)
+		}
+		slices.Sort(names)
+		grid.Refresh()
+
+		selected := profile
+		if selected == "" {
+			selected = allTasks
+		}
+		// setting the selection would switch the profile again
+		onChanged := profile_sel.OnChanged
+		profile_sel.OnChanged = nil
+		profile_sel.Options = append([]string{allTasks}, names...)
+		profile_sel.SetSelected(selected)
+		profile_sel.OnChanged = onChanged
+		if len(names) == 0 {
+			profile_sel.Hide()
+		} else {
+			profile_sel.Show()
+		}
+	}
+	profile_sel.OnChanged = func(selected string) {
+		if selected == allTasks {
+			selected = ""
+		}
+		// the server pushes the switch to every client, this one included
+		go func() {
+			if err := switchProfile(hostname, port, selected); err != nil {
+				connection_lbl.SetText(err.Error())
+				mu.Lock()
+				showProfile()
+				mu.Unlock()
+			}
+		}()
+	}
+
+	addTask := func(s Script) {
+		button := widget.NewButton(s.Title, nil)
+		button.OnTapped = func() {
 			go func() {
-				resp, err := http.Get(url + "/scripts/" + s)
+				title := button.Text
+				result, err := runScript(hostname, port, s.ID)
 				if err != nil {
 					connection_lbl.SetText(err.Error())
 					return
 				}
 
-				response, err := io.ReadAll(resp.Body)
-				if err != nil {
-					connection_lbl.SetText(err.Error())
+				if result.ExitCode != 0 {
+					connection_lbl.SetText(title + " failed: " + strings.TrimSpace(result.Error+" "+result.Stderr))
 					return
 				}
 
-				connection_lbl.SetText(title + ": " + string(response))
+				connection_lbl.SetText(title + ": " + result.Stdout)
 			}()
-		})
+		}
 		layout := layout.NewCustomPaddedLayout(12, 12, 12, 12)
-		containers = append(containers, container.New(layout, button))
+		cell := container.New(layout, button)
+		buttons[s.ID] = button
+		cells[s.ID] = cell
+		tags[s.ID] = s.Metadata.Tags
+		grid.Add(cell)
+	}
+	for _, s := range scripts {
+		addTask(s)
 	}
+	showProfile()
 
-	grid := container.NewGridWrap(fyne.NewSize(256, 192), containers...)
 	scroll := container.NewVScroll(grid)
 
 	tabs.Items[0].Content = container.NewBorder(btn_box, nil, nil, nil, scroll)
+
+	// apply changes pushed by the server without rebuilding the grid
+	handleEvent := func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		button, ok := buttons[e.ScriptID]
+		switch e.Type {
+		case EventScriptAdded:
+			if !ok && e.Script != nil {
+				addTask(*e.Script)
+				showProfile()
+			}
+		case EventScriptUpdated:
+			if ok && e.Script != nil {
+				button.SetText(e.Script.Title)
+				tags[e.ScriptID] = e.Script.Metadata.Tags
+				showProfile()
+			}
+		case EventScriptRemoved:
+			if ok {
+				grid.Remove(cells[e.ScriptID])
+				delete(buttons, e.ScriptID)
+				delete(cells, e.ScriptID)
+				delete(tags, e.ScriptID)
+				showProfile()
+			}
+		case EventButtonState:
+			if ok {
+				button.Importance = widget.MediumImportance
+				if e.State == ButtonRunning {
+					button.Importance = widget.HighImportance
+				}
+				button.Refresh()
+			}
+		case EventRunFinished:
+			// runs started here already show their result
+			if e.Run != nil && e.Run.Trigger != TriggerClient {
+				connection_lbl.SetText(e.Run.Script + " ran (" + e.Run.Trigger + ")")
+			}
+		case EventProfileSwitched:
+			profile = e.Profile
+			showProfile()
+		}
+	}
+
+	go listenEvents(hostname, port, stop, handleEvent, buildScriptsTab)
 }
 
 func buildSettingsTab() {
-	host := preferences.String("hostname")
-	port := preferences.String("port")
-	full := preferences.Bool("fullscreen")
+	full_chk := widget.NewCheck("Fullscreen", nil)
+	full_chk.SetChecked(preferences.Bool("fullscreen"))
+	full_chk.OnChanged = func(checked bool) {
+		preferences.SetBool("fullscreen", checked)
+	}
 
-	host_bnd := binding.BindString(&host)
-	port_bnd := binding.BindString(&port)
-	full_bnd := binding.BindBool(&full)
+	// the form edits the server selected in the list, or a new one
+	servers := getServers()
+	editing := ""
+	status_lbl := widget.NewLabel("")
+	name_ent := widget.NewEntry()
+	host_ent := widget.NewEntry()
+	port_ent := widget.NewEntry()
+	https_chk := widget.NewCheck("", nil)
+	fill := func(server SavedServer) {
+		name_ent.SetText(server.Name)
+		host_ent.SetText(server.Hostname)
+		port_ent.SetText(server.Port)
+		https_chk.SetChecked(server.HTTPS)
+	}
 
-	host_ent := widget.NewEntryWithData(host_bnd)
-	host_ent.Validator = nil
-	port_ent := widget.NewEntryWithData(port_bnd)
-	port_ent.Validator = nil
-	full_chk := widget.NewCheckWithData("", full_bnd)
+	server_lst := widget.NewList(
+		func() int { return len(servers) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			server := servers[id]
+			text := server.Name + " (" + net.JoinHostPort(server.Hostname, server.Port) + ")"
+			if server.Name == currentServer().Name {
+				text += ", current"
+			}
+			item.(*widget.Label).SetText(text)
+		},
+	)
+	server_lst.OnSelected = func(id widget.ListItemID) {
+		editing = servers[id].Name
+		fill(servers[id])
+		status_lbl.SetText("")
+	}
+	reload := func(selected string) {
+		servers = getServers()
+		server_lst.Refresh()
+		if i := slices.IndexFunc(servers, func(s SavedServer) bool { return s.Name == selected }); i >= 0 {
+			server_lst.Select(i)
+		}
+	}
+
+	new_btn := widget.NewButtonWithIcon("New", theme.ContentAddIcon(), func() {
+		server_lst.UnselectAll()
+		editing = ""
+		fill(SavedServer{Port: "9212", HTTPS: true})
+		status_lbl.SetText("Enter the new server and save")
+	})
+	delete_btn := widget.NewButtonWithIcon("Delete", theme.DeleteIcon(), func() {
+		if editing == "" {
+			return
+		}
+		if err := deleteServer(editing); err != nil {
+			status_lbl.SetText(err.Error())
+			return
+		}
+		server_lst.UnselectAll()
+		editing = ""
+		fill(SavedServer{})
+		reload("")
+	})
+	connect_btn := widget.NewButtonWithIcon("Connect", theme.ConfirmIcon(), func() {
+		if editing == "" {
+			return
+		}
+		selectServer(editing)
+		server_lst.Refresh()
+		tabs.SelectIndex(0)
+	})
 
 	form := &widget.Form{
 		Items: []*widget.FormItem{
+			{Text: "Name", Widget: name_ent},
 			{Text: "Hostname", Widget: host_ent},
 			{Text: "Port", Widget: port_ent},
-			{Text: "Fullscreen", Widget: full_chk},
+			{Text: "HTTPS", Widget: https_chk},
 		},
 		SubmitText: "Save",
 		OnSubmit: func() {
-			preferences.SetString("hostname", host_ent.Text)
-			preferences.SetString("port", port_ent.Text)
-			preferences.SetBool("fullscreen", full_chk.Checked)
+			server := SavedServer{Name: name_ent.Text, Hostname: host_ent.Text, Port: port_ent.Text, HTTPS: https_chk.Checked}
+			if err := saveServer(editing, server); err != nil {
+				status_lbl.SetText(err.Error())
+				return
+			}
+			reload(strings.TrimSpace(server.Name))
+			status_lbl.SetText("Saved " + strings.TrimSpace(server.Name))
 		},
 	}
 
-	tabs.Items[1].Content = container.NewVBox(container.NewPadded(form))
+	// servers found on the network fill in the form when selected
+	var discovered []DiscoveredServer
+	discover_lbl := widget.NewLabel("")
+	discover_lst := widget.NewList(
+		func() int { return len(discovered) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			server := discovered[id]
+			item.(*widget.Label).SetText(server.Name + " (" + net.JoinHostPort(server.Hostname, server.Port) + ")")
+		},
+	)
+	discover_lst.OnSelected = func(id widget.ListItemID) {
+		server := discovered[id]
+		server_lst.UnselectAll()
+		editing = ""
+		fill(SavedServer{Name: server.Name, Hostname: server.Hostname, Port: server.Port, HTTPS: server.HTTPS})
+		discover_lbl.SetText("Save to add " + server.Name)
+	}
+	var discover_btn *widget.Button
+	discover_btn = widget.NewButtonWithIcon("Discover", theme.SearchIcon(), func() {
+		discover_btn.Disable()
+		discover_lbl.SetText("Searching the network...")
+		go func() {
+			defer discover_btn.Enable()
+			servers, err := discoverServers()
+			if err != nil {
+				discover_lbl.SetText("Discovery failed: " + err.Error())
+				return
+			}
+			discovered = servers
+			discover_lst.UnselectAll()
+			discover_lst.Refresh()
+			if len(servers) == 0 {
+				discover_lbl.SetText("No servers found")
+				return
+			}
+			discover_lbl.SetText("Select a server")
+		}()
+	})
+
+	server_btns := container.NewHBox(new_btn, delete_btn, layout.NewSpacer(), connect_btn)
+	editor := container.NewVBox(server_btns, container.NewPadded(form), status_lbl)
+	discovery := container.NewBorder(container.NewHBox(discover_btn, discover_lbl), nil, nil, nil, discover_lst)
+	lists := container.NewVSplit(server_lst, discovery)
+	tabs.Items[1].Content = container.NewBorder(editor, full_chk, nil, nil, lists)
+
+	reload(currentServer().Name)
 }
 
 func setFallbackContainer(index int, text string) {
@@ -184,3 +479,56 @@ func setFallbackContainer(index int, text string) {
 
 	tabs.Items[index].Content = center
 }
+
+// setPairingContainer asks for the PIN shown in the server's Clients tab
+func setPairingContainer(index int, hostname, port string) {
+	label := widget.NewLabel("Pair with " + net.JoinHostPort(hostname, port) + " using the PIN shown in the server's Clients tab.")
+	label.Wrapping = fyne.TextWrapWord
+	status := widget.NewLabel("")
+	pin_ent := widget.NewEntry()
+	pin_ent.SetPlaceHolder("PIN")
+
+	name, _ := os.Hostname()
+	pair_btn := widget.NewButtonWithIcon("Pair", theme.ConfirmIcon(), func() {
+		if err := pair(hostname, port, strings.TrimSpace(pin_ent.Text), name); err != nil {
+			status.SetText(err.Error())
+			return
+		}
+		buildScriptsTab()
+	})
+	pin_ent.OnSubmitted = func(string) { pair_btn.OnTapped() }
+
+	form := container.NewVBox(label, pin_ent, pair_btn, status)
+	tabs.Items[index].Content = container.NewPadded(container.NewCenter(container.NewGridWrap(fyne.NewSize(360, 200), form)))
+}
+
+// setFingerprintContainer warns that a server presented a different
+// certificate than the pinned one. This is what an intercepted connection
+// looks like, so the new certificate is only trusted on request.
+func setFingerprintContainer(index int, hostname, port string, fingerprintErr *FingerprintError) {
+	title := widget.NewLabelWithStyle("WARNING: THE SERVER'S CERTIFICATE HAS CHANGED", fyne.TextAlignCenter, fyne.TextStyle{Bold: true})
+	message := widget.NewLabel("Someone may be intercepting the connection to " + fingerprintErr.Server +
+		". Only trust the new certificate if you replaced it on the server, and compare the fingerprint with the one in the server's settings.")
+	message.Wrapping = fyne.TextWrapWord
+
+	fingerprints := widget.NewLabel("Pinned: " + fingerprintErr.Pinned + "\nServer: " + fingerprintErr.Got)
+	fingerprints.TextStyle = fyne.TextStyle{Monospace: true}
+	fingerprints.Wrapping = fyne.TextWrapBreak
+
+	trust_btn := widget.NewButtonWithIcon("Trust New Certificate", theme.WarningIcon(), func() {
+		preferences.SetString(fingerprintKey(hostname, port), fingerprintErr.Got)
+		buildScriptsTab()
+	})
+	trust_btn.Importance = widget.DangerImportance
+	retry_btn := widget.NewButtonWithIcon("Retry", theme.ViewRefreshIcon(), func() {
+		buildScriptsTab()
+	})
+
+	vbox := container.NewVBox(
+		widget.NewIcon(theme.WarningIcon()),
+		title,
+		message,
+		fingerprints,
+		container.NewHBox(layout.NewSpacer(), retry_btn, trust_btn, layout.NewSpacer()))
+	tabs.Items[index].Content = container.NewPadded(vbox)
+}
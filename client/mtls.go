@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"regexp"
+)
+
+var storageNamePattern = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// certStorageName is the app storage file holding the client certificate
+// and key issued by a server
+func certStorageName(hostname, port string) string {
+	return "client-" + storageNamePattern.ReplaceAllString(hostname+"-"+port, "_") + ".pem"
+}
+
+// newCSR creates a key and a certificate request for pairing. The server
+// decides the certificate's subject, so the request only carries the key.
+func newCSR(name string) (string, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", nil, err
+	}
+	template := &x509.CertificateRequest{Subject: pkix.Name{CommonName: name}}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return "", nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", nil, err
+	}
+	csrPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return string(csrPEM), keyPEM, nil
+}
+
+// saveClientCertificate stores the certificate issued by a server together
+// with its key
+func saveClientCertificate(hostname, port string, certPEM string, keyPEM []byte) error {
+	name := certStorageName(hostname, port)
+	storage := fyne_app.Storage()
+	storage.Remove(name)
+
+	writer, err := storage.Create(name)
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+	if _, err := writer.Write(append([]byte(certPEM), keyPEM...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// loadClientCertificate returns the certificate issued by a server
+func loadClientCertificate(hostname, port string) (*tls.Certificate, error) {
+	reader, err := fyne_app.Storage().Open(certStorageName(hostname, port))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
@@ -1,26 +1,211 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"strconv"
 )
 
-func getScripts(hostname, port string) ([]string, error) {
-	response, err := http.Get("http://" + hostname + ":" + port + "/scripts")
+// errUnauthorized is returned when the server does not accept this client,
+// it has to be paired first
+var errUnauthorized = errors.New("client is not paired with the server")
+
+// Script is a task as returned by the server's v1 API
+type Script struct {
+	ID       int            `json:"id"`
+	Slug     string         `json:"slug"`
+	Title    string         `json:"title"`
+	Type     string         `json:"type"`
+	Metadata ScriptMetadata `json:"metadata"`
+}
+
+// ScriptMetadata is the part of a task's metadata the client uses
+type ScriptMetadata struct {
+	// Tags name the profiles the task is shown in
+	Tags []string `json:"tags"`
+}
+
+// Profiles is the active profile of a server, empty if every task is
+// shown, and the profiles that can be switched to
+type Profiles struct {
+	Active   string   `json:"active"`
+	Profiles []string `json:"profiles"`
+}
+
+// RunResult is the outcome of running a task on the server
+type RunResult struct {
+	Script   string `json:"script"`
+	Trigger  string `json:"trigger"`
+	ExitCode int    `json:"exitCode"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	Error    string `json:"error"`
+}
+
+// serverURL returns the base URL of a server
+func serverURL(hostname, port string) string {
+	scheme := "http://"
+	if useHTTPS() {
+		scheme = "https://"
+	}
+	return scheme + net.JoinHostPort(hostname, port)
+}
+
+func apiURL(hostname, port string) string {
+	return serverURL(hostname, port) + "/api/v1"
+}
+
+// tokenKey is the preference the pairing token for a server is stored in
+func tokenKey(hostname, port string) string {
+	return "token:" + hostname + ":" + port
+}
+
+// doRequest sends a request to the server with this client's token
+func doRequest(method, hostname, port, path string, body []byte) (*http.Response, error) {
+	request, err := http.NewRequest(method, apiURL(hostname, port)+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if token := preferences.String(tokenKey(hostname, port)); token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	response, err := newHTTPClient(hostname, port).Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode == http.StatusUnauthorized {
+		response.Body.Close()
+		return nil, errUnauthorized
+	}
+	return response, nil
+}
+
+// pair exchanges the PIN shown by the server for a token and stores it.
+// Over HTTPS a certificate request is sent along, servers in mTLS mode
+// answer with a client certificate instead of a token.
+func pair(hostname, port, pin, name string) error {
+	request := map[string]string{"pin": pin, "name": name}
+	var keyPEM []byte
+	if useHTTPS() {
+		csr, key, err := newCSR(name)
+		if err != nil {
+			return err
+		}
+		request["csr"], keyPEM = csr, key
+	}
+
+	body, _ := json.Marshal(request)
+	response, err := doRequest(http.MethodPost, hostname, port, "/pair", body)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusCreated {
+		return fmt.Errorf("pairing failed: %s", data)
+	}
+
+	var paired struct {
+		Token       string `json:"token"`
+		Certificate string `json:"certificate"`
+	}
+	if err := json.Unmarshal(data, &paired); err != nil {
+		return err
+	}
+	if paired.Certificate != "" {
+		if err := saveClientCertificate(hostname, port, paired.Certificate, keyPEM); err != nil {
+			return fmt.Errorf("failed to store client certificate: %w", err)
+		}
+	}
+	preferences.SetString(tokenKey(hostname, port), paired.Token)
+	return nil
+}
+
+func getScripts(hostname, port string) ([]Script, error) {
+	response, err := doRequest(http.MethodGet, hostname, port, "/scripts", nil)
 	if err != nil {
-		setFallbackContainer(0, "Failed to load tasks. Try again?")
-		return []string{}, err
+		return []Script{}, err
 	}
 	defer response.Body.Close()
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
-		return []string{}, err
+		return []Script{}, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return []Script{}, fmt.Errorf("server returned %s", response.Status)
 	}
 
-	var scripts []string
+	var scripts []Script
 	if err := json.Unmarshal(body, &scripts); err != nil {
-		return []string{}, err
+		return []Script{}, err
 	}
 	return scripts, nil
 }
+
+func getProfile(hostname, port string) (Profiles, error) {
+	response, err := doRequest(http.MethodGet, hostname, port, "/profile", nil)
+	if err != nil {
+		return Profiles{}, err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return Profiles{}, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return Profiles{}, fmt.Errorf("server returned %s", response.Status)
+	}
+
+	var profiles Profiles
+	if err := json.Unmarshal(body, &profiles); err != nil {
+		return Profiles{}, err
+	}
+	return profiles, nil
+}
+
+// switchProfile switches every client of the server to the profile name,
+// or to every task if name is empty
+func switchProfile(hostname, port, name string) error {
+	body, _ := json.Marshal(Profiles{Active: name})
+	response, err := doRequest(http.MethodPut, hostname, port, "/profile", body)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(response.Body)
+		return fmt.Errorf("server returned %s: %s", response.Status, data)
+	}
+	return nil
+}
+
+func runScript(hostname, port string, id int) (RunResult, error) {
+	response, err := doRequest(http.MethodPost, hostname, port, "/scripts/"+strconv.Itoa(id)+"/run", nil)
+	if err != nil {
+		return RunResult{}, err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return RunResult{}, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return RunResult{}, fmt.Errorf("server returned %s: %s", response.Status, body)
+	}
+
+	var result RunResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return RunResult{}, err
+	}
+	return result, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// serversKey is the preference holding the saved servers as JSON
+	serversKey = "servers"
+	// currentServerKey is the preference holding the name of the server
+	// last connected to
+	currentServerKey = "current_server"
+)
+
+// SavedServer is a named server connection. Tokens, pinned fingerprints
+// and client certificates are stored per hostname and port, so they are
+// kept when switching between servers.
+type SavedServer struct {
+	Name     string `json:"name"`
+	Hostname string `json:"hostname"`
+	Port     string `json:"port"`
+	HTTPS    bool   `json:"https"`
+}
+
+// getServers returns the saved servers in the order they were added
+func getServers() []SavedServer {
+	var servers []SavedServer
+	if err := json.Unmarshal([]byte(preferences.String(serversKey)), &servers); err != nil {
+		fmt.Println("Failed to read saved servers:", err)
+	}
+	return servers
+}
+
+// setServers saves the list of servers
+func setServers(servers []SavedServer) {
+	data, _ := json.Marshal(servers)
+	preferences.SetString(serversKey, string(data))
+}
+
+// migrateServers saves the single server of earlier versions, or
+// localhost, if no servers are saved yet
+func migrateServers() {
+	if preferences.String(serversKey) != "" {
+		return
+	}
+	server := SavedServer{
+		Hostname: preferences.StringWithFallback("hostname", "localhost"),
+		Port:     preferences.StringWithFallback("port", "9212"),
+		HTTPS:    preferences.BoolWithFallback("https", true),
+	}
+	server.Name = server.Hostname
+	setServers([]SavedServer{server})
+	preferences.SetString(currentServerKey, server.Name)
+}
+
+// currentServer returns the server last connected to, or the first one if
+// it was deleted
+func currentServer() SavedServer {
+	servers := getServers()
+	name := preferences.String(currentServerKey)
+	if i := slices.IndexFunc(servers, func(s SavedServer) bool { return s.Name == name }); i >= 0 {
+		return servers[i]
+	}
+	if len(servers) > 0 {
+		return servers[0]
+	}
+	return SavedServer{Name: "localhost", Hostname: "localhost", Port: "9212", HTTPS: true}
+}
+
+// serverNames returns the names of the saved servers
+func serverNames() []string {
+	var names []string
+	for _, s := range getServers() {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+// selectServer connects to a saved server, the tasks tab reloads on the
+// preference change
+func selectServer(name string) {
+	if name != preferences.String(currentServerKey) {
+		preferences.SetString(currentServerKey, name)
+	}
+}
+
+// validateServer checks a server before it is saved in place of the one
+// named original, which is empty for new servers
+func validateServer(server SavedServer, original string) error {
+	var errs []error
+	if server.Name == "" {
+		errs = append(errs, errors.New("name is required"))
+	}
+	if server.Name != original && slices.Contains(serverNames(), server.Name) {
+		errs = append(errs, fmt.Errorf("a server named %q already exists", server.Name))
+	}
+	if server.Hostname == "" || strings.ContainsAny(server.Hostname, "/ ") {
+		errs = append(errs, fmt.Errorf("invalid hostname %q", server.Hostname))
+	}
+	if port, err := strconv.Atoi(server.Port); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("invalid port %q", server.Port))
+	}
+	return errors.Join(errs...)
+}
+
+// saveServer replaces the server named original, or adds server if
+// original is empty. A renamed current server stays the current one.
+func saveServer(original string, server SavedServer) error {
+	server.Name = strings.TrimSpace(server.Name)
+	// addresses such as [::1] are bracketed when URLs are built
+	server.Hostname = strings.Trim(strings.TrimSpace(server.Hostname), "[]")
+	server.Port = strings.TrimSpace(server.Port)
+	if err := validateServer(server, original); err != nil {
+		return err
+	}
+
+	servers := getServers()
+	i := slices.IndexFunc(servers, func(s SavedServer) bool { return s.Name == original })
+	if original == "" || i < 0 {
+		servers = append(servers, server)
+	} else {
+		servers[i] = server
+	}
+	wasCurrent := original != "" && currentServer().Name == original
+	setServers(servers)
+	if wasCurrent {
+		selectServer(server.Name)
+	}
+	return nil
+}
+
+// deleteServer removes a saved server. The last server cannot be deleted.
+func deleteServer(name string) error {
+	servers := getServers()
+	if len(servers) <= 1 {
+		return errors.New("at least one server is needed")
+	}
+	setServers(slices.DeleteFunc(servers, func(s SavedServer) bool { return s.Name == name }))
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// FingerprintError is returned when a server presents a different
+// certificate than the one pinned on first connect
+type FingerprintError struct {
+	Server string
+	Pinned string
+	Got    string
+}
+
+func (e *FingerprintError) Error() string {
+	return "the certificate of " + e.Server + " has changed"
+}
+
+// fingerprintKey is the preference the pinned fingerprint for a server is
+// stored in
+func fingerprintKey(hostname, port string) string {
+	return "fingerprint:" + hostname + ":" + port
+}
+
+// formatFingerprint returns the SHA-256 fingerprint of a DER encoded
+// certificate as colon separated hex, the same format the server shows
+func formatFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+func useHTTPS() bool {
+	return currentServer().HTTPS
+}
+
+// tlsConfig returns the TLS configuration for connections to a server.
+// Servers usually have a self-signed certificate, so instead of verifying
+// it against a CA the certificate seen on first connect is pinned and must
+// not change.
+func tlsConfig(hostname, port string) *tls.Config {
+	verify := func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return errors.New("server did not present a certificate")
+		}
+		got := formatFingerprint(state.PeerCertificates[0].Raw)
+
+		key := fingerprintKey(hostname, port)
+		pinned := preferences.String(key)
+		if pinned == "" {
+			preferences.SetString(key, got)
+			return nil
+		}
+		if pinned != got {
+			return &FingerprintError{Server: net.JoinHostPort(hostname, port), Pinned: pinned, Got: got}
+		}
+		return nil
+	}
+
+	return &tls.Config{
+		// The certificate is checked by VerifyConnection instead
+		InsecureSkipVerify: true,
+		VerifyConnection:   verify,
+		// Present the certificate issued on pairing, if any
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if cert, err := loadClientCertificate(hostname, port); err == nil {
+				return cert, nil
+			}
+			return &tls.Certificate{}, nil
+		},
+	}
+}
+
+// newHTTPClient returns a client for a server
+func newHTTPClient(hostname, port string) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tlsConfig(hostname, port)},
+	}
+}
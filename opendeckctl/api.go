@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// apiPath is the prefix of the versioned API
+const apiPath = "/api/v1"
+
+// Task is a task as listed by the server
+type Task struct {
+	ID    int    `json:"id"`
+	Slug  string `json:"slug"`
+	Title string `json:"title"`
+	Type  string `json:"type"`
+}
+
+// Document is the full, editable representation of a task. Steps are kept
+// as they are so that fields this tool does not know survive an edit.
+type Document struct {
+	ID        int               `json:"id"`
+	Type      string            `json:"type"`
+	Title     string            `json:"title,omitempty"`
+	File      string            `json:"file,omitempty"`
+	Source    string            `json:"source,omitempty"`
+	Schedules []string          `json:"schedules,omitempty"`
+	Steps     []json.RawMessage `json:"steps,omitempty"`
+	Action    string            `json:"action,omitempty"`
+	Params    map[string]string `json:"params,omitempty"`
+	Tags      []string          `json:"tags,omitempty"`
+}
+
+// RunResult is the outcome of a run
+type RunResult struct {
+	ScriptID int           `json:"scriptId"`
+	Script   string        `json:"script"`
+	Trigger  string        `json:"trigger"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+	ExitCode int           `json:"exitCode"`
+	Stdout   string        `json:"stdout"`
+	Stderr   string        `json:"stderr"`
+	Error    string        `json:"error,omitempty"`
+	Skipped  bool          `json:"skipped,omitempty"`
+}
+
+// RunOutput is a line of a streamed run, either output or the result
+type RunOutput struct {
+	Stream string     `json:"stream,omitempty"`
+	Data   string     `json:"data,omitempty"`
+	Result *RunResult `json:"result,omitempty"`
+}
+
+// APIError is returned when the server rejects a request
+type APIError struct {
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.Status)
+}
+
+// Client talks to the API of a server
+type Client struct {
+	base  string
+	token string
+	http  *http.Client
+}
+
+// Config describes how to reach a server
+type Config struct {
+	// Server is the base URL of the server
+	Server string
+	// Socket is the path of the server's Unix socket. Requests over the
+	// socket need no token.
+	Socket string
+	// Token is the API key or a client token
+	Token string
+	// Fingerprint pins the server's certificate, servers usually have a
+	// self-signed one
+	Fingerprint string
+	// Insecure skips certificate verification
+	Insecure bool
+}
+
+// NewClient creates a client for the server described by cfg
+func NewClient(cfg Config) *Client {
+	transport := &http.Transport{TLSClientConfig: tlsConfig(cfg.Fingerprint, cfg.Insecure)}
+	base := strings.TrimSuffix(cfg.Server, "/")
+	if cfg.Socket != "" {
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", cfg.Socket)
+		}
+		base = "http://opendeck"
+	}
+	return &Client{base: base, token: cfg.Token, http: &http.Client{Transport: transport}}
+}
+
+// formatFingerprint returns the SHA-256 fingerprint of a DER encoded
+// certificate as colon separated hex, the same format the server shows
+func formatFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// tlsConfig verifies servers against the pinned fingerprint if one is
+// given, and the system roots otherwise
+func tlsConfig(fingerprint string, insecure bool) *tls.Config {
+	if fingerprint == "" {
+		return &tls.Config{InsecureSkipVerify: insecure}
+	}
+	want := strings.ToUpper(strings.ReplaceAll(fingerprint, " ", ""))
+	return &tls.Config{
+		// The certificate is checked by VerifyConnection instead
+		InsecureSkipVerify: true,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return errors.New("server did not present a certificate")
+			}
+			if got := formatFingerprint(state.PeerCertificates[0].Raw); got != want {
+				return fmt.Errorf("server certificate %s does not match the pinned fingerprint", got)
+			}
+			return nil
+		},
+	}
+}
+
+// do sends a request to path below the API. body is sent as JSON unless it
+// is a reader. Responses other than 2xx are returned as an APIError.
+func (c *Client) do(method, path string, body any, header http.Header) (*http.Response, error) {
+	var r io.Reader
+	switch b := body.(type) {
+	case nil:
+	case io.Reader:
+		r = b
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.base+apiPath+path, r)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if _, ok := body.(io.Reader); !ok && body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &APIError{Status: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	return resp, nil
+}
+
+// getJSON decodes the response to a GET request into out
+func (c *Client) getJSON(path string, out any) error {
+	resp, err := c.do(http.MethodGet, path, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Tasks lists the tasks the token may access
+func (c *Client) Tasks() ([]Task, error) {
+	var tasks []Task
+	return tasks, c.getJSON("/scripts", &tasks)
+}
+
+// Runs returns the run history, newest first. A task ID of 0 returns the
+// runs of all tasks.
+func (c *Client) Runs(taskID, limit int) ([]RunResult, error) {
+	path := fmt.Sprintf("/runs?limit=%d", limit)
+	if taskID != 0 {
+		path += fmt.Sprintf("&script=%d", taskID)
+	}
+	var runs []RunResult
+	return runs, c.getJSON(path, &runs)
+}
+
+// Document returns the document of a task with its ETag
+func (c *Client) Document(id int) (Document, string, error) {
+	var doc Document
+	resp, err := c.do(http.MethodGet, fmt.Sprintf("/scripts/%d/document", id), nil, nil)
+	if err != nil {
+		return doc, "", err
+	}
+	defer resp.Body.Close()
+	err = json.NewDecoder(resp.Body).Decode(&doc)
+	return doc, resp.Header.Get("ETag"), err
+}
+
+// Create creates a task. The server assigns an ID if the document has none.
+func (c *Client) Create(doc Document) (Document, error) {
+	var created Document
+	resp, err := c.do(http.MethodPost, "/scripts", doc, nil)
+	if err != nil {
+		return created, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return Document{}, err
+	}
+	return created, nil
+}
+
+// Update replaces the document of task id. etag must be the ETag the
+// document was read with, so that concurrent edits are not overwritten.
+func (c *Client) Update(id int, doc Document, etag string) (Document, error) {
+	var updated Document
+	header := http.Header{"If-Match": {etag}}
+	resp, err := c.do(http.MethodPut, fmt.Sprintf("/scripts/%d/document", id), doc, header)
+	if err != nil {
+		return updated, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&updated); err != nil {
+		return Document{}, err
+	}
+	return updated, nil
+}
+
+// Run runs a task, calling output with every chunk of output it writes,
+// and returns its result
+func (c *Client) Run(id int, stdin io.Reader, output func(stream, data string)) (RunResult, error) {
+	if stdin == nil {
+		stdin = strings.NewReader("")
+	}
+	resp, err := c.do(http.MethodPost, fmt.Sprintf("/scripts/%d/run/stream", id), stdin, nil)
+	if err != nil {
+		return RunResult{}, err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var line RunOutput
+		if err := dec.Decode(&line); err != nil {
+			if err == io.EOF {
+				err = errors.New("connection closed before the run finished")
+			}
+			return RunResult{}, err
+		}
+		if line.Result != nil {
+			return *line.Result, nil
+		}
+		output(line.Stream, line.Data)
+	}
+}
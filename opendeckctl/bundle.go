@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// bundleVersion is the version of the bundle format written by export
+const bundleVersion = 1
+
+// Bundle is a set of tasks exported from a server, including the source of
+// scripts, that can be imported into another one
+type Bundle struct {
+	Version  int        `json:"version"`
+	Exported time.Time  `json:"exported"`
+	Tasks    []Document `json:"tasks"`
+}
+
+// ImportResult reports what happened to a task of a bundle
+type ImportResult struct {
+	ID      int
+	Title   string
+	Updated bool
+	Err     error
+}
+
+// exportBundle reads the documents of the given tasks, or of every task
+// if ids is empty
+func exportBundle(c *Client, ids []int) (Bundle, error) {
+	bundle := Bundle{Version: bundleVersion, Exported: time.Now().UTC()}
+	if len(ids) == 0 {
+		tasks, err := c.Tasks()
+		if err != nil {
+			return bundle, err
+		}
+		for _, t := range tasks {
+			ids = append(ids, t.ID)
+		}
+	}
+	for _, id := range ids {
+		doc, _, err := c.Document(id)
+		if err != nil {
+			return bundle, fmt.Errorf("task %d: %w", id, err)
+		}
+		bundle.Tasks = append(bundle.Tasks, doc)
+	}
+	return bundle, nil
+}
+
+// stepScripts returns the IDs of the tasks run by the steps of a macro
+func stepScripts(doc Document) []int {
+	var ids []int
+	for _, raw := range doc.Steps {
+		var step struct {
+			Type   string `json:"type"`
+			Script int    `json:"script"`
+		}
+		if json.Unmarshal(raw, &step) == nil && step.Type == "script" {
+			ids = append(ids, step.Script)
+		}
+	}
+	return ids
+}
+
+// importOrder sorts the tasks of a bundle so that tasks come before the
+// macros that run them. Macros with missing or circular references are
+// left for the server to reject.
+func importOrder(tasks []Document) []Document {
+	var ordered, pending []Document
+	inBundle := map[int]bool{}
+	for _, doc := range tasks {
+		inBundle[doc.ID] = true
+		if doc.Type == "macro" {
+			pending = append(pending, doc)
+		} else {
+			ordered = append(ordered, doc)
+		}
+	}
+
+	done := map[int]bool{}
+	for _, doc := range ordered {
+		done[doc.ID] = true
+	}
+	for len(pending) > 0 {
+		progress := false
+		for i := 0; i < len(pending); i++ {
+			doc := pending[i]
+			ready := !slices.ContainsFunc(stepScripts(doc), func(id int) bool { return inBundle[id] && !done[id] })
+			if ready {
+				ordered = append(ordered, doc)
+				done[doc.ID] = true
+				pending = slices.Delete(pending, i, i+1)
+				i--
+				progress = true
+			}
+		}
+		if !progress {
+			return append(ordered, pending...)
+		}
+	}
+	return ordered
+}
+
+// importBundle creates the tasks of a bundle. Tasks whose ID is taken are
+// reported as conflicts, or replaced if replace is set.
+func importBundle(c *Client, bundle Bundle, replace bool) ([]ImportResult, error) {
+	if bundle.Version != bundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", bundle.Version)
+	}
+
+	var results []ImportResult
+	for _, doc := range importOrder(bundle.Tasks) {
+		result := ImportResult{ID: doc.ID, Title: doc.Title}
+		if result.Title == "" {
+			result.Title = doc.File
+		}
+
+		_, err := c.Create(doc)
+		var apiErr *APIError
+		if replace && errors.As(err, &apiErr) && apiErr.Status == 409 {
+			err = replaceTask(c, doc)
+			result.Updated = err == nil
+		}
+		result.Err = err
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// replaceTask overwrites an existing task with doc
+func replaceTask(c *Client, doc Document) error {
+	current, etag, err := c.Document(doc.ID)
+	if err != nil {
+		return err
+	}
+	if current.File != doc.File {
+		return fmt.Errorf("task %d is %q on the server, not %q", doc.ID, current.File, doc.File)
+	}
+	_, err = c.Update(doc.ID, doc, etag)
+	return err
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// macro returns a macro document running the given tasks
+func macro(id int, scripts ...int) Document {
+	doc := Document{ID: id, Type: "macro", Title: "macro"}
+	for _, s := range scripts {
+		step, _ := json.Marshal(map[string]any{"type": "script", "script": s})
+		doc.Steps = append(doc.Steps, step)
+	}
+	return doc
+}
+
+func TestImportOrder(t *testing.T) {
+	tasks := []Document{
+		macro(1, 2, 4),
+		macro(2, 3),
+		{ID: 3, Type: "script", File: "a.ts"},
+		// Task 5 is not in the bundle, it may exist on the server
+		macro(4, 5),
+		macro(6, 7),
+		macro(7, 6),
+	}
+
+	var got []int
+	for _, doc := range importOrder(tasks) {
+		got = append(got, doc.ID)
+	}
+	want := []int{3, 2, 4, 1, 6, 7}
+	if len(got) != len(want) {
+		t.Fatalf("Expected order %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Expected order %v, got %v", want, got)
+		}
+	}
+}
+
+func TestImportBundle(t *testing.T) {
+	existing := map[int]Document{1: {ID: 1, Type: "script", File: "lights.ts", Source: "old"}}
+	var updates []Document
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer key" {
+			http.Error(w, "invalid API key", http.StatusUnauthorized)
+			return
+		}
+		var doc Document
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v1/scripts":
+			json.NewDecoder(r.Body).Decode(&doc)
+			if _, ok := existing[doc.ID]; ok {
+				http.Error(w, "script already exists", http.StatusConflict)
+				return
+			}
+			existing[doc.ID] = doc
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(doc)
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v1/scripts/1/document":
+			w.Header().Set("ETag", `"v1"`)
+			json.NewEncoder(w).Encode(existing[1])
+		case r.Method == http.MethodPut && r.URL.Path == "/api/v1/scripts/1/document":
+			if r.Header.Get("If-Match") != `"v1"` {
+				http.Error(w, "document changed", http.StatusPreconditionFailed)
+				return
+			}
+			json.NewDecoder(r.Body).Decode(&doc)
+			updates = append(updates, doc)
+			json.NewEncoder(w).Encode(doc)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(Config{Server: srv.URL, Token: "key"})
+	bundle := Bundle{Version: bundleVersion, Tasks: []Document{
+		{ID: 1, Type: "script", File: "lights.ts", Source: "new"},
+		{ID: 2, Type: "script", File: "fan.ts"},
+	}}
+
+	results, err := importBundle(c, bundle, false)
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if results[0].Err == nil || !strings.Contains(results[0].Err.Error(), "already exists") {
+		t.Errorf("Expected conflict for existing task, got %v", results[0].Err)
+	}
+	if results[1].Err != nil || existing[2].File != "fan.ts" {
+		t.Errorf("Expected new task to be created, got %v", results[1].Err)
+	}
+
+	delete(existing, 2)
+	results, err = importBundle(c, bundle, true)
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if !results[0].Updated || len(updates) != 1 || updates[0].Source != "new" {
+		t.Errorf("Expected existing task to be replaced, got %+v and updates %+v", results[0], updates)
+	}
+
+	bundle.Version = 2
+	if _, err := importBundle(c, bundle, false); err == nil {
+		t.Error("Expected unsupported bundle version to fail")
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// newFlags creates the flag set of a command
+func newFlags(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: opendeckctl %s %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// resolveTask returns the ID of a task given by ID or slug
+func resolveTask(c *Client, arg string) (int, error) {
+	if id, err := strconv.Atoi(arg); err == nil {
+		return id, nil
+	}
+	tasks, err := c.Tasks()
+	if err != nil {
+		return 0, err
+	}
+	for _, t := range tasks {
+		if t.Slug == arg {
+			return t.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("no task %q", arg)
+}
+
+// readInput reads a file, or standard input if path is "-"
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// readDocument reads a task from a file. JSON files hold a document, any
+// other file is the source of a script named after the file.
+func readDocument(path string) (Document, error) {
+	data, err := readInput(path)
+	if err != nil {
+		return Document{}, err
+	}
+	if filepath.Ext(path) != ".json" {
+		return Document{Type: "script", File: filepath.Base(path), Source: string(data)}, nil
+	}
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return doc, fmt.Errorf("invalid document %s: %w", path, err)
+	}
+	return doc, nil
+}
+
+// printJSON writes v to standard output as indented JSON
+func printJSON(v any) error {
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "\t")
+	return enc.Encode(v)
+}
+
+func cmdList(c *Client, args []string) (int, error) {
+	if err := newFlags("list", "").Parse(args); err != nil {
+		return 2, err
+	}
+	tasks, err := c.Tasks()
+	if err != nil {
+		return 1, err
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSLUG\tTYPE\tTITLE")
+	for _, t := range tasks {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", t.ID, t.Slug, t.Type, t.Title)
+	}
+	return 0, w.Flush()
+}
+
+func cmdRun(c *Client, args []string) (int, error) {
+	fs := newFlags("run", "[-stdin] <task>")
+	stdin := fs.Bool("stdin", false, "pass standard input to the task")
+	if err := fs.Parse(args); err != nil {
+		return 2, err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2, nil
+	}
+	id, err := resolveTask(c, fs.Arg(0))
+	if err != nil {
+		return 1, err
+	}
+
+	var input io.Reader
+	if *stdin {
+		input = os.Stdin
+	}
+	streamed := false
+	result, err := c.Run(id, input, func(stream, data string) {
+		streamed = true
+		if stream == "stderr" {
+			fmt.Fprint(stderr, data)
+		} else {
+			fmt.Fprint(stdout, data)
+		}
+	})
+	if err != nil {
+		return 1, err
+	}
+	// Output of macro steps and actions is only part of the result
+	if !streamed {
+		printOutput(stdout, result.Stdout)
+		printOutput(stderr, result.Stderr)
+	}
+	if result.ExitCode < 0 || result.Skipped {
+		return 1, fmt.Errorf("%s failed: %s", result.Script, result.Error)
+	}
+	return result.ExitCode, nil
+}
+
+// printOutput writes output of a run that was not streamed, ending it with
+// a newline as the server trims it
+func printOutput(w io.Writer, output string) {
+	if output != "" {
+		fmt.Fprintln(w, output)
+	}
+}
+
+func cmdHistory(c *Client, args []string) (int, error) {
+	fs := newFlags("history", "[-n N] [task]")
+	limit := fs.Int("n", 20, "number of runs to show")
+	if err := fs.Parse(args); err != nil {
+		return 2, err
+	}
+	id := 0
+	if fs.NArg() > 0 {
+		var err error
+		if id, err = resolveTask(c, fs.Arg(0)); err != nil {
+			return 1, err
+		}
+	}
+	runs, err := c.Runs(id, *limit)
+	if err != nil {
+		return 1, err
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "STARTED\tTASK\tTRIGGER\tEXIT\tDURATION")
+	for _, r := range runs {
+		exit := strconv.Itoa(r.ExitCode)
+		if r.Skipped {
+			exit = "skipped"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Started.Local().Format(time.DateTime), r.Script, r.Trigger, exit, r.Duration.Round(time.Millisecond))
+	}
+	return 0, w.Flush()
+}
+
+func cmdGet(c *Client, args []string) (int, error) {
+	fs := newFlags("get", "<task>")
+	if err := fs.Parse(args); err != nil {
+		return 2, err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2, nil
+	}
+	id, err := resolveTask(c, fs.Arg(0))
+	if err != nil {
+		return 1, err
+	}
+	doc, _, err := c.Document(id)
+	if err != nil {
+		return 1, err
+	}
+	return 0, printJSON(doc)
+}
+
+func cmdCreate(c *Client, args []string) (int, error) {
+	fs := newFlags("create", "[-id N] [-title T] [-tags a,b] <file>")
+	id := fs.Int("id", 0, "ID of the task, the next free one if 0")
+	title := fs.String("title", "", "title of the task")
+	tags := fs.String("tags", "", "comma separated tags")
+	if err := fs.Parse(args); err != nil {
+		return 2, err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2, nil
+	}
+
+	doc, err := readDocument(fs.Arg(0))
+	if err != nil {
+		return 1, err
+	}
+	if *id != 0 {
+		doc.ID = *id
+	}
+	if *title != "" {
+		doc.Title = *title
+	}
+	if *tags != "" {
+		doc.Tags = strings.Split(*tags, ",")
+	}
+
+	created, err := c.Create(doc)
+	if err != nil {
+		return 1, err
+	}
+	fmt.Println("Created task", created.ID)
+	return 0, nil
+}
+
+func cmdEdit(c *Client, args []string) (int, error) {
+	fs := newFlags("edit", "<task> <file>")
+	if err := fs.Parse(args); err != nil {
+		return 2, err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2, nil
+	}
+	id, err := resolveTask(c, fs.Arg(0))
+	if err != nil {
+		return 1, err
+	}
+	current, etag, err := c.Document(id)
+	if err != nil {
+		return 1, err
+	}
+
+	doc, err := readDocument(fs.Arg(1))
+	if err != nil {
+		return 1, err
+	}
+	if doc.Type == "script" && filepath.Ext(fs.Arg(1)) != ".json" {
+		// A source file only replaces the source, it may be named
+		// differently than the script on the server
+		current.Source = doc.Source
+		doc = current
+	}
+
+	updated, err := c.Update(id, doc, etag)
+	if err != nil {
+		return 1, err
+	}
+	fmt.Println("Updated task", updated.ID)
+	return 0, nil
+}
+
+func cmdExport(c *Client, args []string) (int, error) {
+	fs := newFlags("export", "[-o file] [task...]")
+	output := fs.String("o", "-", "file to write the bundle to")
+	if err := fs.Parse(args); err != nil {
+		return 2, err
+	}
+	var ids []int
+	for _, arg := range fs.Args() {
+		id, err := resolveTask(c, arg)
+		if err != nil {
+			return 1, err
+		}
+		ids = append(ids, id)
+	}
+
+	bundle, err := exportBundle(c, ids)
+	if err != nil {
+		return 1, err
+	}
+	if *output == "-" {
+		return 0, printJSON(bundle)
+	}
+	data, err := json.MarshalIndent(bundle, "", "\t")
+	if err != nil {
+		return 1, err
+	}
+	if err := os.WriteFile(*output, data, 0644); err != nil {
+		return 1, err
+	}
+	fmt.Printf("Exported %d tasks to %s\n", len(bundle.Tasks), *output)
+	return 0, nil
+}
+
+func cmdImport(c *Client, args []string) (int, error) {
+	fs := newFlags("import", "[-replace] <file>")
+	replace := fs.Bool("replace", false, "replace tasks that already exist")
+	if err := fs.Parse(args); err != nil {
+		return 2, err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2, nil
+	}
+
+	data, err := readInput(fs.Arg(0))
+	if err != nil {
+		return 1, err
+	}
+	var bundle Bundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return 1, fmt.Errorf("invalid bundle: %w", err)
+	}
+
+	results, err := importBundle(c, bundle, *replace)
+	if err != nil {
+		return 1, err
+	}
+	code := 0
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			fmt.Printf("Failed %d (%s): %v\n", r.ID, r.Title, r.Err)
+			code = 1
+		case r.Updated:
+			fmt.Printf("Replaced %d (%s)\n", r.ID, r.Title)
+		default:
+			fmt.Printf("Created %d (%s)\n", r.ID, r.Title)
+		}
+	}
+	return code, nil
+}
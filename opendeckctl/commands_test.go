@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCmdRun(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enc := json.NewEncoder(w)
+		switch r.URL.Path {
+		case "/api/v1/scripts/1/run/stream":
+			// Scripts stream their output and repeat it in the result
+			enc.Encode(RunOutput{Stream: "stdout", Data: "hello\n"})
+			enc.Encode(RunOutput{Stream: "stderr", Data: "careful\n"})
+			enc.Encode(RunOutput{Result: &RunResult{Script: "greet", Stdout: "hello", Stderr: "careful"}})
+		case "/api/v1/scripts/2/run/stream":
+			// Actions and macros only return their output in the result
+			enc.Encode(RunOutput{Result: &RunResult{Script: "open", Stdout: "opened https://example.com", Stderr: "slow", ExitCode: 3}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	originalStdout, originalStderr := stdout, stderr
+	defer func() { stdout, stderr = originalStdout, originalStderr }()
+
+	testCases := []struct {
+		name       string
+		task       string
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{"streamed", "1", 0, "hello\n", "careful\n"},
+		{"not streamed", "2", 3, "opened https://example.com\n", "slow\n"},
+	}
+
+	c := NewClient(Config{Server: srv.URL})
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out, errOut bytes.Buffer
+			stdout, stderr = &out, &errOut
+			code, err := cmdRun(c, []string{tc.task})
+			if err != nil || code != tc.wantCode {
+				t.Fatalf("Expected exit code %d, got %d (%v)", tc.wantCode, code, err)
+			}
+			if out.String() != tc.wantStdout || errOut.String() != tc.wantStderr {
+				t.Errorf("Expected output %q and %q, got %q and %q", tc.wantStdout, tc.wantStderr, out.String(), errOut.String())
+			}
+		})
+	}
+}
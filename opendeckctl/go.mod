@@ -0,0 +1,3 @@
+module opendeckctl
+
+go 1.23.2
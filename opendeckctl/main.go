@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `opendeckctl controls an OpenDeck server through its API.
+
+Usage:
+  opendeckctl [flags] <command> [arguments]
+
+Commands:
+  list                      list tasks
+  run [-stdin] <task>       run a task and stream its output
+  history [-n N] [task]     show recent runs
+  get <task>                print the document of a task as JSON
+  create [flags] <file>     create a task from a script or JSON document
+  edit <task> <file>        replace a task's source or document
+  export [-o file] [task...]  export tasks as a bundle
+  import [-replace] <file>  import a bundle
+
+Tasks are given by ID or slug. Flags:
+`
+
+// stdout and stderr are where commands write their output, replaced in
+// tests
+var (
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
+)
+
+// command is a subcommand. It returns the exit code of the tool.
+type command func(c *Client, args []string) (int, error)
+
+var commands = map[string]command{
+	"list":    cmdList,
+	"run":     cmdRun,
+	"history": cmdHistory,
+	"get":     cmdGet,
+	"create":  cmdCreate,
+	"edit":    cmdEdit,
+	"export":  cmdExport,
+	"import":  cmdImport,
+}
+
+// env returns the environment variable key, or fallback if it is empty
+func env(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func main() {
+	var cfg Config
+	flag.StringVar(&cfg.Server, "server", env("OPENDECK_SERVER", "https://localhost:9212"), "server URL (OPENDECK_SERVER)")
+	flag.StringVar(&cfg.Socket, "socket", os.Getenv("OPENDECK_SOCKET"), "connect to the server's Unix socket instead (OPENDECK_SOCKET)")
+	flag.StringVar(&cfg.Token, "token", os.Getenv("OPENDECK_TOKEN"), "API key or client token (OPENDECK_TOKEN)")
+	flag.StringVar(&cfg.Fingerprint, "fingerprint", os.Getenv("OPENDECK_FINGERPRINT"), "SHA-256 fingerprint of the server certificate (OPENDECK_FINGERPRINT)")
+	flag.BoolVar(&cfg.Insecure, "insecure", false, "do not verify the server certificate")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	code, err := cmd(NewClient(cfg), flag.Args()[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "Error:", err)
+		if code == 0 {
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// parseTags reads a comma separated list of tags. Tags are lower case and
+// each appears once.
+func parseTags(text string) []string {
+	var tags []string
+	for _, tag := range strings.Split(text, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// CanAccess reports whether the client may see and run a task. Clients
+// that are not restricted can access every task.
+func (c Client) CanAccess(s Script) bool {
+	if !c.Restricted {
+		return true
+	}
+	if slices.Contains(c.Scripts, s.ID) {
+		return true
+	}
+	return slices.ContainsFunc(s.Tags, func(tag string) bool {
+		return slices.Contains(c.Tags, tag)
+	})
+}
+
+// requestClient returns the paired client that made a request. Requests
+// made with the API key have no client.
+func requestClient(c *fiber.Ctx) (Client, bool) {
+	client, ok := c.Locals("client").(Client)
+	return client, ok
+}
+
+// canAccess reports whether the sender of a request may access a task
+func canAccess(c *fiber.Ctx, s Script) bool {
+	client, ok := requestClient(c)
+	return !ok || client.CanAccess(s)
+}
+
+// accessibleScripts filters scripts down to those the sender of a request
+// may access
+func accessibleScripts(c *fiber.Ctx, scripts []Script) []Script {
+	return slices.DeleteFunc(scripts, func(s Script) bool { return !canAccess(c, s) })
+}
+
+// setClientPermissions changes which tasks a client may access
+func setClientPermissions(id string, restricted bool, scripts []int, tags []string) error {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	clients := readClients()
+	idx := slices.IndexFunc(clients, func(c Client) bool { return c.ID == id })
+	if idx < 0 {
+		return fmt.Errorf("client %q does not exist", id)
+	}
+	clients[idx].Restricted = restricted
+	clients[idx].Scripts = scripts
+	clients[idx].Tags = tags
+	return writeClients(clients)
+}
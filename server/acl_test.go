@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestParseTags(t *testing.T) {
+	tags := parseTags(" Media, lab,,media , ")
+	if !slices.Equal(tags, []string{"media", "lab"}) {
+		t.Errorf("Unexpected tags %q", tags)
+	}
+}
+
+func TestClientCanAccess(t *testing.T) {
+	scripts := []Script{
+		{ID: 1, File: "play.js", Tags: []string{"media"}},
+		{ID: 2, File: "shutdown.js", Tags: []string{"admin"}},
+		{ID: 3, File: "lights.js"},
+	}
+
+	testCases := []struct {
+		name   string
+		client Client
+		want   []bool
+	}{
+		{"unrestricted", Client{}, []bool{true, true, true}},
+		{"restricted without permissions", Client{Restricted: true}, []bool{false, false, false}},
+		{"by tag", Client{Restricted: true, Tags: []string{"media"}}, []bool{true, false, false}},
+		{"by script", Client{Restricted: true, Scripts: []int{3}}, []bool{false, false, true}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for i, s := range scripts {
+				if got := tc.client.CanAccess(s); got != tc.want[i] {
+					t.Errorf("CanAccess(%s) = %v, want %v", s.File, got, tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRestrictedClient(t *testing.T) {
+	// Setup test directory
+	tmpDir := t.TempDir()
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+	originalDataPath := getDataPath
+	getDataPath = func() string { return tmpDir }
+	defer func() { getDataPath = originalDataPath }()
+
+	// Run scripts with sh so the test does not depend on bun
+	originalRuntime := scriptRuntime
+	scriptRuntime = []string{"sh"}
+	defer func() { scriptRuntime = originalRuntime }()
+
+	files := map[string]string{"play.js": "echo playing", "shutdown.js": "echo shutting down"}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	scripts := []Script{
+		{ID: 1, File: "play.js", Tags: []string{"media"}},
+		{ID: 2, File: "shutdown.js"},
+	}
+	scriptsData, _ := json.MarshalIndent(scripts, "", "\t")
+	if err := os.WriteFile(filepath.Join(tmpDir, "scripts.json"), scriptsData, 0644); err != nil {
+		t.Fatalf("Failed to create scripts.json: %v", err)
+	}
+
+	client, token := newClient("tablet")
+	if err := addClient(client); err != nil {
+		t.Fatalf("Failed to add client: %v", err)
+	}
+	if err := setClientPermissions(client.ID, true, nil, []string{"media"}); err != nil {
+		t.Fatalf("Failed to set permissions: %v", err)
+	}
+
+	app := fiber.New()
+	registerAPIRoutes(app)
+	app.Get("/scripts", requireAuth, fiberGetScripts)
+	app.Get("/scripts/:id", requireAuth, executeScript)
+
+	request := func(method, path string) (int, []byte) {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		body := make([]byte, 4096)
+		n, _ := resp.Body.Read(body)
+		return resp.StatusCode, body[:n]
+	}
+
+	_, body := request("GET", "/api/v1/scripts")
+	var list []APIScript
+	json.Unmarshal(body, &list)
+	if len(list) != 1 || list[0].ID != 1 {
+		t.Errorf("Expected only script 1 to be listed, got %+v", list)
+	}
+
+	_, body = request("GET", "/scripts")
+	var names []string
+	json.Unmarshal(body, &names)
+	if !slices.Equal(names, []string{"play"}) {
+		t.Errorf("Expected only play in legacy list, got %q", names)
+	}
+
+	testCases := []struct {
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{"POST", "/api/v1/scripts/1/run", 200},
+		{"POST", "/api/v1/scripts/2/run", 404},
+		{"GET", "/api/v1/scripts/2", 404},
+		{"GET", "/scripts/play", 200},
+		{"GET", "/scripts/shutdown", 404},
+	}
+	for _, tc := range testCases {
+		if status, _ := request(tc.method, tc.path); status != tc.wantStatus {
+			t.Errorf("%s %s: expected status %d, got %d", tc.method, tc.path, tc.wantStatus, status)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// TypeAction marks tasks that run a native action instead of a script
+const TypeAction = "action"
+
+// ActionParam describes a configurable parameter of a native action
+type ActionParam struct {
+	Name        string
+	Label       string
+	Placeholder string
+	Required    bool
+	Multiline   bool
+	// Options restricts the parameter to a fixed set of values
+	Options []string
+}
+
+// Action is a task implemented in Go that needs no script. String
+// parameters are rendered as templates before Run is called.
+type Action struct {
+	Name   string
+	Title  string
+	Params []ActionParam
+	// Validate checks parameters beyond the required ones, it may be nil
+	Validate func(params map[string]string) error
+	Run      func(params map[string]string) (string, error)
+}
+
+var (
+	actions     = map[string]Action{}
+	actionNames []string
+)
+
+func registerAction(action Action) {
+	actions[action.Name] = action
+	actionNames = append(actionNames, action.Name)
+}
+
+func init() {
+	registerAction(Action{
+		Name:  "open",
+		Title: "Open URL or File",
+		Params: []ActionParam{
+			{Name: "target", Label: "URL or Path", Placeholder: "https://example.com", Required: true},
+		},
+		Run: actionOpen,
+	})
+	registerAction(Action{
+		Name:  "shell",
+		Title: "Run Shell Command",
+		Params: []ActionParam{
+			{Name: "command", Label: "Command", Placeholder: "echo hello", Required: true, Multiline: true},
+		},
+		Run: actionShell,
+	})
+	registerAction(Action{
+		Name:  "http",
+		Title: "HTTP Request",
+		Params: []ActionParam{
+			{Name: "method", Label: "Method", Options: []string{"GET", "POST", "PUT", "PATCH", "DELETE"}},
+			{Name: "url", Label: "URL", Placeholder: "https://example.com/hook", Required: true},
+			{Name: "headers", Label: "Headers", Placeholder: "Content-Type: application/json", Multiline: true},
+			{Name: "body", Label: "Body", Placeholder: `{"text": "{{.Vars.status}}"}`, Multiline: true},
+		},
+		Run: actionHTTP,
+	})
+	registerAction(Action{
+		Name:  "wol",
+		Title: "Wake-on-LAN",
+		Params: []ActionParam{
+			{Name: "mac", Label: "MAC Address", Placeholder: "01:23:45:67:89:ab", Required: true},
+			{Name: "broadcast", Label: "Broadcast", Placeholder: "255.255.255.255:9"},
+		},
+		Validate: func(params map[string]string) error {
+			_, err := net.ParseMAC(params["mac"])
+			return err
+		},
+		Run: actionWakeOnLAN,
+	})
+	registerAction(Action{
+		Name:  "write-file",
+		Title: "Write to File",
+		Params: []ActionParam{
+			{Name: "path", Label: "Path", Placeholder: "~/status.txt", Required: true},
+			{Name: "content", Label: "Content", Multiline: true},
+			{Name: "mode", Label: "Mode", Options: []string{"overwrite", "append"}},
+		},
+		Run: actionWriteFile,
+	})
+	registerAction(Action{
+		Name:  "set-variable",
+		Title: "Set Variable",
+		Params: []ActionParam{
+			{Name: "name", Label: "Variable", Placeholder: "status", Required: true},
+			{Name: "value", Label: "Value", Placeholder: "{{.Output}}"},
+		},
+		Run: actionSetVariable,
+	})
+}
+
+// validateAction checks that the action of a task exists and that its
+// parameters are complete
+func validateAction(name string, params map[string]string) error {
+	action, ok := actions[name]
+	if !ok {
+		return fmt.Errorf("unknown action %q", name)
+	}
+
+	for _, p := range action.Params {
+		if p.Required && strings.TrimSpace(params[p.Name]) == "" {
+			return fmt.Errorf("%s is required", strings.ToLower(p.Label))
+		}
+	}
+	if action.Validate != nil {
+		return action.Validate(params)
+	}
+	return nil
+}
+
+// runActionParams renders the parameters of an action and runs it
+func runActionParams(name string, params map[string]string, data TemplateData) (string, error) {
+	action, ok := actions[name]
+	if !ok {
+		return "", fmt.Errorf("unknown action %q", name)
+	}
+
+	rendered := make(map[string]string, len(params))
+	for k, v := range params {
+		value, err := renderTemplate(v, data)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", k, err)
+		}
+		rendered[k] = value
+	}
+
+	return action.Run(rendered)
+}
+
+// runAction runs the native action of a task and fills in result
+func runAction(script Script, result *RunResult) error {
+	start := time.Now()
+	output, err := runActionParams(script.Action, script.Params, TemplateData{Vars: getVariables()})
+	result.Duration = time.Since(start)
+	result.Stdout = strings.TrimSpace(output)
+
+	if err != nil {
+		result.Error = err.Error()
+		result.ExitCode = 1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			result.ExitCode = exitErr.ExitCode()
+		}
+	}
+	return err
+}
+
+// openCommand returns the command that opens a URL or file with the
+// desktop's default application
+func openCommand(target string) *exec.Cmd {
+	switch runtime.GOOS {
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", target)
+	case "darwin":
+		return exec.Command("open", target)
+	default:
+		return exec.Command("xdg-open", target)
+	}
+}
+
+func actionOpen(params map[string]string) (string, error) {
+	cmd := openCommand(params["target"])
+	release, err := processes.acquire(context.Background())
+	if err != nil {
+		return "", err
+	}
+	if err := cmd.Start(); err != nil {
+		release()
+		return "", err
+	}
+	go func() {
+		cmd.Wait()
+		release()
+	}()
+	return "opened " + params["target"], nil
+}
+
+// shellCommand returns the command that runs command in the system shell
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
+
+func actionShell(params map[string]string) (string, error) {
+	var out bytes.Buffer
+	cmd := shellCommand(params["command"])
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	release, err := processes.acquire(context.Background())
+	if err != nil {
+		return "", err
+	}
+	err = cmd.Run()
+	release()
+	return out.String(), err
+}
+
+// parseHeaders reads "Key: Value" lines
+func parseHeaders(text string) map[string]string {
+	headers := map[string]string{}
+	for _, line := range strings.Split(text, "\n") {
+		if k, v, ok := strings.Cut(line, ":"); ok && strings.TrimSpace(k) != "" {
+			headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return headers
+}
+
+func actionHTTP(params map[string]string) (string, error) {
+	status, body, err := doHTTPRequest(params["method"], params["url"], params["body"], parseHeaders(params["headers"]))
+	if err != nil {
+		return "", err
+	}
+	if status < 200 || status > 299 {
+		return body, fmt.Errorf("request returned status %d", status)
+	}
+	return body, nil
+}
+
+// magicPacket builds a Wake-on-LAN packet: six 0xFF bytes followed by the
+// MAC address repeated 16 times
+func magicPacket(mac net.HardwareAddr) []byte {
+	packet := bytes.Repeat([]byte{0xFF}, 6)
+	for range 16 {
+		packet = append(packet, mac...)
+	}
+	return packet
+}
+
+func actionWakeOnLAN(params map[string]string) (string, error) {
+	mac, err := net.ParseMAC(params["mac"])
+	if err != nil {
+		return "", err
+	}
+
+	broadcast := params["broadcast"]
+	if broadcast == "" {
+		broadcast = "255.255.255.255:9"
+	}
+
+	conn, err := net.Dial("udp", broadcast)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write(magicPacket(mac)); err != nil {
+		return "", err
+	}
+	return "sent magic packet to " + mac.String(), nil
+}
+
+// expandHome replaces a leading ~ with the home directory
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		return filepath.Join(os.Getenv("HOME"), path[1:])
+	}
+	return path
+}
+
+func actionWriteFile(params map[string]string) (string, error) {
+	path := expandHome(params["path"])
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if params["mode"] == "append" {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(params["content"]); err != nil {
+		return "", err
+	}
+	return "wrote " + path, nil
+}
+
+func actionSetVariable(params map[string]string) (string, error) {
+	if err := setVariable(params["name"], params["value"]); err != nil {
+		return "", err
+	}
+	return params["value"], nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestValidateAction(t *testing.T) {
+	testCases := []struct {
+		name    string
+		action  string
+		params  map[string]string
+		wantErr bool
+	}{
+		{"shell", "shell", map[string]string{"command": "echo hi"}, false},
+		{"missing command", "shell", map[string]string{}, true},
+		{"wol", "wol", map[string]string{"mac": "01:23:45:67:89:ab"}, false},
+		{"wol bad mac", "wol", map[string]string{"mac": "nope"}, true},
+		{"unknown action", "launch-rocket", nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateAction(tc.action, tc.params)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("validateAction() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestMagicPacket(t *testing.T) {
+	mac, _ := net.ParseMAC("01:23:45:67:89:ab")
+	packet := magicPacket(mac)
+
+	if len(packet) != 102 {
+		t.Fatalf("Expected 102 byte packet, got %d", len(packet))
+	}
+	if !bytes.Equal(packet[:6], bytes.Repeat([]byte{0xFF}, 6)) {
+		t.Error("Expected packet to start with six 0xFF bytes")
+	}
+	if !bytes.Equal(packet[96:], mac) {
+		t.Error("Expected packet to end with the MAC address")
+	}
+}
+
+func TestActionWakeOnLAN(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	params := map[string]string{"mac": "01:23:45:67:89:ab", "broadcast": conn.LocalAddr().String()}
+	if _, err := runActionParams("wol", params, TemplateData{}); err != nil {
+		t.Fatalf("Failed to send magic packet: %v", err)
+	}
+
+	buf := make([]byte, 256)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Failed to receive magic packet: %v", err)
+	}
+	if n != 102 {
+		t.Errorf("Expected 102 byte packet, got %d", n)
+	}
+}
+
+func TestActionWriteFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "status.txt")
+	data := TemplateData{Vars: map[string]string{"status": "green"}}
+
+	params := map[string]string{"path": path, "content": "{{.Vars.status}}\n"}
+	if _, err := runActionParams("write-file", params, data); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	params["mode"] = "append"
+	if _, err := runActionParams("write-file", params, data); err != nil {
+		t.Fatalf("Failed to append to file: %v", err)
+	}
+
+	content, _ := os.ReadFile(path)
+	if string(content) != "green\ngreen\n" {
+		t.Errorf("Unexpected file content %q", content)
+	}
+}
+
+func TestActionHTTP(t *testing.T) {
+	var gotBody, gotHeader string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		gotHeader = r.Header.Get("Content-Type")
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	params := map[string]string{
+		"method":  "POST",
+		"url":     srv.URL,
+		"headers": "Content-Type: application/json",
+		"body":    `{"status":"{{.Vars.status}}"}`,
+	}
+	data := TemplateData{Vars: map[string]string{"status": "up"}}
+	if _, err := runActionParams("http", params, data); err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	if gotBody != `{"status":"up"}` || gotHeader != "application/json" {
+		t.Errorf("Unexpected request body %q, content type %q", gotBody, gotHeader)
+	}
+
+	params["url"] = srv.URL + "/fail"
+	if _, err := runActionParams("http", params, data); err == nil {
+		t.Error("Expected error for non-2xx status")
+	}
+}
+
+func TestRunActionTask(t *testing.T) {
+	// Setup test directory
+	tmpDir := t.TempDir()
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+	originalDataPath := getDataPath
+	getDataPath = func() string { return tmpDir }
+	defer func() { getDataPath = originalDataPath }()
+
+	setVar := Script{ID: 1, Type: TypeAction, Title: "Set", Action: "set-variable",
+		Params: map[string]string{"name": "greeting", "value": "hello"}}
+	if _, err := runScript(setVar, RunOptions{Trigger: TriggerClient}); err != nil {
+		t.Fatalf("Failed to run set-variable action: %v", err)
+	}
+
+	shell := Script{ID: 2, Type: TypeAction, Title: "Shell", Action: "shell",
+		Params: map[string]string{"command": "echo {{.Vars.greeting}}; exit 4"}}
+	result, err := runScript(shell, RunOptions{Trigger: TriggerClient})
+	if err == nil {
+		t.Error("Expected failing shell command to return an error")
+	}
+	if result.Stdout != "hello" || result.ExitCode != 4 {
+		t.Errorf("Expected output %q and exit code 4, got %q and %d", "hello", result.Stdout, result.ExitCode)
+	}
+}
+
+func TestActionShellWaitsForProcessSlot(t *testing.T) {
+	settings.SetString("max_processes", "1")
+	defer settings.SetString("max_processes", "")
+
+	// Hold the only slot as a running script would
+	release, _ := processes.acquire(context.Background())
+
+	type result struct {
+		out string
+		err error
+	}
+	done := make(chan result)
+	go func() {
+		out, err := actionShell(map[string]string{"command": "echo hi"})
+		done <- result{out, err}
+	}()
+	select {
+	case <-done:
+		t.Fatal("Expected the shell action to wait for a process slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+	select {
+	case r := <-done:
+		if r.err != nil || r.out != "hi\n" {
+			t.Errorf("Expected output %q, got %q (%v)", "hi\n", r.out, r.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the shell action to run once the slot was released")
+	}
+	if processes.count() != 0 {
+		t.Errorf("Expected the slot to be released, %d processes running", processes.count())
+	}
+}
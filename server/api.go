@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// apiVersion is the version of the JSON API served under /api/<version>
+const apiVersion = "v1"
+
+// APIScript is the representation of a task in the v1 API
+type APIScript struct {
+	ID       int               `json:"id"`
+	Slug     string            `json:"slug"`
+	Title    string            `json:"title"`
+	Type     string            `json:"type"`
+	Metadata APIScriptMetadata `json:"metadata"`
+}
+
+// APIScriptMetadata exposes the parts of a task's metadata that are safe to
+// share with clients. Webhook tokens are never included.
+type APIScriptMetadata struct {
+	File      string   `json:"file,omitempty"`
+	Schedules []string `json:"schedules,omitempty"`
+	Action    string   `json:"action,omitempty"`
+	Steps     int      `json:"steps,omitempty"`
+	Webhook   bool     `json:"webhook"`
+	Tags      []string `json:"tags,omitempty"`
+}
+
+var slugPattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slugify turns a task name into a URL friendly slug
+func slugify(name string) string {
+	slug := strings.Trim(slugPattern.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if slug == "" {
+		slug = "task"
+	}
+	return slug
+}
+
+// assignSlugs gives every task a unique slug. Tasks are visited in ID order
+// and later tasks whose slug is taken get their ID appended, so slugs stay
+// stable as long as IDs do.
+func assignSlugs(scripts []Script) map[int]string {
+	sorted := slices.Clone(scripts)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	slugs := make(map[int]string, len(sorted))
+	taken := map[string]bool{}
+	for _, s := range sorted {
+		slug := slugify(s.Name())
+		if taken[slug] {
+			slug = fmt.Sprintf("%s-%d", slug, s.ID)
+		}
+		taken[slug] = true
+		slugs[s.ID] = slug
+	}
+	return slugs
+}
+
+// typeName returns the API name of a task type
+func typeName(t string) string {
+	if t == TypeScript {
+		return "script"
+	}
+	return t
+}
+
+func toAPIScript(s Script, slug string) APIScript {
+	return APIScript{
+		ID:    s.ID,
+		Slug:  slug,
+		Title: s.Name(),
+		Type:  typeName(s.Type),
+		Metadata: APIScriptMetadata{
+			File:      s.File,
+			Schedules: s.Schedules,
+			Action:    s.Action,
+			Steps:     len(s.Steps),
+			Webhook:   s.Hook != nil,
+			Tags:      s.Tags,
+		},
+	}
+}
+
+// findScriptByID looks up a task by its ID
+func findScriptByID(scripts []Script, id int) (Script, bool) {
+	idx := slices.IndexFunc(scripts, func(s Script) bool { return s.ID == id })
+	if idx < 0 {
+		return Script{}, false
+	}
+	return scripts[idx], true
+}
+
+// scriptFromParams resolves the :id route parameter to a registered task.
+// Tasks the client may not access are reported as not found.
+func scriptFromParams(c *fiber.Ctx) (Script, error) {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return Script{}, fiber.NewError(fiber.StatusBadRequest, "script ID must be a number")
+	}
+	script, ok := findScriptByID(getScripts(), id)
+	if !ok || !canAccess(c, script) || !hasValidFile(script) {
+		return Script{}, fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("script %d not found", id))
+	}
+	return script, nil
+}
+
+// registerAPIRoutes adds the versioned JSON API to app
+func registerAPIRoutes(app *fiber.App) {
+	api := app.Group("/api/" + apiVersion)
+	api.Post("/pair", apiPair)
+
+	// Everything else needs a client token or the API key
+	api.Use(requireAuth)
+	api.Get("/scripts", apiListScripts)
+	api.Get("/scripts/:id", apiGetScript)
+	api.Post("/scripts/:id/run", apiRunScript)
+	api.Post("/scripts/:id/run/stream", apiRunScriptStream)
+	api.Get("/runs", apiListRuns)
+	api.Get("/events", apiEvents)
+	api.Get("/profile", apiGetProfile)
+	api.Put("/profile", apiSwitchProfile)
+
+	// Managing tasks requires the API key
+	api.Post("/scripts", requireAPIKey, apiCreateScript)
+	api.Get("/scripts/:id/document", requireAPIKey, apiGetDocument)
+	api.Put("/scripts/:id/document", requireAPIKey, apiUpdateDocument)
+	api.Post("/scripts/:id/rename", requireAPIKey, apiRenameScript)
+	api.Delete("/scripts/:id", requireAPIKey, apiDeleteScript)
+	api.Post("/pairing", requireAPIKey, apiStartPairing)
+	api.Get("/audit", requireAPIKey, apiExportAudit)
+	api.Get("/notifications", requireAPIKey, apiGetNotifications)
+	api.Put("/notifications", requireAPIKey, apiSetNotifications)
+	api.Get("/notifications/deliveries", requireAPIKey, apiListDeliveries)
+}
+
+// apiListScripts returns the tasks the client may access ordered by ID
+func apiListScripts(c *fiber.Ctx) error {
+	scripts := accessibleScripts(c, getScripts())
+	sort.Slice(scripts, func(i, j int) bool {
+		return scripts[i].ID < scripts[j].ID
+	})
+
+	slugs := assignSlugs(scripts)
+	out := make([]APIScript, 0, len(scripts))
+	for _, s := range scripts {
+		out = append(out, toAPIScript(s, slugs[s.ID]))
+	}
+	return c.JSON(out)
+}
+
+// apiGetScript returns a single task
+func apiGetScript(c *fiber.Ctx) error {
+	script, err := scriptFromParams(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(toAPIScript(script, assignSlugs(getScripts())[script.ID]))
+}
+
+// apiRunScript runs a task and returns the run result. A script exiting
+// with an error is still a successful request, its exit code is part of
+// the result.
+func apiRunScript(c *fiber.Ctx) error {
+	script, err := scriptFromParams(c)
+	if err != nil {
+		return err
+	}
+
+	if err := limitRun(c, script); err != nil {
+		return err
+	}
+	recordAudit(auditRequest(c, AuditRun).withScript(script))
+	result, err := runScript(script, RunOptions{Trigger: TriggerClient, Stdin: c.Body(), Context: c.Context()})
+	if errors.Is(err, errBusy) {
+		return busy(c)
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+	}
+	return c.JSON(result)
+}
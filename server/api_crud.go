@@ -0,0 +1,378 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ScriptDocument is the full, editable representation of a task, including
+// the source of bun scripts. Webhooks are managed from the server GUI and
+// are left untouched by updates.
+type ScriptDocument struct {
+	ID        int               `json:"id"`
+	Type      string            `json:"type"`
+	Title     string            `json:"title,omitempty"`
+	File      string            `json:"file,omitempty"`
+	Source    string            `json:"source,omitempty"`
+	Schedules []string          `json:"schedules,omitempty"`
+	Steps     []MacroStep       `json:"steps,omitempty"`
+	Action    string            `json:"action,omitempty"`
+	Params    map[string]string `json:"params,omitempty"`
+	Tags      []string          `json:"tags,omitempty"`
+}
+
+// renameRequest is the body of the rename endpoint
+type renameRequest struct {
+	File  string `json:"file"`
+	Title string `json:"title"`
+}
+
+// scriptType returns the internal type of an API type name
+func scriptType(name string) (string, error) {
+	switch name {
+	case "", "script":
+		return TypeScript, nil
+	case TypeMacro, TypeAction:
+		return name, nil
+	}
+	return "", fmt.Errorf("unknown task type %q", name)
+}
+
+// toDocument builds the document of a task, reading its source if it has one
+func toDocument(s Script) (ScriptDocument, error) {
+	doc := ScriptDocument{
+		ID:        s.ID,
+		Type:      typeName(s.Type),
+		Title:     s.Title,
+		File:      s.File,
+		Schedules: s.Schedules,
+		Steps:     s.Steps,
+		Action:    s.Action,
+		Params:    s.Params,
+		Tags:      s.Tags,
+	}
+	if s.Type == TypeScript {
+		source, err := readScript(s.File)
+		if err != nil {
+			return doc, err
+		}
+		doc.Source = source
+	}
+	return doc, nil
+}
+
+// documentETag returns a strong ETag for a document
+func documentETag(doc ScriptDocument) string {
+	data, _ := json.Marshal(doc)
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// fromDocument turns a document into a task and validates it against the
+// other registered tasks
+func fromDocument(doc ScriptDocument, scripts []Script) (Script, error) {
+	t, err := scriptType(doc.Type)
+	if err != nil {
+		return Script{}, err
+	}
+	script := Script{
+		ID:        doc.ID,
+		File:      doc.File,
+		Type:      t,
+		Title:     strings.TrimSpace(doc.Title),
+		Schedules: doc.Schedules,
+		Steps:     doc.Steps,
+		Action:    doc.Action,
+		Params:    doc.Params,
+		Tags:      parseTags(strings.Join(doc.Tags, ",")),
+	}
+
+	if script.ID <= 0 {
+		return script, errors.New("id must be a positive number")
+	}
+
+	var errs []error
+	switch t {
+	case TypeScript:
+		if !slices.Contains(scriptExtensions, filepath.Ext(script.File)) {
+			errs = append(errs, fmt.Errorf("unsupported script extension %q", filepath.Ext(script.File)))
+		} else if _, err := resolveScriptPath(script.File); err != nil {
+			errs = append(errs, err)
+		}
+		if len(script.Steps) > 0 || script.Action != "" || len(script.Params) > 0 {
+			errs = append(errs, errors.New("scripts cannot have steps or an action"))
+		}
+	case TypeMacro:
+		if script.Title == "" {
+			errs = append(errs, errors.New("macros need a title"))
+		}
+		if err := validateMacro(script, scripts); err != nil {
+			errs = append(errs, err)
+		}
+	case TypeAction:
+		if script.Title == "" {
+			errs = append(errs, errors.New("actions need a title"))
+		}
+		if err := validateAction(script.Action, script.Params); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if t != TypeScript && (script.File != "" || doc.Source != "") {
+		errs = append(errs, fmt.Errorf("%s tasks have no file or source", t))
+	}
+	for _, spec := range script.Schedules {
+		if err := validateSchedule(spec); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return script, errors.Join(errs...)
+}
+
+// checkIfMatch compares the If-Match header with the current ETag. When
+// required is false a missing header is accepted.
+func checkIfMatch(c *fiber.Ctx, etag string, required bool) error {
+	match := c.Get(fiber.HeaderIfMatch)
+	if match == "" {
+		if required {
+			return fiber.NewError(fiber.StatusPreconditionRequired, "If-Match header is required")
+		}
+		return nil
+	}
+	if match != "*" && match != etag {
+		return fiber.NewError(fiber.StatusPreconditionFailed, "script was modified, reload it and try again")
+	}
+	return nil
+}
+
+// sendDocument responds with the current document of the task with the
+// given ID and its ETag
+func sendDocument(c *fiber.Ctx, id int, status int) error {
+	script, ok := findScriptByID(getScripts(), id)
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("script %d not found", id))
+	}
+	doc, err := toDocument(script)
+	if err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderETag, documentETag(doc))
+	return c.Status(status).JSON(doc)
+}
+
+// currentDocument resolves the :id route parameter and returns the task,
+// its document and the document's ETag
+func currentDocument(c *fiber.Ctx) (Script, string, error) {
+	script, err := scriptFromParams(c)
+	if err != nil {
+		return script, "", err
+	}
+	doc, err := toDocument(script)
+	if err != nil {
+		return script, "", err
+	}
+	return script, documentETag(doc), nil
+}
+
+// hasField reports whether the JSON object body sets the field name.
+// Fields such as source are omitted when empty, so their zero value
+// alone does not tell whether they were sent.
+func hasField(body []byte, name string) bool {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return false
+	}
+	_, ok := fields[name]
+	return ok
+}
+
+// badRequest wraps a validation error in a 400 response
+func badRequest(err error) error {
+	return fiber.NewError(fiber.StatusBadRequest, err.Error())
+}
+
+// apiGetDocument returns the full document of a task
+func apiGetDocument(c *fiber.Ctx) error {
+	script, err := scriptFromParams(c)
+	if err != nil {
+		return err
+	}
+	return sendDocument(c, script.ID, fiber.StatusOK)
+}
+
+// apiCreateScript creates a task. A missing ID is assigned automatically.
+func apiCreateScript(c *fiber.Ctx) error {
+	scriptsMu.Lock()
+	defer scriptsMu.Unlock()
+
+	var doc ScriptDocument
+	if err := json.Unmarshal(c.Body(), &doc); err != nil {
+		return badRequest(fmt.Errorf("invalid document: %w", err))
+	}
+
+	scripts := getScripts()
+	if doc.ID == 0 {
+		doc.ID = getMaxScriptId() + 1
+	}
+	script, err := fromDocument(doc, scripts)
+	if err != nil {
+		return badRequest(err)
+	}
+	if _, ok := findScriptByID(scripts, script.ID); ok {
+		return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("script with ID %d already exists", script.ID))
+	}
+
+	if script.Type == TypeScript {
+		path, _ := resolveScriptPath(script.File)
+		if _, err := os.Stat(path); err == nil || slices.ContainsFunc(scripts, func(s Script) bool { return s.File == script.File }) {
+			return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("script file %q already exists", script.File))
+		}
+		err = createScriptLocked(script, doc.Source)
+	} else {
+		err = writeScriptMetadataLocked(script)
+	}
+	if err != nil {
+		return err
+	}
+	reloadSchedules()
+	recordAudit(auditRequest(c, AuditCreate).withScript(script))
+
+	c.Location("/api/" + apiVersion + "/scripts/" + strconv.Itoa(script.ID))
+	return sendDocument(c, script.ID, fiber.StatusCreated)
+}
+
+// apiUpdateDocument replaces a task's source and metadata with the given
+// document. The task's type and file cannot be changed here, files are
+// renamed through the rename endpoint. A script keeps its source if the
+// document has none, so metadata can be changed on its own.
+func apiUpdateDocument(c *fiber.Ctx) error {
+	scriptsMu.Lock()
+	defer scriptsMu.Unlock()
+
+	current, etag, err := currentDocument(c)
+	if err != nil {
+		return err
+	}
+	if err := checkIfMatch(c, etag, true); err != nil {
+		return err
+	}
+
+	var doc ScriptDocument
+	if err := json.Unmarshal(c.Body(), &doc); err != nil {
+		return badRequest(fmt.Errorf("invalid document: %w", err))
+	}
+	if doc.ID == 0 {
+		doc.ID = current.ID
+	}
+	if doc.Type == "" {
+		doc.Type = typeName(current.Type)
+	}
+	if doc.File == "" {
+		doc.File = current.File
+	}
+	if current.Type == TypeScript && !hasField(c.Body(), "source") {
+		if doc.Source, err = readScript(current.File); err != nil {
+			return err
+		}
+	}
+
+	scripts := slices.DeleteFunc(getScripts(), func(s Script) bool { return s.ID == current.ID })
+	script, err := fromDocument(doc, scripts)
+	if err != nil {
+		return badRequest(err)
+	}
+	if script.Type != current.Type {
+		return badRequest(errors.New("the type of a task cannot be changed"))
+	}
+	if script.File != current.File {
+		return badRequest(errors.New("use the rename endpoint to change the file name"))
+	}
+	if _, ok := findScriptByID(scripts, script.ID); ok {
+		return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("script with ID %d already exists", script.ID))
+	}
+	script.Hook = current.Hook
+
+	if script.Type == TypeScript {
+		// updateScript keeps the metadata of the script it is given and
+		// moves it to the new ID
+		newID := script.ID
+		script.ID = current.ID
+		err = updateScriptLocked(script, newID, doc.Source)
+		script.ID = newID
+	} else {
+		err = updateScriptMetadataLocked(current.ID, script)
+	}
+	if err != nil {
+		return err
+	}
+	reloadSchedules()
+	recordAudit(auditRequest(c, AuditUpdate).withScript(script))
+
+	return sendDocument(c, script.ID, fiber.StatusOK)
+}
+
+// apiRenameScript renames the file of a script or the title of any task.
+// If-Match is optional here as a rename cannot lose an edit.
+func apiRenameScript(c *fiber.Ctx) error {
+	scriptsMu.Lock()
+	defer scriptsMu.Unlock()
+
+	script, etag, err := currentDocument(c)
+	if err != nil {
+		return err
+	}
+	if err := checkIfMatch(c, etag, false); err != nil {
+		return err
+	}
+
+	var req renameRequest
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return badRequest(fmt.Errorf("invalid request: %w", err))
+	}
+	if req.File == "" && req.Title == "" {
+		return badRequest(errors.New("file or title is required"))
+	}
+
+	if req.File != "" && req.File != script.File && script.Type != TypeScript {
+		return badRequest(errors.New("only scripts have a file"))
+	}
+	if err := renameScriptLocked(script.ID, req.File, req.Title); err != nil {
+		return badRequest(err)
+	}
+	entry := auditRequest(c, AuditRename).withScript(script)
+	entry.Detail = strings.TrimSpace(req.File + " " + req.Title)
+	recordAudit(entry)
+
+	return sendDocument(c, script.ID, fiber.StatusOK)
+}
+
+// apiDeleteScript deletes a task and its script file
+func apiDeleteScript(c *fiber.Ctx) error {
+	scriptsMu.Lock()
+	defer scriptsMu.Unlock()
+
+	script, etag, err := currentDocument(c)
+	if err != nil {
+		return err
+	}
+	if err := checkIfMatch(c, etag, true); err != nil {
+		return err
+	}
+
+	if err := deleteScriptLocked(script.ID); err != nil {
+		return err
+	}
+	reloadSchedules()
+	recordAudit(auditRequest(c, AuditDelete).withScript(script))
+	return c.SendStatus(fiber.StatusNoContent)
+}
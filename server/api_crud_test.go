@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAPIScriptCRUD(t *testing.T) {
+	// Setup test directory
+	tmpDir := t.TempDir()
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+
+	originalKey := getAPIKey
+	getAPIKey = func() string { return "test-key" }
+	defer func() { getAPIKey = originalKey }()
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "scripts.json"), []byte("[]"), 0644); err != nil {
+		t.Fatalf("Failed to create scripts.json: %v", err)
+	}
+
+	app := fiber.New()
+	registerAPIRoutes(app)
+
+	request := func(method, path, body string, headers map[string]string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer test-key")
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		return resp
+	}
+
+	// Requests without the API key are rejected
+	req := httptest.NewRequest("POST", "/api/v1/scripts", strings.NewReader(`{"file":"hello.js"}`))
+	resp, _ := app.Test(req)
+	if resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("Expected status 401 without API key, got %d", resp.StatusCode)
+	}
+
+	resp = request("POST", "/api/v1/scripts", `{"file":"hello.py","source":"print(1)"}`, nil)
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("Expected status 400 for unsupported extension, got %d", resp.StatusCode)
+	}
+	resp = request("POST", "/api/v1/scripts", `{"file":"../hello.js"}`, nil)
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("Expected status 400 for path outside scripts directory, got %d", resp.StatusCode)
+	}
+
+	events := subscribe()
+	resp = request("POST", "/api/v1/scripts", `{"file":"hello.js","source":"console.log(1)","schedules":["@hourly"]}`, nil)
+	if resp.StatusCode != fiber.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("Expected status 201, got %d: %s", resp.StatusCode, body)
+	}
+	// The task is added with its metadata in one change
+	if got := receiveEvents(t, events, 1); got[0].Type != EventScriptAdded || got[0].Script == nil || len(got[0].Script.Metadata.Schedules) != 1 {
+		t.Errorf("Expected the task to be added with its schedules, got %+v", got[0])
+	}
+	select {
+	case e := <-events:
+		t.Errorf("Expected a single event for the new task, got %s", e.Type)
+	case <-time.After(50 * time.Millisecond):
+	}
+	unsubscribe(events)
+	if resp.Header.Get("Location") != "/api/v1/scripts/1" {
+		t.Errorf("Unexpected Location %q", resp.Header.Get("Location"))
+	}
+	etag := resp.Header.Get("ETag")
+
+	resp = request("POST", "/api/v1/scripts", `{"file":"hello.js"}`, nil)
+	if resp.StatusCode != fiber.StatusConflict {
+		t.Errorf("Expected status 409 for duplicate file, got %d", resp.StatusCode)
+	}
+
+	resp = request("GET", "/api/v1/scripts/1/document", "", nil)
+	var doc ScriptDocument
+	json.NewDecoder(resp.Body).Decode(&doc)
+	if doc.Source != "console.log(1)" || doc.Type != "script" || len(doc.Schedules) != 1 {
+		t.Errorf("Unexpected document %+v", doc)
+	}
+	if resp.Header.Get("ETag") != etag {
+		t.Error("Expected ETag to match the one returned on create")
+	}
+
+	// Updates need a matching If-Match header
+	update := `{"source":"console.log(2)","schedules":["@daily"]}`
+	if resp := request("PUT", "/api/v1/scripts/1/document", update, nil); resp.StatusCode != fiber.StatusPreconditionRequired {
+		t.Errorf("Expected status 428 without If-Match, got %d", resp.StatusCode)
+	}
+	if resp := request("PUT", "/api/v1/scripts/1/document", update, map[string]string{"If-Match": `"stale"`}); resp.StatusCode != fiber.StatusPreconditionFailed {
+		t.Errorf("Expected status 412 for stale ETag, got %d", resp.StatusCode)
+	}
+	resp = request("PUT", "/api/v1/scripts/1/document", update, map[string]string{"If-Match": etag})
+	if resp.StatusCode != fiber.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("Expected status 200, got %d: %s", resp.StatusCode, body)
+	}
+	if resp.Header.Get("ETag") == etag {
+		t.Error("Expected ETag to change after update")
+	}
+	etag = resp.Header.Get("ETag")
+	if content, _ := readScript("hello.js"); content != "console.log(2)" {
+		t.Errorf("Expected updated source, got %q", content)
+	}
+
+	// Metadata can be changed without sending the source again
+	resp = request("PUT", "/api/v1/scripts/1/document", `{"title":"Hello","schedules":["@daily"],"tags":["lights"]}`, map[string]string{"If-Match": etag})
+	if resp.StatusCode != fiber.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("Expected status 200, got %d: %s", resp.StatusCode, body)
+	}
+	etag = resp.Header.Get("ETag")
+	if content, _ := readScript("hello.js"); content != "console.log(2)" {
+		t.Errorf("Expected source to be kept, got %q", content)
+	}
+	if script, _ := findScriptByID(getScripts(), 1); script.Title != "Hello" || len(script.Tags) != 1 {
+		t.Errorf("Expected updated metadata, got %+v", script)
+	}
+
+	// A rejected title leaves the file where it is
+	resp = request("POST", "/api/v1/scripts/1/rename", `{"file":"greet.ts","title":"  "}`, nil)
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("Expected status 400 for a blank title, got %d", resp.StatusCode)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "hello.js")); err != nil {
+		t.Errorf("Expected script file to stay after a rejected rename: %v", err)
+	}
+
+	resp = request("POST", "/api/v1/scripts/1/rename", `{"file":"greet.ts","title":"Greet"}`, nil)
+	if resp.StatusCode != fiber.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("Expected status 200, got %d: %s", resp.StatusCode, body)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "hello.js")); !os.IsNotExist(err) {
+		t.Error("Expected old script file to be moved")
+	}
+	script, _ := findScriptByID(getScripts(), 1)
+	if script.File != "greet.ts" || script.Title != "Greet" || len(script.Schedules) != 1 {
+		t.Errorf("Unexpected script after rename %+v", script)
+	}
+
+	// The rename changed the document, so the old ETag is stale
+	if resp := request("DELETE", "/api/v1/scripts/1", "", map[string]string{"If-Match": etag}); resp.StatusCode != fiber.StatusPreconditionFailed {
+		t.Errorf("Expected status 412 for stale ETag, got %d", resp.StatusCode)
+	}
+	if resp := request("DELETE", "/api/v1/scripts/1", "", map[string]string{"If-Match": "*"}); resp.StatusCode != fiber.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", resp.StatusCode)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "greet.ts")); !os.IsNotExist(err) {
+		t.Error("Expected script file to be deleted")
+	}
+	if len(getScripts()) != 0 {
+		t.Error("Expected script to be removed from scripts.json")
+	}
+}
+
+func TestAPICreateMacro(t *testing.T) {
+	// Setup test directory
+	tmpDir := t.TempDir()
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+
+	originalKey := getAPIKey
+	getAPIKey = func() string { return "test-key" }
+	defer func() { getAPIKey = originalKey }()
+
+	scriptsData, _ := json.MarshalIndent([]Script{{ID: 4, File: "test.js"}}, "", "\t")
+	if err := os.WriteFile(filepath.Join(tmpDir, "scripts.json"), scriptsData, 0644); err != nil {
+		t.Fatalf("Failed to create scripts.json: %v", err)
+	}
+
+	app := fiber.New()
+	registerAPIRoutes(app)
+
+	testCases := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"unknown script", `{"type":"macro","title":"m","steps":[{"type":"script","script":9}]}`, fiber.StatusBadRequest},
+		{"missing title", `{"type":"macro","steps":[{"type":"script","script":4}]}`, fiber.StatusBadRequest},
+		{"bad schedule", `{"type":"macro","title":"m","steps":[{"type":"script","script":4}],"schedules":["never"]}`, fiber.StatusBadRequest},
+		{"with source", `{"type":"macro","title":"m","source":"x","steps":[{"type":"script","script":4}]}`, fiber.StatusBadRequest},
+		{"valid", `{"type":"macro","title":"m","steps":[{"type":"script","script":4}]}`, fiber.StatusCreated},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/v1/scripts", strings.NewReader(tc.body))
+			req.Header.Set("Authorization", "Bearer test-key")
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Failed to send request: %v", err)
+			}
+			if resp.StatusCode != tc.status {
+				t.Errorf("Expected status %d, got %d", tc.status, resp.StatusCode)
+			}
+		})
+	}
+
+	script, ok := findScriptByID(getScripts(), 5)
+	if !ok || script.Type != TypeMacro {
+		t.Errorf("Expected macro with ID 5, got %+v", script)
+	}
+}
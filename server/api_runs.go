@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// defaultHistoryLimit is the number of runs returned when no limit is given
+const defaultHistoryLimit = 50
+
+// RunOutput is a line of a streamed run. Output lines carry the stream they
+// were written to, the last line carries the result of the run.
+type RunOutput struct {
+	Stream string     `json:"stream,omitempty"`
+	Data   string     `json:"data,omitempty"`
+	Result *RunResult `json:"result,omitempty"`
+}
+
+// outputStream writes the output of a script as RunOutput lines. Scripts
+// write stdout and stderr concurrently, so both streams share a lock.
+type outputStream struct {
+	mu     *sync.Mutex
+	enc    *json.Encoder
+	w      *bufio.Writer
+	stream string
+}
+
+// Write sends p to the client. Errors are ignored so that a client going
+// away does not interrupt the script, its result is still recorded.
+func (o outputStream) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.enc.Encode(RunOutput{Stream: o.stream, Data: string(p)})
+	o.w.Flush()
+	return len(p), nil
+}
+
+// apiRunScriptStream runs a task like apiRunScript, but streams its output
+// as JSON lines while it runs and ends with the result
+func apiRunScriptStream(c *fiber.Ctx) error {
+	script, err := scriptFromParams(c)
+	if err != nil {
+		return err
+	}
+
+	if err := limitRun(c, script); err != nil {
+		return err
+	}
+	recordAudit(auditRequest(c, AuditRun).withScript(script))
+	// The request is reused once the handler returns, the run happens
+	// while the response is written
+	stdin := slices.Clone(c.Body())
+	c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		var mu sync.Mutex
+		enc := json.NewEncoder(w)
+		result, err := runScript(script, RunOptions{
+			Trigger: TriggerClient,
+			Stdin:   stdin,
+			Stdout:  outputStream{mu: &mu, enc: enc, w: w, stream: "stdout"},
+			Stderr:  outputStream{mu: &mu, enc: enc, w: w, stream: "stderr"},
+		})
+		if err != nil {
+			fmt.Println("Error:", err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		enc.Encode(RunOutput{Result: &result})
+		w.Flush()
+	})
+	return nil
+}
+
+// apiListRuns returns the run history, newest first. The script query
+// parameter limits it to a single task and limit to a number of runs.
+// Clients only see runs of tasks they may access.
+func apiListRuns(c *fiber.Ctx) error {
+	scriptID := 0
+	if s := c.Query("script"); s != "" {
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			return badRequest(errors.New("script must be a number"))
+		}
+		scriptID = id
+	}
+	limit := defaultHistoryLimit
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return badRequest(errors.New("limit must be a positive number"))
+		}
+		limit = n
+	}
+
+	scripts := getScripts()
+	runs := getRunHistory(func(r RunResult) bool {
+		if scriptID != 0 && r.ScriptID != scriptID {
+			return false
+		}
+		if _, ok := requestClient(c); !ok {
+			return true
+		}
+		// Runs of deleted tasks are only shown to the owner
+		script, ok := findScriptByID(scripts, r.ScriptID)
+		return ok && canAccess(c, script)
+	})
+	if len(runs) > limit {
+		runs = runs[:limit]
+	}
+	if runs == nil {
+		runs = []RunResult{}
+	}
+	return c.JSON(runs)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAPIRunStream(t *testing.T) {
+	// Setup test directory
+	tmpDir := t.TempDir()
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+
+	// Run scripts with sh so the test does not depend on bun
+	originalRuntime := scriptRuntime
+	scriptRuntime = []string{"sh"}
+	defer func() { scriptRuntime = originalRuntime }()
+
+	script := "echo one; echo oops >&2; read name; echo hello $name; exit 3"
+	if err := os.WriteFile(filepath.Join(tmpDir, "greet.js"), []byte(script), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	scriptsData, _ := json.MarshalIndent([]Script{{ID: 1, File: "greet.js"}}, "", "\t")
+	if err := os.WriteFile(filepath.Join(tmpDir, "scripts.json"), scriptsData, 0644); err != nil {
+		t.Fatalf("Failed to create scripts.json: %v", err)
+	}
+
+	originalKey := getAPIKey
+	getAPIKey = func() string { return "test-key" }
+	defer func() { getAPIKey = originalKey }()
+
+	app := fiber.New()
+	registerAPIRoutes(app)
+
+	req := authorized(httptest.NewRequest("POST", "/api/v1/scripts/1/run/stream", strings.NewReader("deck\n")))
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to test request: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	output := map[string]string{}
+	var result *RunResult
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var line RunOutput
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("Invalid line %q: %v", scanner.Text(), err)
+		}
+		if line.Result != nil {
+			result = line.Result
+			continue
+		}
+		output[line.Stream] += line.Data
+	}
+
+	if output["stdout"] != "one\nhello deck\n" || output["stderr"] != "oops\n" {
+		t.Errorf("Unexpected streamed output %q", output)
+	}
+	if result == nil || result.ExitCode != 3 || result.Stdout != "one\nhello deck" {
+		t.Errorf("Expected result as the last line, got %+v", result)
+	}
+}
+
+func TestAPIListRuns(t *testing.T) {
+	// Setup test directory
+	tmpDir := t.TempDir()
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+	originalDataPath := getDataPath
+	getDataPath = func() string { return tmpDir }
+	defer func() { getDataPath = originalDataPath }()
+
+	scripts := []Script{{ID: 1, File: "a.js", Tags: []string{"media"}}, {ID: 2, File: "b.js"}}
+	scriptsData, _ := json.MarshalIndent(scripts, "", "\t")
+	if err := os.WriteFile(filepath.Join(tmpDir, "scripts.json"), scriptsData, 0644); err != nil {
+		t.Fatalf("Failed to create scripts.json: %v", err)
+	}
+
+	historyMu.Lock()
+	original := runHistory
+	runHistory = []RunResult{{ScriptID: 1, Stdout: "first"}, {ScriptID: 2}, {ScriptID: 3}, {ScriptID: 1, Stdout: "second"}}
+	historyMu.Unlock()
+	defer func() {
+		historyMu.Lock()
+		runHistory = original
+		historyMu.Unlock()
+	}()
+
+	originalKey := getAPIKey
+	getAPIKey = func() string { return "test-key" }
+	defer func() { getAPIKey = originalKey }()
+
+	client, token := newClient("tablet")
+	client.Restricted, client.Tags = true, []string{"media"}
+	if err := addClient(client); err != nil {
+		t.Fatalf("Failed to add client: %v", err)
+	}
+
+	app := fiber.New()
+	registerAPIRoutes(app)
+
+	list := func(token, query string) []RunResult {
+		req := httptest.NewRequest("GET", "/api/v1/runs"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to test request: %v", err)
+		}
+		if resp.StatusCode != fiber.StatusOK {
+			t.Fatalf("Expected status 200 for %q, got %d", query, resp.StatusCode)
+		}
+		var runs []RunResult
+		json.NewDecoder(resp.Body).Decode(&runs)
+		return runs
+	}
+
+	if runs := list("test-key", ""); len(runs) != 4 || runs[0].Stdout != "second" {
+		t.Errorf("Expected all runs newest first, got %+v", runs)
+	}
+	if runs := list("test-key", "?script=1&limit=1"); len(runs) != 1 || runs[0].Stdout != "second" {
+		t.Errorf("Expected latest run of task 1, got %+v", runs)
+	}
+	if runs := list(token, ""); len(runs) != 2 || runs[0].ScriptID != 1 || runs[1].ScriptID != 1 {
+		t.Errorf("Expected only runs of accessible tasks, got %+v", runs)
+	}
+
+	req := authorized(httptest.NewRequest("GET", "/api/v1/runs?limit=0", nil))
+	if resp, _ := app.Test(req); resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid limit, got %d", resp.StatusCode)
+	}
+}
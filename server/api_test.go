@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// authorized adds the API key used by tests to a request
+func authorized(req *http.Request) *http.Request {
+	req.Header.Set("Authorization", "Bearer test-key")
+	return req
+}
+
+func TestAssignSlugs(t *testing.T) {
+	scripts := []Script{
+		{ID: 3, File: "foo.js"},
+		{ID: 1, File: "foo.ts"},
+		{ID: 2, Type: TypeMacro, Title: "Post Standup Note!"},
+	}
+
+	slugs := assignSlugs(scripts)
+	want := map[int]string{1: "foo", 2: "post-standup-note", 3: "foo-3"}
+	for id, slug := range want {
+		if slugs[id] != slug {
+			t.Errorf("Expected slug %q for script %d, got %q", slug, id, slugs[id])
+		}
+	}
+}
+
+func TestAPIScripts(t *testing.T) {
+	// Setup test directory
+	tmpDir := t.TempDir()
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+
+	// Run scripts with sh so the test does not depend on bun
+	originalRuntime := scriptRuntime
+	scriptRuntime = []string{"sh"}
+	defer func() { scriptRuntime = originalRuntime }()
+
+	files := map[string]string{"foo.ts": "echo ts", "foo.js": "echo js"}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	scripts := []Script{
+		{ID: 2, File: "foo.js", Hook: &Hook{Token: "secret-token"}},
+		{ID: 1, File: "foo.ts", Schedules: []string{"@hourly"}},
+	}
+	scriptsData, _ := json.MarshalIndent(scripts, "", "\t")
+	if err := os.WriteFile(filepath.Join(tmpDir, "scripts.json"), scriptsData, 0644); err != nil {
+		t.Fatalf("Failed to create scripts.json: %v", err)
+	}
+
+	originalKey := getAPIKey
+	getAPIKey = func() string { return "test-key" }
+	defer func() { getAPIKey = originalKey }()
+
+	app := fiber.New()
+	registerAPIRoutes(app)
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/api/v1/scripts", nil))
+	if resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("Expected status 401 without a token, got %d", resp.StatusCode)
+	}
+
+	// List returns typed objects ordered by ID
+	resp, err := app.Test(authorized(httptest.NewRequest("GET", "/api/v1/scripts", nil)))
+	if err != nil {
+		t.Fatalf("Failed to test request: %v", err)
+	}
+	var list []APIScript
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(list) != 2 || list[0].ID != 1 || list[1].ID != 2 {
+		t.Fatalf("Expected scripts 1 and 2 in order, got %+v", list)
+	}
+	if list[0].Slug == list[1].Slug {
+		t.Errorf("Expected unique slugs, got %q twice", list[0].Slug)
+	}
+	if list[0].Type != "script" || list[0].Metadata.Schedules[0] != "@hourly" {
+		t.Errorf("Unexpected metadata %+v", list[0])
+	}
+	if !list[1].Metadata.Webhook {
+		t.Error("Expected webhook flag on script 2")
+	}
+
+	// Hook tokens must not leak through the API
+	resp, _ = app.Test(authorized(httptest.NewRequest("GET", "/api/v1/scripts/2", nil)))
+	body := make([]byte, 4096)
+	n, _ := resp.Body.Read(body)
+	if strings.Contains(string(body[:n]), "secret-token") {
+		t.Error("Expected webhook token to be hidden")
+	}
+
+	testCases := []struct {
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{"GET", "/api/v1/scripts/1", 200},
+		{"GET", "/api/v1/scripts/9", 404},
+		{"GET", "/api/v1/scripts/foo", 400},
+		{"POST", "/api/v1/scripts/9/run", 404},
+	}
+	for _, tc := range testCases {
+		resp, err := app.Test(authorized(httptest.NewRequest(tc.method, tc.path, nil)))
+		if err != nil {
+			t.Fatalf("Failed to test request: %v", err)
+		}
+		if resp.StatusCode != tc.wantStatus {
+			t.Errorf("%s %s: expected status %d, got %d", tc.method, tc.path, tc.wantStatus, resp.StatusCode)
+		}
+	}
+
+	// Runs are addressed by ID, so same-named scripts do not collide
+	for id, want := range map[string]string{"1": "ts", "2": "js"} {
+		resp, err := app.Test(authorized(httptest.NewRequest("POST", "/api/v1/scripts/"+id+"/run", nil)))
+		if err != nil {
+			t.Fatalf("Failed to test request: %v", err)
+		}
+		var result RunResult
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if result.Stdout != want {
+			t.Errorf("Expected script %s to print %q, got %q", id, want, result.Stdout)
+		}
+	}
+}
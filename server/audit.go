@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Audited actions
+const (
+	AuditPair        = "client.pair"
+	AuditPairFailed  = "client.pair-failed"
+	AuditRevoke      = "client.revoke"
+	AuditPermissions = "client.permissions"
+	AuditAuthFailed  = "auth.failed"
+	AuditCreate      = "script.create"
+	AuditUpdate      = "script.update"
+	AuditRename      = "script.rename"
+	AuditDelete      = "script.delete"
+	AuditRun         = "script.run"
+	AuditProfile     = "profile.switch"
+)
+
+// auditActions lists the audited actions for filters
+var auditActions = []string{
+	AuditPair, AuditPairFailed, AuditRevoke, AuditPermissions, AuditAuthFailed,
+	AuditCreate, AuditUpdate, AuditRename, AuditDelete, AuditRun, AuditProfile,
+}
+
+const (
+	// maxAuditSize is the size at which the audit log is rotated
+	maxAuditSize = 5 << 20
+	// maxAuditFiles is the number of rotated audit logs kept
+	maxAuditFiles = 5
+)
+
+// Actors recorded for actions that do not come from a paired client
+const (
+	actorOwner   = "owner"
+	actorGUI     = "server GUI"
+	actorWebhook = "webhook"
+	actorMQTT    = "mqtt"
+)
+
+var auditMu sync.Mutex
+
+// AuditEntry records who did what. Entries are only ever appended.
+type AuditEntry struct {
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"`
+	ClientID string    `json:"clientId,omitempty"`
+	Client   string    `json:"client"`
+	IP       string    `json:"ip,omitempty"`
+	ScriptID int       `json:"scriptId,omitempty"`
+	Script   string    `json:"script,omitempty"`
+	Detail   string    `json:"detail,omitempty"`
+}
+
+func auditFile() string {
+	return filepath.Join(getDataPath(), "audit.log")
+}
+
+// rotatedAuditFile returns the path of the nth rotated audit log
+func rotatedAuditFile(n int) string {
+	return fmt.Sprintf("%s.%d", auditFile(), n)
+}
+
+// recordAudit appends an entry to the audit log
+func recordAudit(entry AuditEntry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		fmt.Println("Failed to marshal audit entry:", err)
+		return
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	if err := rotateAudit(); err != nil {
+		fmt.Println("Failed to rotate audit log:", err)
+	}
+	if err := os.MkdirAll(getDataPath(), 0755); err != nil {
+		fmt.Println("Failed to write audit log:", err)
+		return
+	}
+	f, err := os.OpenFile(auditFile(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		fmt.Println("Failed to write audit log:", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		fmt.Println("Failed to write audit log:", err)
+	}
+}
+
+// rotateAudit moves the audit log aside once it is too large, keeping
+// maxAuditFiles old logs
+func rotateAudit() error {
+	info, err := os.Stat(auditFile())
+	if err != nil || info.Size() < maxAuditSize {
+		return nil
+	}
+
+	os.Remove(rotatedAuditFile(maxAuditFiles))
+	for n := maxAuditFiles - 1; n >= 1; n-- {
+		if err := os.Rename(rotatedAuditFile(n), rotatedAuditFile(n+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(auditFile(), rotatedAuditFile(1))
+}
+
+// readAudit returns the audit entries matching filter, oldest first. A nil
+// filter matches every entry.
+func readAudit(filter func(AuditEntry) bool) []AuditEntry {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	var entries []AuditEntry
+	files := []string{auditFile()}
+	for n := 1; n <= maxAuditFiles; n++ {
+		files = append(files, rotatedAuditFile(n))
+	}
+	slices.Reverse(files)
+
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var entry AuditEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				continue
+			}
+			if filter == nil || filter(entry) {
+				entries = append(entries, entry)
+			}
+		}
+		f.Close()
+	}
+	return entries
+}
+
+// exportAudit writes the audit entries matching filter as JSON lines
+func exportAudit(w io.Writer, filter func(AuditEntry) bool) error {
+	enc := json.NewEncoder(w)
+	for _, entry := range readAudit(filter) {
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// auditFilter returns a filter for entries with the given action, if not
+// empty, that contain query in any of their text fields
+func auditFilter(action, query string) func(AuditEntry) bool {
+	query = strings.ToLower(strings.TrimSpace(query))
+	return func(e AuditEntry) bool {
+		if action != "" && e.Action != action {
+			return false
+		}
+		if query == "" {
+			return true
+		}
+		text := strings.ToLower(strings.Join([]string{e.Client, e.ClientID, e.IP, e.Script, e.Detail}, " "))
+		return strings.Contains(text, query)
+	}
+}
+
+// apiExportAudit returns the audit log as JSON lines, filtered by the
+// action and q query parameters
+func apiExportAudit(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	return exportAudit(c, auditFilter(c.Query("action"), c.Query("q")))
+}
+
+// auditRequest returns an entry for an action taken by the sender of a
+// request
+func auditRequest(c *fiber.Ctx, action string) AuditEntry {
+	entry := AuditEntry{Action: action, Client: actorOwner, IP: c.IP()}
+	if client, ok := requestClient(c); ok {
+		entry.ClientID = client.ID
+		entry.Client = client.Name
+	}
+	return entry
+}
+
+// withScript adds the task an action applies to
+func (e AuditEntry) withScript(s Script) AuditEntry {
+	e.ScriptID = s.ID
+	e.Script = s.Name()
+	return e
+}
+
+// auditGUI records an action taken in the server GUI
+func auditGUI(action string, s Script) {
+	entry := AuditEntry{Action: action, Client: actorGUI}
+	if s.ID != 0 {
+		entry = entry.withScript(s)
+	}
+	recordAudit(entry)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAuditLog(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalDataPath := getDataPath
+	getDataPath = func() string { return tmpDir }
+	defer func() { getDataPath = originalDataPath }()
+
+	recordAudit(AuditEntry{Action: AuditPair, Client: "tablet", IP: "10.0.0.5"})
+	recordAudit(AuditEntry{Action: AuditRun, Client: "tablet", ScriptID: 1, Script: "lights"})
+	recordAudit(AuditEntry{Action: AuditRun, Client: "phone", ScriptID: 2, Script: "deploy"})
+
+	entries := readAudit(nil)
+	if len(entries) != 3 || entries[0].Action != AuditPair {
+		t.Fatalf("Expected 3 entries oldest first, got %+v", entries)
+	}
+	if got := readAudit(auditFilter(AuditRun, "")); len(got) != 2 {
+		t.Errorf("Expected 2 run entries, got %d", len(got))
+	}
+	if got := readAudit(auditFilter(AuditRun, "DEPLOY")); len(got) != 1 || got[0].Client != "phone" {
+		t.Errorf("Expected the deploy run, got %+v", got)
+	}
+
+	var sb strings.Builder
+	if err := exportAudit(&sb, auditFilter("", "tablet")); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	scanner := bufio.NewScanner(strings.NewReader(sb.String()))
+	lines := 0
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Errorf("Export line is not JSON: %v", err)
+		}
+		lines++
+	}
+	if lines != 2 {
+		t.Errorf("Expected 2 exported lines, got %d", lines)
+	}
+}
+
+func TestAuditRotation(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalDataPath := getDataPath
+	getDataPath = func() string { return tmpDir }
+	defer func() { getDataPath = originalDataPath }()
+
+	recordAudit(AuditEntry{Action: AuditPair, Client: "first"})
+	// Grow the log past the rotation size
+	f, _ := os.OpenFile(auditFile(), os.O_WRONLY|os.O_APPEND, 0600)
+	f.Write([]byte(strings.Repeat("x", maxAuditSize) + "\n"))
+	f.Close()
+
+	recordAudit(AuditEntry{Action: AuditRun, Client: "second"})
+
+	if _, err := os.Stat(filepath.Join(tmpDir, "audit.log.1")); err != nil {
+		t.Fatalf("Expected rotated log: %v", err)
+	}
+	entries := readAudit(nil)
+	if len(entries) != 2 || entries[0].Client != "first" || entries[1].Client != "second" {
+		t.Errorf("Expected entries from both logs in order, got %+v", entries)
+	}
+}
+
+func TestAuditAPIActions(t *testing.T) {
+	// Setup test directory
+	tmpDir := t.TempDir()
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+	originalDataPath := getDataPath
+	getDataPath = func() string { return tmpDir }
+	defer func() { getDataPath = originalDataPath }()
+
+	// Run scripts with sh so the test does not depend on bun
+	originalRuntime := scriptRuntime
+	scriptRuntime = []string{"sh"}
+	defer func() { scriptRuntime = originalRuntime }()
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "lights.js"), []byte("echo on"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	scriptsData, _ := json.MarshalIndent([]Script{{ID: 1, File: "lights.js"}}, "", "\t")
+	if err := os.WriteFile(filepath.Join(tmpDir, "scripts.json"), scriptsData, 0644); err != nil {
+		t.Fatalf("Failed to create scripts.json: %v", err)
+	}
+
+	client, token := newClient("tablet")
+	if err := addClient(client); err != nil {
+		t.Fatalf("Failed to add client: %v", err)
+	}
+
+	app := fiber.New()
+	registerAPIRoutes(app)
+
+	req := httptest.NewRequest("POST", "/api/v1/scripts/1/run", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if _, err := app.Test(req); err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	req = httptest.NewRequest("GET", "/api/v1/scripts", nil)
+	req.Header.Set("Authorization", "Bearer forged")
+	if _, err := app.Test(req); err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+
+	runs := readAudit(auditFilter(AuditRun, ""))
+	if len(runs) != 1 || runs[0].ClientID != client.ID || runs[0].Script != "lights" || runs[0].IP == "" {
+		t.Errorf("Expected run by the tablet with its IP, got %+v", runs)
+	}
+	if failures := readAudit(auditFilter(AuditAuthFailed, "")); len(failures) != 1 {
+		t.Errorf("Expected one failed authentication, got %+v", failures)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+// getAPIKey returns the key remote clients send to manage tasks. A key is
+// generated the first time it is needed.
+var getAPIKey = func() string {
+	key := settings.String("api_key")
+	if key == "" {
+		key = regenerateAPIKey()
+	}
+	return key
+}
+
+// regenerateAPIKey replaces the API key, invalidating the old one
+func regenerateAPIKey() string {
+	key := generateToken(32)
+	settings.SetString("api_key", key)
+	return key
+}
+
+// bearerToken returns the token of a "Bearer" Authorization header.
+// Browsers cannot set headers on WebSockets, so upgrade requests may pass
+// the token in the access_token query parameter instead.
+func bearerToken(c *fiber.Ctx) string {
+	token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !ok {
+		if websocket.IsWebSocketUpgrade(c) {
+			return c.Query("access_token")
+		}
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// isAPIKey reports whether token is the owner's API key
+func isAPIKey(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(getAPIKey())) == 1
+}
+
+// requireAuth rejects requests that carry neither the API key nor the
+// credentials of a paired client: a certificate in mTLS mode and a token
+// otherwise. The client is stored in the request locals. Requests over the
+// Unix socket are trusted like the API key.
+func requireAuth(c *fiber.Ctx) error {
+	token := bearerToken(c)
+	if isAPIKey(token) || fromUnixSocket(c) {
+		return c.Next()
+	}
+	if authMode() == AuthMTLS {
+		client, ok := clientFromCertificate(c)
+		if !ok {
+			if state := c.Context().TLSConnectionState(); state != nil && len(state.PeerCertificates) > 0 {
+				recordAuthFailure(c, "certificate does not belong to a paired client")
+			}
+			return fiber.NewError(fiber.StatusUnauthorized, "a client certificate issued on pairing is required")
+		}
+		c.Locals("client", client)
+		return c.Next()
+	}
+	if token == "" {
+		return fiber.NewError(fiber.StatusUnauthorized, "pair this client with the server first")
+	}
+	client, ok := authenticateClient(token)
+	if !ok {
+		recordAuthFailure(c, "unknown token")
+		return fiber.NewError(fiber.StatusUnauthorized, "pair this client with the server first")
+	}
+	c.Locals("client", client)
+	return c.Next()
+}
+
+// recordAuthFailure audits a request with invalid credentials. Requests
+// without any credentials are not recorded, they are usually clients that
+// have not been paired yet.
+func recordAuthFailure(c *fiber.Ctx, detail string) {
+	entry := auditRequest(c, AuditAuthFailed)
+	entry.Client, entry.Detail = "", detail+" for "+c.Method()+" "+c.Path()
+	recordAudit(entry)
+}
+
+// requireAPIKey rejects requests that do not carry the API key, unless
+// they came in over the Unix socket
+func requireAPIKey(c *fiber.Ctx) error {
+	if !isAPIKey(bearerToken(c)) && !fromUnixSocket(c) {
+		recordAuthFailure(c, "invalid API key")
+		return fiber.NewError(fiber.StatusUnauthorized, "invalid API key")
+	}
+	return c.Next()
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// pairingTTL is how long a pairing PIN stays valid
+	pairingTTL = 2 * time.Minute
+	// maxPairingAttempts is the number of wrong PINs after which the
+	// current PIN is discarded
+	maxPairingAttempts = 5
+	// lastSeenInterval limits how often a client's last seen time is saved
+	lastSeenInterval = time.Minute
+)
+
+var clientsMu sync.Mutex
+
+// clientsVersion counts the changes to clients.json, so that long lived
+// connections only read their client again after it may have changed
+var clientsVersion atomic.Uint64
+
+// Client is a device paired with the server. Only a hash of its token is
+// stored.
+type Client struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	TokenHash string    `json:"tokenHash"`
+	Paired    time.Time `json:"paired"`
+	LastSeen  time.Time `json:"lastSeen,omitempty"`
+	// CertSerial is the serial number of the client certificate issued in
+	// mTLS mode
+	CertSerial string `json:"certSerial,omitempty"`
+	// Restricted clients can only access the listed scripts and scripts
+	// with one of the listed tags
+	Restricted bool     `json:"restricted,omitempty"`
+	Scripts    []int    `json:"scripts,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+}
+
+// pairRequest is the body of the pairing endpoint. CSR is a PEM encoded
+// certificate request, it is required in mTLS mode.
+type pairRequest struct {
+	PIN  string `json:"pin"`
+	Name string `json:"name"`
+	CSR  string `json:"csr,omitempty"`
+}
+
+// pairResponse is returned to a client that paired successfully. In mTLS
+// mode no token is issued, the client authenticates with Certificate.
+type pairResponse struct {
+	ClientID    string `json:"clientId"`
+	Token       string `json:"token,omitempty"`
+	Certificate string `json:"certificate,omitempty"`
+}
+
+// pairingResponse is returned when pairing is started over the API
+type pairingResponse struct {
+	PIN     string    `json:"pin"`
+	Expires time.Time `json:"expires"`
+}
+
+// pairingState holds the PIN currently shown in the server GUI
+var pairingState struct {
+	sync.Mutex
+	pin      string
+	expires  time.Time
+	attempts int
+}
+
+func clientsFile() string {
+	return filepath.Join(getDataPath(), "clients.json")
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// getClients returns all paired clients
+func getClients() []Client {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	return readClients()
+}
+
+func readClients() []Client {
+	var clients []Client
+	data, err := os.ReadFile(clientsFile())
+	if err != nil {
+		return clients
+	}
+	if err := json.Unmarshal(data, &clients); err != nil {
+		fmt.Println("Failed to parse clients.json:", err)
+	}
+	return clients
+}
+
+func writeClients(clients []Client) error {
+	data, err := json.MarshalIndent(clients, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to marshal clients: %w", err)
+	}
+	if err := os.MkdirAll(getDataPath(), 0755); err != nil {
+		return err
+	}
+	// Token hashes are not secret but there is no reason to share them
+	if err := os.WriteFile(clientsFile(), data, 0600); err != nil {
+		return fmt.Errorf("failed to write clients.json: %w", err)
+	}
+	clientsVersion.Add(1)
+	return nil
+}
+
+// findClient looks up a paired client by ID
+func findClient(id string) (Client, bool) {
+	clients := getClients()
+	idx := slices.IndexFunc(clients, func(c Client) bool { return c.ID == id })
+	if idx < 0 {
+		return Client{}, false
+	}
+	return clients[idx], true
+}
+
+// newClient creates a client with a fresh token, it is not saved yet
+func newClient(name string) (Client, string) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "Unnamed client"
+	}
+	token := generateToken(32)
+	return Client{
+		ID:        generateToken(8),
+		Name:      name,
+		TokenHash: hashToken(token),
+		Paired:    time.Now(),
+	}, token
+}
+
+// addClient saves a newly paired client
+func addClient(client Client) error {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	return writeClients(append(readClients(), client))
+}
+
+// revokeClient removes a client, its token stops working immediately
+func revokeClient(id string) error {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	clients := readClients()
+	n := len(clients)
+	clients = slices.DeleteFunc(clients, func(c Client) bool { return c.ID == id })
+	if len(clients) == n {
+		return fmt.Errorf("client %q does not exist", id)
+	}
+	return writeClients(clients)
+}
+
+// authenticateClient returns the client a token belongs to and records
+// that it was seen
+func authenticateClient(token string) (Client, bool) {
+	hash := hashToken(token)
+	return seenClient(func(c Client) bool {
+		return subtle.ConstantTimeCompare([]byte(c.TokenHash), []byte(hash)) == 1
+	})
+}
+
+// seenClient returns the first client matching match and records that it
+// was seen
+func seenClient(match func(Client) bool) (Client, bool) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	clients := readClients()
+	for i, c := range clients {
+		if !match(c) {
+			continue
+		}
+		if time.Since(c.LastSeen) > lastSeenInterval {
+			clients[i].LastSeen = time.Now()
+			writeClients(clients)
+		}
+		return clients[i], true
+	}
+	return Client{}, false
+}
+
+// startPairing creates a new PIN, replacing any previous one, and returns
+// it with the time it expires
+func startPairing() (string, time.Time) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		panic(fmt.Sprintf("failed to read random bytes: %s", err))
+	}
+
+	pairingState.Lock()
+	defer pairingState.Unlock()
+	pairingState.pin = fmt.Sprintf("%06d", n.Int64())
+	pairingState.expires = time.Now().Add(pairingTTL)
+	pairingState.attempts = 0
+	return pairingState.pin, pairingState.expires
+}
+
+// stopPairing discards the current PIN
+func stopPairing() {
+	pairingState.Lock()
+	defer pairingState.Unlock()
+	pairingState.pin = ""
+}
+
+// consumePIN checks a PIN. A PIN can only be used once and is discarded
+// after too many wrong guesses.
+func consumePIN(pin string) error {
+	pairingState.Lock()
+	defer pairingState.Unlock()
+
+	if pairingState.pin == "" || time.Now().After(pairingState.expires) {
+		return errors.New("no pairing in progress, start pairing on the server")
+	}
+	if subtle.ConstantTimeCompare([]byte(pin), []byte(pairingState.pin)) != 1 {
+		pairingState.attempts++
+		if pairingState.attempts >= maxPairingAttempts {
+			pairingState.pin = ""
+		}
+		return errors.New("wrong PIN")
+	}
+	pairingState.pin = ""
+	return nil
+}
+
+// apiStartPairing creates a pairing PIN. Headless servers have no GUI to
+// show one, so the owner can request it with the API key.
+func apiStartPairing(c *fiber.Ctx) error {
+	pin, expires := startPairing()
+	return c.Status(fiber.StatusCreated).JSON(pairingResponse{PIN: pin, Expires: expires})
+}
+
+// apiPair exchanges a pairing PIN for a client token, or a client
+// certificate in mTLS mode. The request is checked before the PIN is used
+// up, so a bad csr does not cost the user their PIN. Certificate requests
+// are ignored in token mode.
+func apiPair(c *fiber.Ctx) error {
+	var req pairRequest
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return badRequest(fmt.Errorf("invalid request: %w", err))
+	}
+	mtls := authMode() == AuthMTLS
+	var csr *x509.CertificateRequest
+	if mtls {
+		if req.CSR == "" {
+			return badRequest(errors.New("the server requires client certificates, a csr is required"))
+		}
+		var err error
+		if csr, err = parseClientCSR(req.CSR); err != nil {
+			return badRequest(err)
+		}
+	}
+	if err := consumePIN(strings.TrimSpace(req.PIN)); err != nil {
+		entry := auditRequest(c, AuditPairFailed)
+		entry.Client, entry.Detail = req.Name, err.Error()
+		recordAudit(entry)
+		return fiber.NewError(fiber.StatusForbidden, err.Error())
+	}
+
+	client, token := newClient(req.Name)
+	resp := pairResponse{ClientID: client.ID, Token: token}
+	if mtls {
+		cert, certPEM, err := signClientCSR(csr, client.ID)
+		if err != nil {
+			return fmt.Errorf("failed to issue client certificate: %w", err)
+		}
+		client.CertSerial = cert.SerialNumber.String()
+		resp.Certificate = string(certPEM)
+		// Clients in mTLS mode authenticate with their certificate only
+		client.TokenHash = ""
+		resp.Token = ""
+	}
+
+	if err := addClient(client); err != nil {
+		return err
+	}
+	entry := auditRequest(c, AuditPair)
+	entry.ClientID, entry.Client = client.ID, client.Name
+	if resp.Certificate != "" {
+		entry.Detail = "issued client certificate"
+	}
+	recordAudit(entry)
+	return c.Status(fiber.StatusCreated).JSON(resp)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestConsumePIN(t *testing.T) {
+	pin, _ := startPairing()
+	defer stopPairing()
+
+	if err := consumePIN(pin); err != nil {
+		t.Fatalf("Expected PIN to be accepted, got %v", err)
+	}
+	if err := consumePIN(pin); err == nil {
+		t.Error("Expected PIN to be single use")
+	}
+
+	// Too many wrong guesses discard the PIN
+	pin, _ = startPairing()
+	for range maxPairingAttempts {
+		consumePIN("not-a-pin")
+	}
+	if err := consumePIN(pin); err == nil {
+		t.Error("Expected PIN to be discarded after wrong guesses")
+	}
+}
+
+func TestStartPairingAPI(t *testing.T) {
+	originalKey := getAPIKey
+	getAPIKey = func() string { return "test-key" }
+	defer func() { getAPIKey = originalKey }()
+	defer stopPairing()
+
+	app := fiber.New()
+	registerAPIRoutes(app)
+
+	client, token := newClient("tablet")
+	if err := addClient(client); err != nil {
+		t.Fatalf("Failed to add client: %v", err)
+	}
+	defer revokeClient(client.ID)
+
+	start := func(key string) *http.Response {
+		req := httptest.NewRequest("POST", "/api/v1/pairing", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		return resp
+	}
+
+	if resp := start(token); resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("Expected paired clients to be refused, got %d", resp.StatusCode)
+	}
+
+	resp := start("test-key")
+	if resp.StatusCode != fiber.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+	var pairing pairingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&pairing); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if err := consumePIN(pairing.PIN); err != nil {
+		t.Errorf("Expected returned PIN to be valid: %v", err)
+	}
+}
+
+func TestPairing(t *testing.T) {
+	// Setup test directory
+	tmpDir := t.TempDir()
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+	originalDataPath := getDataPath
+	getDataPath = func() string { return tmpDir }
+	defer func() { getDataPath = originalDataPath }()
+
+	scriptsData, _ := json.MarshalIndent([]Script{{ID: 1, File: "test.js"}}, "", "\t")
+	if err := os.WriteFile(filepath.Join(tmpDir, "scripts.json"), scriptsData, 0644); err != nil {
+		t.Fatalf("Failed to create scripts.json: %v", err)
+	}
+
+	app := fiber.New()
+	registerAPIRoutes(app)
+
+	pair := func(pin string) (int, pairResponse) {
+		body := `{"pin":"` + pin + `","name":"Kitchen tablet"}`
+		resp, err := app.Test(httptest.NewRequest("POST", "/api/v1/pair", strings.NewReader(body)))
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		var paired pairResponse
+		json.NewDecoder(resp.Body).Decode(&paired)
+		return resp.StatusCode, paired
+	}
+	list := func(token string) int {
+		req := httptest.NewRequest("GET", "/api/v1/scripts", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	if status, _ := pair("123456"); status != fiber.StatusForbidden {
+		t.Errorf("Expected status 403 without pairing in progress, got %d", status)
+	}
+
+	pin, _ := startPairing()
+	defer stopPairing()
+	status, paired := pair(pin)
+	if status != fiber.StatusCreated || paired.Token == "" {
+		t.Fatalf("Expected pairing to succeed, got status %d", status)
+	}
+
+	if status := list(paired.Token); status != fiber.StatusOK {
+		t.Errorf("Expected paired client to be accepted, got %d", status)
+	}
+	if status := list("forged"); status != fiber.StatusUnauthorized {
+		t.Errorf("Expected unknown token to be rejected, got %d", status)
+	}
+
+	clients := getClients()
+	if len(clients) != 1 || clients[0].Name != "Kitchen tablet" || clients[0].LastSeen.IsZero() {
+		t.Fatalf("Unexpected clients %+v", clients)
+	}
+	if strings.Contains(clients[0].TokenHash, paired.Token) {
+		t.Error("Expected token to be stored hashed")
+	}
+
+	if err := revokeClient(paired.ClientID); err != nil {
+		t.Fatalf("Failed to revoke client: %v", err)
+	}
+	if status := list(paired.Token); status != fiber.StatusUnauthorized {
+		t.Errorf("Expected revoked client to be rejected, got %d", status)
+	}
+
+	// Certificate requests are ignored in token mode, no CA is created
+	pin, _ = startPairing()
+	csr, _ := newTestCSR(t)
+	body, _ := json.Marshal(map[string]string{"pin": pin, "name": "Laptop", "csr": csr})
+	resp, err := app.Test(httptest.NewRequest("POST", "/api/v1/pair", bytes.NewReader(body)))
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	json.NewDecoder(resp.Body).Decode(&paired)
+	if resp.StatusCode != fiber.StatusCreated || paired.Token == "" || paired.Certificate != "" {
+		t.Errorf("Expected a token and no certificate in token mode, got status %d", resp.StatusCode)
+	}
+	if _, err := os.Stat(filepath.Join(getTLSPath(), "ca.pem")); !os.IsNotExist(err) {
+		t.Error("Expected no CA to be created in token mode")
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Event types pushed to clients over the events WebSocket
+const (
+	EventScriptAdded   = "script.added"
+	EventScriptRemoved = "script.removed"
+	EventScriptUpdated = "script.updated"
+	EventButtonState   = "button.state"
+	EventRunStarted    = "run.started"
+	EventRunFinished   = "run.finished"
+	// EventProfileSwitched is sent to every client, it is about no task
+	EventProfileSwitched = "profile.switched"
+)
+
+// Button states sent with button.state events
+const (
+	ButtonIdle    = "idle"
+	ButtonRunning = "running"
+)
+
+// eventBuffer is the number of events queued for a subscriber. Subscribers
+// that fall further behind are disconnected and have to reload.
+const eventBuffer = 64
+
+// Event is a change pushed to clients
+type Event struct {
+	Type     string     `json:"type"`
+	Time     time.Time  `json:"time"`
+	ScriptID int        `json:"scriptId"`
+	Script   *APIScript `json:"script,omitempty"`
+	State    string     `json:"state,omitempty"`
+	Run      *RunResult `json:"run,omitempty"`
+	// Profile is the profile switched to, empty if none is active
+	Profile string `json:"profile,omitempty"`
+
+	// task and previous are the task before and after the change, used to
+	// filter events by client permissions
+	task     Script
+	previous *Script
+}
+
+var (
+	eventsMu    sync.Mutex
+	subscribers = map[chan Event]struct{}{}
+	// connectedClients counts the WebSocket connections among the
+	// subscribers, the MQTT bridge subscribes too
+	connectedClients atomic.Int64
+)
+
+// subscribe returns a channel receiving all published events. The channel
+// is closed by unsubscribe, or when the subscriber falls behind.
+func subscribe() chan Event {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	ch := make(chan Event, eventBuffer)
+	subscribers[ch] = struct{}{}
+	return ch
+}
+
+func unsubscribe(ch chan Event) {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	if _, ok := subscribers[ch]; ok {
+		delete(subscribers, ch)
+		close(ch)
+	}
+}
+
+// publishEvent sends an event to every subscriber without blocking
+func publishEvent(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	for ch := range subscribers {
+		select {
+		case ch <- e:
+		default:
+			delete(subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// publishScriptChanges compares two versions of scripts.json and publishes
+// an event for every task that was added, removed or changed
+func publishScriptChanges(before, after []Script) {
+	slugs := assignSlugs(after)
+	for _, s := range after {
+		apiScript := toAPIScript(s, slugs[s.ID])
+		old, ok := findScriptByID(before, s.ID)
+		switch {
+		case !ok:
+			publishEvent(Event{Type: EventScriptAdded, ScriptID: s.ID, Script: &apiScript, task: s})
+		case !reflect.DeepEqual(old, s):
+			publishEvent(Event{Type: EventScriptUpdated, ScriptID: s.ID, Script: &apiScript, task: s, previous: &old})
+		}
+	}
+	for _, s := range before {
+		if _, ok := findScriptByID(after, s.ID); !ok {
+			publishEvent(Event{Type: EventScriptRemoved, ScriptID: s.ID, task: s})
+		}
+	}
+}
+
+// publishRun publishes that a run started or finished
+func publishRun(eventType string, script Script, result RunResult) {
+	publishEvent(Event{Type: eventType, ScriptID: script.ID, Run: &result, task: script})
+}
+
+// publishButtonState publishes whether a task's button has a run in progress
+func publishButtonState(script Script, state string) {
+	publishEvent(Event{Type: EventButtonState, ScriptID: script.ID, State: state, task: script})
+}
+
+// eventFor returns the event as seen by a client that may access the tasks
+// canAccess accepts. Tasks gained or lost through an update are reported as
+// added or removed.
+func eventFor(e Event, canAccess func(Script) bool) (Event, bool) {
+	if e.Type == EventProfileSwitched {
+		return e, true
+	}
+	if e.Type != EventScriptUpdated {
+		return e, canAccess(e.task)
+	}
+
+	before, after := canAccess(*e.previous), canAccess(e.task)
+	switch {
+	case before && after:
+		return e, true
+	case after:
+		e.Type = EventScriptAdded
+		return e, true
+	case before:
+		e.Type = EventScriptRemoved
+		e.Script = nil
+		return e, true
+	}
+	return e, false
+}
+
+// apiEvents upgrades to a WebSocket that streams events as JSON messages.
+// Clients only receive events about tasks they may access, and are
+// disconnected once revoked.
+func apiEvents(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return fiber.ErrUpgradeRequired
+	}
+	client, paired := requestClient(c)
+
+	return websocket.New(func(conn *websocket.Conn) {
+		events := subscribe()
+		defer unsubscribe(events)
+		connectedClients.Add(1)
+		defer connectedClients.Add(-1)
+
+		// The client is read again only once clients.json changed, as it
+		// may have been revoked or had its permissions changed
+		version := clientsVersion.Load()
+		if paired {
+			var ok bool
+			if client, ok = findClient(client.ID); !ok {
+				return
+			}
+		}
+
+		// Reading notices the client closing the connection
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		for {
+			select {
+			case <-closed:
+				return
+			case e, ok := <-events:
+				if !ok {
+					return
+				}
+				canAccess := func(Script) bool { return true }
+				if paired {
+					if v := clientsVersion.Load(); v != version {
+						version = v
+						if client, ok = findClient(client.ID); !ok {
+							return
+						}
+					}
+					canAccess = client.CanAccess
+				}
+				e, ok = eventFor(e, canAccess)
+				if !ok {
+					continue
+				}
+				if err := conn.WriteJSON(e); err != nil {
+					fmt.Println("Failed to send event:", err)
+					return
+				}
+			}
+		}
+	})(c)
+}
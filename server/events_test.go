@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+// receiveEvents collects n events from a subscription
+func receiveEvents(t *testing.T, events chan Event, n int) []Event {
+	t.Helper()
+	var out []Event
+	for len(out) < n {
+		select {
+		case e := <-events:
+			out = append(out, e)
+		case <-time.After(time.Second):
+			t.Fatalf("Expected %d events, got %d", n, len(out))
+		}
+	}
+	return out
+}
+
+// waitSubscribers waits until n clients listen for events
+func waitSubscribers(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for subscriberCount() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d subscribers, got %d", n, subscriberCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPublishScriptChanges(t *testing.T) {
+	// Setup test directory
+	tmpDir := t.TempDir()
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+
+	if err := writeScriptsJson([]Script{{ID: 1, File: "a.js"}, {ID: 2, File: "b.js"}}); err != nil {
+		t.Fatalf("Failed to write scripts.json: %v", err)
+	}
+
+	events := subscribe()
+	defer unsubscribe(events)
+
+	if err := writeScriptsJson([]Script{{ID: 1, File: "a.js", Title: "Lights"}, {ID: 3, File: "c.js"}}); err != nil {
+		t.Fatalf("Failed to write scripts.json: %v", err)
+	}
+
+	want := []struct {
+		eventType string
+		id        int
+	}{
+		{EventScriptUpdated, 1},
+		{EventScriptAdded, 3},
+		{EventScriptRemoved, 2},
+	}
+	got := receiveEvents(t, events, len(want))
+	for i, w := range want {
+		if got[i].Type != w.eventType || got[i].ScriptID != w.id {
+			t.Errorf("Event %d: expected %s for %d, got %s for %d", i, w.eventType, w.id, got[i].Type, got[i].ScriptID)
+		}
+	}
+	if got[0].Script == nil || got[0].Script.Title != "Lights" {
+		t.Errorf("Expected updated task in event, got %+v", got[0].Script)
+	}
+}
+
+func TestEventFor(t *testing.T) {
+	client := Client{Restricted: true, Tags: []string{"media"}}
+	media := Script{ID: 1, File: "play.js", Tags: []string{"media"}}
+	other := Script{ID: 1, File: "play.js"}
+
+	testCases := []struct {
+		name     string
+		event    Event
+		wantType string
+		wantSent bool
+	}{
+		{"accessible run", Event{Type: EventRunStarted, task: media}, EventRunStarted, true},
+		{"inaccessible run", Event{Type: EventRunStarted, task: other}, "", false},
+		{"tag added", Event{Type: EventScriptUpdated, task: media, previous: &other}, EventScriptAdded, true},
+		{"tag removed", Event{Type: EventScriptUpdated, task: other, previous: &media}, EventScriptRemoved, true},
+		{"still inaccessible", Event{Type: EventScriptUpdated, task: other, previous: &other}, "", false},
+		{"profile switched", Event{Type: EventProfileSwitched, Profile: "media"}, EventProfileSwitched, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e, sent := eventFor(tc.event, client.CanAccess)
+			if sent != tc.wantSent || (sent && e.Type != tc.wantType) {
+				t.Errorf("Expected %q sent=%v, got %q sent=%v", tc.wantType, tc.wantSent, e.Type, sent)
+			}
+		})
+	}
+}
+
+func TestEventsWebSocket(t *testing.T) {
+	// Setup test directory
+	tmpDir := t.TempDir()
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+	originalDataPath := getDataPath
+	getDataPath = func() string { return tmpDir }
+	defer func() { getDataPath = originalDataPath }()
+
+	// Run scripts with sh so the test does not depend on bun
+	originalRuntime := scriptRuntime
+	scriptRuntime = []string{"sh"}
+	defer func() { scriptRuntime = originalRuntime }()
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "lights.js"), []byte("echo on"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	scriptsData, _ := json.MarshalIndent([]Script{{ID: 1, File: "lights.js"}}, "", "\t")
+	if err := os.WriteFile(filepath.Join(tmpDir, "scripts.json"), scriptsData, 0644); err != nil {
+		t.Fatalf("Failed to create scripts.json: %v", err)
+	}
+
+	client, token := newClient("tablet")
+	if err := addClient(client); err != nil {
+		t.Fatalf("Failed to add client: %v", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	registerAPIRoutes(app)
+	go app.Listener(ln)
+	defer app.Shutdown()
+	eventsURL := "ws://" + ln.Addr().String() + "/api/v1/events"
+
+	if _, resp, err := websocket.DefaultDialer.Dial(eventsURL, nil); err == nil || resp.StatusCode != fiber.StatusUnauthorized {
+		t.Fatalf("Expected connecting without a token to fail with 401, got %v", err)
+	}
+
+	// Browsers pass the token in the query
+	browser, _, err := websocket.DefaultDialer.Dial(eventsURL+"?access_token="+token, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect with token in query: %v", err)
+	}
+	browser.Close()
+	waitSubscribers(t, 0)
+
+	header := http.Header{"Authorization": {"Bearer " + token}}
+	conn, _, err := websocket.DefaultDialer.Dial(eventsURL, header)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	// Wait for the connection to subscribe before running
+	waitSubscribers(t, 1)
+
+	script, _ := findScriptByID(getScripts(), 1)
+	if _, err := runScript(script, RunOptions{Trigger: TriggerSchedule}); err != nil {
+		t.Fatalf("Failed to run script: %v", err)
+	}
+
+	want := []string{EventButtonState, EventRunStarted, EventRunFinished, EventButtonState}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for i, w := range want {
+		var e Event
+		if err := conn.ReadJSON(&e); err != nil {
+			t.Fatalf("Failed to read event %d: %v", i, err)
+		}
+		if e.Type != w || e.ScriptID != 1 {
+			t.Errorf("Event %d: expected %s for task 1, got %s for %d", i, w, e.Type, e.ScriptID)
+		}
+		if e.Type == EventRunFinished && (e.Run == nil || e.Run.Stdout != "on") {
+			t.Errorf("Expected run result in event, got %+v", e.Run)
+		}
+	}
+
+	// Permission changes apply to the open connection. The run while the
+	// client may not access the task sends nothing.
+	if err := setClientPermissions(client.ID, true, nil, nil); err != nil {
+		t.Fatalf("Failed to restrict client: %v", err)
+	}
+	runScript(script, RunOptions{Trigger: TriggerSchedule})
+	if err := setClientPermissions(client.ID, false, nil, nil); err != nil {
+		t.Fatalf("Failed to unrestrict client: %v", err)
+	}
+	runScript(script, RunOptions{Trigger: TriggerWebhook})
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for range want {
+		var e Event
+		if err := conn.ReadJSON(&e); err != nil {
+			t.Fatalf("Failed to read event: %v", err)
+		}
+		if e.Type == EventRunStarted && e.Run.Trigger != TriggerWebhook {
+			t.Errorf("Expected only the run after the restriction was lifted, got a %s run", e.Run.Trigger)
+		}
+	}
+
+	// Revoked clients are disconnected on the next event
+	if err := revokeClient(client.ID); err != nil {
+		t.Fatalf("Failed to revoke client: %v", err)
+	}
+	runScript(script, RunOptions{Trigger: TriggerSchedule})
+	waitSubscribers(t, 0)
+}
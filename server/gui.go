@@ -0,0 +1,544 @@
+//go:build !headless
+
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/app"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/data/binding"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// headlessOnly is set in builds without the GUI
+const headlessOnly = false
+
+//go:embed Icon.png
+var logo []byte
+
+type GUI struct {
+	window           fyne.Window
+	app              fyne.App
+	scriptsTab       *container.TabItem
+	scheduleTab      *container.TabItem
+	historyTab       *container.TabItem
+	notificationsTab *container.TabItem
+	clientsTab       *container.TabItem
+	auditTab         *container.TabItem
+	preferencesTab   *container.TabItem
+	tabs             *container.AppTabs
+	preferences      fyne.Preferences
+}
+
+// NewGUI creates the app and keeps the server settings in its preferences
+func NewGUI(overrides map[string]string) *GUI {
+	gui := &GUI{
+		app:         app.NewWithID("dev.ibanks.opendesk-server"),
+		preferences: fyne.CurrentApp().Preferences(),
+	}
+	settings = withOverrides(gui.preferences, overrides)
+	gui.window = gui.app.NewWindow("OpenDesk Server")
+	return gui
+}
+
+func (g *GUI) Initialize() {
+	g.app.Settings().SetTheme(theme.DarkTheme())
+	g.window.Resize(fyne.Size{Width: 600, Height: 400})
+
+	g.setupSystemTray()
+	g.buildGUI()
+	g.setupCloseHandler()
+}
+
+func (g *GUI) Run() {
+	if g.preferences.Bool("minimized") {
+		g.app.Run()
+	} else {
+		g.window.ShowAndRun()
+	}
+}
+
+func (g *GUI) setupSystemTray() {
+	if desk, ok := g.app.(desktop.App); ok {
+		menu := fyne.NewMenu("OpenDesk Server",
+			fyne.NewMenuItem("Show", func() {
+				g.window.Show()
+			}))
+
+		desk.SetSystemTrayMenu(menu)
+		desk.SetSystemTrayIcon(fyne.NewStaticResource("logo", logo))
+	}
+}
+
+func (g *GUI) setupCloseHandler() {
+	g.window.SetCloseIntercept(func() {
+		g.window.Hide()
+	})
+}
+
+func (g *GUI) buildGUI() {
+	g.scriptsTab = container.NewTabItem("Builtin Tasks", container.NewVBox())
+	g.scheduleTab = container.NewTabItem("Schedule", container.NewVBox())
+	g.historyTab = container.NewTabItem("History", container.NewVBox())
+	g.notificationsTab = container.NewTabItem("Notifications", container.NewVBox())
+	g.clientsTab = container.NewTabItem("Clients", container.NewVBox())
+	g.auditTab = container.NewTabItem("Audit", container.NewVBox())
+	g.preferencesTab = container.NewTabItem("Settings", container.NewVBox())
+
+	g.tabs = container.NewAppTabs(g.scriptsTab, g.scheduleTab, g.historyTab, g.notificationsTab, g.clientsTab, g.auditTab, g.preferencesTab)
+	g.tabs.SetTabLocation(container.TabLocationLeading)
+
+	g.tabs.OnSelected = func(tab *container.TabItem) {
+		g.refreshGUI(g.tabs.SelectedIndex())
+	}
+
+	g.setupMainMenu()
+	g.refreshGUI(0)
+	g.window.SetContent(g.tabs)
+}
+
+func (g *GUI) setupMainMenu() {
+	menu := fyne.NewMainMenu(
+		fyne.NewMenu("File",
+			fyne.NewMenuItem("Refresh", g.buildGUI),
+			fyne.NewMenuItem("New Task", g.showNewTaskDialog),
+			fyne.NewMenuItem("New Macro", g.showNewMacroDialog)))
+	g.window.SetMainMenu(menu)
+}
+
+func (g *GUI) showNewTaskDialog() {
+	idEntry := widget.NewEntry()
+	titleEntry := widget.NewEntry()
+	command := widget.NewMultiLineEntry()
+	idEntry.SetText(strconv.Itoa(getMaxScriptId() + 1))
+
+	params := map[string]string{}
+	form := widget.NewForm()
+	templateSelect := widget.NewSelect(taskTemplateLabels(), func(label string) {
+		clear(params)
+		items := []*widget.FormItem{
+			widget.NewFormItem("ID", idEntry),
+			widget.NewFormItem("Name", titleEntry),
+		}
+		switch name := taskTemplate(label); name {
+		case TypeScript:
+			items = append(items, widget.NewFormItem("Script", command))
+		case TypeMacro:
+		default:
+			items = append(items, newActionParamItems(actions[name], params)...)
+		}
+		form.Items = items
+		form.Refresh()
+	})
+	templateSelect.SetSelectedIndex(0)
+
+	content := container.NewVBox(widget.NewForm(widget.NewFormItem("Template", templateSelect)), form)
+	d := dialog.NewCustomConfirm("New Task", "Confirm", "Cancel", content,
+		func(confirmed bool) {
+			if !confirmed {
+				return
+			}
+			switch name := taskTemplate(templateSelect.Selected); name {
+			case TypeScript:
+				g.handleNewTask(idEntry.Text, titleEntry.Text, command.Text)
+			case TypeMacro:
+				g.handleNewMacro(idEntry.Text, titleEntry.Text)
+			default:
+				g.handleNewAction(idEntry.Text, titleEntry.Text, name, params)
+			}
+		}, g.window)
+	d.Resize(fyne.NewSize(480, 0))
+	d.Show()
+}
+
+func (g *GUI) handleNewTask(idText, title, command string) {
+	id, err := strconv.Atoi(idText)
+	if err != nil {
+		fmt.Println("Failed to create script: ID is not a number")
+		return
+	}
+
+	if err := writeScript(id, title+".ts", command); err != nil {
+		fmt.Println("Failed to create script:", err.Error())
+		return
+	}
+	auditGUI(AuditCreate, Script{ID: id, File: title + ".ts"})
+
+	reloadSchedules()
+	g.refreshGUI(0)
+}
+
+func (g *GUI) refreshGUI(tabIndex int) {
+	g.buildScriptsTab()
+	g.buildScheduleTab()
+	g.buildHistoryTab()
+	g.buildNotificationsTab()
+	g.buildClientsTab()
+	g.buildAuditTab()
+	g.buildPreferencesTab()
+	g.tabs.SelectIndex(tabIndex)
+}
+
+func (g *GUI) buildScriptsTab() {
+	scripts := getScripts()
+	sort.Slice(scripts, func(i, j int) bool {
+		return scripts[i].ID < scripts[j].ID
+	})
+
+	listmap := binding.NewUntypedList()
+	for _, script := range scripts {
+		listmap.Append(script)
+	}
+
+	list := widget.NewListWithData(listmap,
+		g.createScriptListItem,
+		g.updateScriptListItem)
+
+	scroll := container.NewScroll(list)
+	padded := layout.NewCustomPaddedLayout(0, 0, 16, 0)
+	g.scriptsTab.Content = container.New(padded, scroll)
+}
+
+func (g *GUI) createScriptListItem() fyne.CanvasObject {
+	return container.NewHBox(
+		widget.NewLabel(""),
+		layout.NewSpacer(),
+		container.NewGridWithColumns(2,
+			widget.NewButtonWithIcon("", theme.SettingsIcon(), func() {}),
+			widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {}),
+		))
+}
+
+func (g *GUI) updateScriptListItem(dataItem binding.DataItem, canvasObject fyne.CanvasObject) {
+	untyped, _ := dataItem.(binding.Untyped).Get()
+	script := untyped.(Script)
+	objects := canvasObject.(*fyne.Container).Objects
+	objects[0].(*widget.Label).SetText(script.Name())
+
+	editBtn := objects[2].(*fyne.Container).Objects[0].(*widget.Button)
+	editBtn.OnTapped = func() {
+		switch script.Type {
+		case TypeMacro:
+			g.showMacroDialog(script, false)
+		case TypeAction:
+			g.showActionDialog(script)
+		default:
+			g.showEditTaskDialog(script)
+		}
+	}
+
+	deleteBtn := objects[2].(*fyne.Container).Objects[1].(*widget.Button)
+	deleteBtn.OnTapped = func() {
+		message := fmt.Sprintf("Delete %s? This cannot be undone.", script.Name())
+		dialog.ShowConfirm("Delete Task", message, func(confirmed bool) {
+			if !confirmed {
+				return
+			}
+			if err := deleteScript(script.ID); err != nil {
+				dialog.ShowError(err, g.window)
+				return
+			}
+			auditGUI(AuditDelete, script)
+			reloadSchedules()
+			g.refreshGUI(0)
+		}, g.window)
+	}
+}
+
+func (g *GUI) showEditTaskDialog(script Script) {
+	taskData, err := readScript(script.File)
+	if err != nil {
+		return
+	}
+
+	idEntry := widget.NewEntry()
+	filenameEntry := widget.NewEntry()
+	commandEntry := widget.NewMultiLineEntry()
+	scheduleEntry := widget.NewMultiLineEntry()
+
+	idEntry.SetText(strconv.Itoa(script.ID))
+	filenameEntry.SetText(script.File)
+	commandEntry.SetText(taskData)
+	scheduleEntry.SetText(strings.Join(script.Schedules, "\n"))
+	scheduleEntry.SetPlaceHolder("One cron expression per line, e.g. 55 9 * * 1-5")
+	scheduleEntry.Validator = validateScheduleText
+	tagsEntry := newTagsEntry(script.Tags)
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("ID", idEntry),
+		widget.NewFormItem("Name", filenameEntry),
+		widget.NewFormItem("Script", commandEntry),
+		widget.NewFormItem("Test", g.newTestRunPanel(filepath.Ext(script.File), func() string { return commandEntry.Text })),
+		widget.NewFormItem("Schedule", scheduleEntry),
+		widget.NewFormItem("Tags", tagsEntry),
+		widget.NewFormItem("Webhook", g.newHookEditor(&script)),
+	}
+
+	dialog.NewForm("Edit Task", "Confirm", "Cancel", items,
+		func(confirmed bool) {
+			if confirmed {
+				script.Schedules = parseScheduleText(scheduleEntry.Text)
+				script.Tags = parseTags(tagsEntry.Text)
+				g.handleEditTask(script, idEntry.Text, commandEntry.Text)
+			}
+		}, g.window).Show()
+}
+
+func (g *GUI) handleEditTask(script Script, idText, command string) {
+	id, err := strconv.Atoi(idText)
+	if err != nil {
+		fmt.Println("Failed to update task: ID not a number")
+		return
+	}
+
+	if err := updateScript(script, id, command); err != nil {
+		fmt.Println("Failed to update custom task:", err.Error())
+		return
+	}
+	script.ID = id
+	auditGUI(AuditUpdate, script)
+
+	reloadSchedules()
+	g.refreshGUI(0)
+}
+
+func (g *GUI) buildPreferencesTab() {
+	minimized := g.preferences.Bool("minimized")
+	port := serverPort()
+
+	minimizedBinding := binding.BindBool(&minimized)
+	portBinding := binding.BindString(&port)
+
+	minimizedCheck := widget.NewCheckWithData("", minimizedBinding)
+	portInput := widget.NewEntryWithData(portBinding)
+
+	bindInput := widget.NewSelectEntry(append([]string{"127.0.0.1", "::1"}, localAddresses()...))
+	bindInput.SetText(bindAddress())
+	bindInput.SetPlaceHolder("All interfaces")
+	socketInput := widget.NewEntry()
+	socketInput.SetText(settings.String("unix_socket"))
+	socketInput.SetPlaceHolder("Off")
+	mdnsCheck := widget.NewCheck("", nil)
+	mdnsCheck.SetChecked(useMDNS())
+	socketItem := widget.NewFormItem("Unix Socket", socketInput)
+	socketItem.HintText = "Local tools connecting here have full access"
+
+	apiKeyLabel := widget.NewLabel(getAPIKey())
+	apiKeyLabel.TextStyle = fyne.TextStyle{Monospace: true}
+	apiKeyLabel.Truncation = fyne.TextTruncateEllipsis
+	copyKeyBtn := widget.NewButtonWithIcon("", theme.ContentCopyIcon(), func() {
+		g.window.Clipboard().SetContent(getAPIKey())
+	})
+	regenerateKeyBtn := widget.NewButtonWithIcon("", theme.ViewRefreshIcon(), func() {
+		dialog.ShowConfirm("Regenerate API Key", "Clients using the current key will lose access. Continue?", func(confirmed bool) {
+			if confirmed {
+				apiKeyLabel.SetText(regenerateAPIKey())
+			}
+		}, g.window)
+	})
+	apiKey := container.NewBorder(nil, nil, nil, container.NewHBox(copyKeyBtn, regenerateKeyBtn), apiKeyLabel)
+
+	httpsCheck := widget.NewCheck("", nil)
+	httpsCheck.SetChecked(useHTTPS())
+	certInput := widget.NewEntry()
+	certInput.SetText(settings.String("tls_cert"))
+	certInput.SetPlaceHolder("Generated self-signed certificate")
+	keyInput := widget.NewEntry()
+	keyInput.SetText(settings.String("tls_key"))
+	keyInput.SetPlaceHolder("Generated key")
+
+	authModes := map[string]string{AuthToken: "Token", AuthMTLS: "Client Certificate (mTLS)"}
+	authSelect := widget.NewSelect([]string{authModes[AuthToken], authModes[AuthMTLS]}, nil)
+	authSelect.SetSelected(authModes[authMode()])
+
+	fingerprintLabel := widget.NewLabel(currentFingerprint())
+	fingerprintLabel.TextStyle = fyne.TextStyle{Monospace: true}
+	fingerprintLabel.Wrapping = fyne.TextWrapBreak
+
+	mqttBrokerInput := widget.NewEntry()
+	mqttBrokerInput.SetText(mqttBroker())
+	mqttBrokerInput.SetPlaceHolder("Off, e.g. tcp://localhost:1883")
+	mqttUserInput := widget.NewEntry()
+	mqttUserInput.SetText(settings.String("mqtt_username"))
+	mqttPasswordInput := widget.NewPasswordEntry()
+	mqttPasswordInput.SetText(settings.String("mqtt_password"))
+	mqttPrefixInput := widget.NewEntry()
+	mqttPrefixInput.SetText(mqttPrefix())
+	mqttStatusLabel := widget.NewLabel(bridge.Status())
+	mqttStatusLabel.Wrapping = fyne.TextWrapWord
+	if bridge.Err() != nil {
+		mqttStatusLabel.Importance = widget.DangerImportance
+	}
+
+	clientLimitInput := widget.NewEntry()
+	clientLimitInput.SetText(strconv.Itoa(clientRunLimit()))
+	clientLimitItem := widget.NewFormItem("Runs per Client", clientLimitInput)
+	clientLimitItem.HintText = "Per minute, 0 for no limit"
+	scriptLimitInput := widget.NewEntry()
+	scriptLimitInput.SetText(strconv.Itoa(scriptRunLimit()))
+	scriptLimitItem := widget.NewFormItem("Runs per Task", scriptLimitInput)
+	scriptLimitItem.HintText = "Per minute across clients, 0 for no limit"
+	processesInput := widget.NewEntry()
+	processesInput.SetText(strconv.Itoa(maxProcesses()))
+	processesItem := widget.NewFormItem("Max Processes", processesInput)
+	processesItem.HintText = "Further runs wait, 0 for no limit"
+
+	statusLabel := widget.NewLabel(server.Status())
+	statusLabel.Wrapping = fyne.TextWrapWord
+	if server.Err() != nil {
+		statusLabel.Importance = widget.DangerImportance
+	}
+
+	// The settings are grouped in cards that scroll, so that the Save
+	// button stays in view however many there are
+	cards := container.NewVBox(
+		widget.NewCard("Server", "", widget.NewForm(
+			widget.NewFormItem("Status", statusLabel),
+			widget.NewFormItem("Port", portInput),
+			widget.NewFormItem("Bind Address", bindInput),
+			socketItem,
+			widget.NewFormItem("Advertise on Network", mdnsCheck),
+			widget.NewFormItem("Start Minimized", minimizedCheck))),
+		widget.NewCard("Security", "", widget.NewForm(
+			widget.NewFormItem("API Key", apiKey),
+			widget.NewFormItem("HTTPS", httpsCheck),
+			widget.NewFormItem("Authentication", authSelect),
+			widget.NewFormItem("Certificate", certInput),
+			widget.NewFormItem("Key", keyInput),
+			widget.NewFormItem("Fingerprint", fingerprintLabel))),
+		widget.NewCard("Limits", "", widget.NewForm(
+			clientLimitItem,
+			scriptLimitItem,
+			processesItem)),
+		widget.NewCard("MQTT", "", widget.NewForm(
+			widget.NewFormItem("Status", mqttStatusLabel),
+			widget.NewFormItem("Broker", mqttBrokerInput),
+			widget.NewFormItem("Username", mqttUserInput),
+			widget.NewFormItem("Password", mqttPasswordInput),
+			widget.NewFormItem("Topic Prefix", mqttPrefixInput))))
+
+	save := func() {
+		port := strings.TrimSpace(portInput.Text)
+		if err := validatePort(port); err != nil {
+			dialog.ShowError(err, g.window)
+			return
+		}
+		bind, socket := strings.TrimSpace(bindInput.Text), strings.TrimSpace(socketInput.Text)
+		if err := validateBindAddress(bind); err != nil {
+			dialog.ShowError(err, g.window)
+			return
+		}
+		if err := validateUnixSocket(expandHome(socket)); err != nil {
+			dialog.ShowError(err, g.window)
+			return
+		}
+		certFile, keyFile := strings.TrimSpace(certInput.Text), strings.TrimSpace(keyInput.Text)
+		if certFile != "" || keyFile != "" {
+			if err := checkKeyPair(certFile, keyFile); err != nil {
+				dialog.ShowError(err, g.window)
+				return
+			}
+		}
+		clientLimit := strings.TrimSpace(clientLimitInput.Text)
+		scriptLimit := strings.TrimSpace(scriptLimitInput.Text)
+		processLimit := strings.TrimSpace(processesInput.Text)
+		for _, err := range []error{
+			validateLimit("Runs per client", clientLimit),
+			validateLimit("Runs per task", scriptLimit),
+			validateLimit("Max processes", processLimit),
+		} {
+			if err != nil {
+				dialog.ShowError(err, g.window)
+				return
+			}
+		}
+		broker := strings.TrimSpace(mqttBrokerInput.Text)
+		if err := validateMQTTBroker(broker); err != nil {
+			dialog.ShowError(err, g.window)
+			return
+		}
+		mode := AuthToken
+		if authSelect.Selected == authModes[AuthMTLS] {
+			mode = AuthMTLS
+		}
+		if mode == AuthMTLS && !httpsCheck.Checked {
+			dialog.ShowError(fmt.Errorf("client certificates require HTTPS"), g.window)
+			return
+		}
+
+		g.preferences.SetBool("minimized", minimizedCheck.Checked)
+		settings.SetString("port", port)
+		settings.SetString("bind_address", bind)
+		settings.SetString("unix_socket", socket)
+		settings.SetBool("mdns", mdnsCheck.Checked)
+		settings.SetBool("https", httpsCheck.Checked)
+		settings.SetString("auth_mode", mode)
+		settings.SetString("tls_cert", certFile)
+		settings.SetString("tls_key", keyFile)
+		settings.SetString("rate_limit_client", clientLimit)
+		settings.SetString("rate_limit_script", scriptLimit)
+		settings.SetString("max_processes", processLimit)
+		// runs waiting for a slot see a raised limit right away
+		processes.wake()
+		settings.SetString("mqtt_broker", broker)
+		settings.SetString("mqtt_username", strings.TrimSpace(mqttUserInput.Text))
+		settings.SetString("mqtt_password", mqttPasswordInput.Text)
+		settings.SetString("mqtt_prefix", strings.TrimSpace(mqttPrefixInput.Text))
+		fingerprintLabel.SetText(currentFingerprint())
+
+		err := server.Restart()
+		statusLabel.Importance = widget.MediumImportance
+		if err != nil {
+			statusLabel.Importance = widget.DangerImportance
+			dialog.ShowError(err, g.window)
+		}
+		statusLabel.SetText(server.Status())
+
+		err = bridge.Restart()
+		mqttStatusLabel.Importance = widget.MediumImportance
+		if err != nil {
+			mqttStatusLabel.Importance = widget.DangerImportance
+			dialog.ShowError(err, g.window)
+		}
+		mqttStatusLabel.SetText(bridge.Status())
+	}
+
+	saveBtn := widget.NewButton("Save", save)
+	saveBtn.Importance = widget.HighImportance
+	content := container.NewBorder(nil, container.NewHBox(layout.NewSpacer(), saveBtn), nil, nil, container.NewVScroll(cards))
+	g.preferencesTab.Content = content
+
+	// The bridge connects in the background, its status is followed until
+	// the tab is built again
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			if g.preferencesTab.Content != content {
+				return
+			}
+			mqttStatusLabel.SetText(bridge.Status())
+		}
+	}()
+}
+
+// runGUI starts the server with the GUI as its frontend
+func runGUI(opts Options) error {
+	gui := NewGUI(opts.Overrides)
+	startCore()
+	gui.Initialize()
+	gui.Run()
+	return nil
+}
@@ -0,0 +1,172 @@
+//go:build !headless
+
+package main
+
+import (
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// taskTemplateLabels lists the kinds of task that can be created
+func taskTemplateLabels() []string {
+	labels := []string{"Bun Script", "Macro"}
+	for _, name := range actionNames {
+		labels = append(labels, actions[name].Title)
+	}
+	return labels
+}
+
+// taskTemplate maps a template label to a task type or action name
+func taskTemplate(label string) string {
+	switch label {
+	case "Bun Script":
+		return TypeScript
+	case "Macro":
+		return TypeMacro
+	}
+	for _, name := range actionNames {
+		if actions[name].Title == label {
+			return name
+		}
+	}
+	return TypeScript
+}
+
+// newActionParamItems builds form inputs for the parameters of action. The
+// values are written to params as they are edited.
+func newActionParamItems(action Action, params map[string]string) []*widget.FormItem {
+	var items []*widget.FormItem
+	for _, p := range action.Params {
+		name := p.Name
+
+		if len(p.Options) > 0 {
+			sel := widget.NewSelect(p.Options, func(v string) { params[name] = v })
+			if v, ok := params[name]; ok {
+				sel.SetSelected(v)
+			} else {
+				sel.SetSelectedIndex(0)
+			}
+			items = append(items, widget.NewFormItem(p.Label, sel))
+			continue
+		}
+
+		entry := widget.NewEntry()
+		if p.Multiline {
+			entry = widget.NewMultiLineEntry()
+		}
+		entry.SetText(params[name])
+		entry.SetPlaceHolder(p.Placeholder)
+		entry.OnChanged = func(v string) { params[name] = v }
+		items = append(items, widget.NewFormItem(p.Label, entry))
+	}
+	return items
+}
+
+func (g *GUI) handleNewMacro(idText, title string) {
+	id, err := strconv.Atoi(idText)
+	if err != nil {
+		fmt.Println("Failed to create macro: ID is not a number")
+		return
+	}
+	g.showMacroDialog(Script{ID: id, Type: TypeMacro, Title: strings.TrimSpace(title)}, true)
+}
+
+func (g *GUI) handleNewAction(idText, title, action string, params map[string]string) {
+	script, err := newActionTask(idText, title, action, params)
+	if err == nil {
+		err = writeScriptMetadata(script)
+	}
+	if err != nil {
+		fmt.Println("Failed to create task:", err.Error())
+		dialog.ShowError(err, g.window)
+		return
+	}
+	auditGUI(AuditCreate, script)
+
+	reloadSchedules()
+	g.refreshGUI(0)
+}
+
+// newActionTask builds and validates an action task from dialog input
+func newActionTask(idText, title, action string, params map[string]string) (Script, error) {
+	id, err := strconv.Atoi(idText)
+	if err != nil {
+		return Script{}, fmt.Errorf("ID is not a number")
+	}
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return Script{}, fmt.Errorf("task needs a name")
+	}
+	if err := validateAction(action, params); err != nil {
+		return Script{}, err
+	}
+
+	return Script{ID: id, Type: TypeAction, Title: title, Action: action, Params: maps.Clone(params)}, nil
+}
+
+// showActionDialog edits the parameters of an existing action task
+func (g *GUI) showActionDialog(script Script) {
+	action, ok := actions[script.Action]
+	if !ok {
+		dialog.ShowError(fmt.Errorf("unknown action %q", script.Action), g.window)
+		return
+	}
+
+	draft := script
+	params := maps.Clone(script.Params)
+	if params == nil {
+		params = map[string]string{}
+	}
+
+	idEntry := widget.NewEntry()
+	idEntry.SetText(strconv.Itoa(script.ID))
+	titleEntry := widget.NewEntry()
+	titleEntry.SetText(script.Title)
+	scheduleEntry := widget.NewMultiLineEntry()
+	scheduleEntry.SetText(strings.Join(script.Schedules, "\n"))
+	scheduleEntry.SetPlaceHolder("One cron expression per line, e.g. 55 9 * * 1-5")
+	scheduleEntry.Validator = validateScheduleText
+	tagsEntry := newTagsEntry(script.Tags)
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("ID", idEntry),
+		widget.NewFormItem("Name", titleEntry),
+	}
+	items = append(items, newActionParamItems(action, params)...)
+	items = append(items,
+		widget.NewFormItem("Schedule", scheduleEntry),
+		widget.NewFormItem("Tags", tagsEntry),
+		widget.NewFormItem("Webhook", g.newHookEditor(&draft)))
+
+	d := dialog.NewForm("Edit "+action.Title, "Confirm", "Cancel", items,
+		func(confirmed bool) {
+			if !confirmed {
+				return
+			}
+
+			updated, err := newActionTask(idEntry.Text, titleEntry.Text, action.Name, params)
+			if err == nil {
+				updated.Schedules = parseScheduleText(scheduleEntry.Text)
+				updated.Tags = parseTags(tagsEntry.Text)
+				updated.Hook = draft.Hook
+				err = updateScriptMetadata(script.ID, updated)
+			}
+			if err != nil {
+				fmt.Println("Failed to update task:", err.Error())
+				dialog.ShowError(err, g.window)
+				return
+			}
+			auditGUI(AuditUpdate, updated)
+
+			reloadSchedules()
+			g.refreshGUI(0)
+		}, g.window)
+	d.Resize(fyne.NewSize(480, 0))
+	d.Show()
+}
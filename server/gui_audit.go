@@ -0,0 +1,85 @@
+//go:build !headless
+
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+const allActions = "All actions"
+
+// formatAuditEntry returns a one line summary of an audit entry
+func formatAuditEntry(e AuditEntry) string {
+	line := fmt.Sprintf("%s  %s  %s", e.Time.Format("Jan 2 15:04:05"), e.Action, e.Client)
+	if e.IP != "" {
+		line += " (" + e.IP + ")"
+	}
+	if e.Script != "" {
+		line += fmt.Sprintf("  %s #%d", e.Script, e.ScriptID)
+	}
+	if e.Detail != "" {
+		line += "  " + e.Detail
+	}
+	return line
+}
+
+func (g *GUI) buildAuditTab() {
+	var entries []AuditEntry
+
+	actionSelect := widget.NewSelect(append([]string{allActions}, auditActions...), nil)
+	actionSelect.SetSelected(allActions)
+	queryEntry := widget.NewEntry()
+	queryEntry.SetPlaceHolder("Filter by client, IP, task or detail")
+
+	filter := func() func(AuditEntry) bool {
+		action := actionSelect.Selected
+		if action == allActions {
+			action = ""
+		}
+		return auditFilter(action, queryEntry.Text)
+	}
+
+	list := widget.NewList(
+		func() int { return len(entries) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, obj fyne.CanvasObject) {
+			obj.(*widget.Label).SetText(formatAuditEntry(entries[i]))
+		})
+
+	reload := func() {
+		entries = readAudit(filter())
+		// Newest first
+		slices.Reverse(entries)
+		list.Refresh()
+	}
+	actionSelect.OnChanged = func(string) { reload() }
+	queryEntry.OnChanged = func(string) { reload() }
+	reload()
+
+	exportBtn := widget.NewButtonWithIcon("Export", theme.DocumentSaveIcon(), func() {
+		d := dialog.NewFileSave(func(w fyne.URIWriteCloser, err error) {
+			if err != nil || w == nil {
+				return
+			}
+			defer w.Close()
+			if err := exportAudit(w, filter()); err != nil {
+				dialog.ShowError(err, g.window)
+			}
+		}, g.window)
+		d.SetFileName("opendeck-audit.jsonl")
+		d.Show()
+	})
+	refreshBtn := widget.NewButtonWithIcon("", theme.ViewRefreshIcon(), reload)
+
+	header := container.NewBorder(nil, nil, actionSelect, container.NewHBox(exportBtn, refreshBtn), queryEntry)
+	padded := layout.NewCustomPaddedLayout(0, 0, 16, 0)
+	g.auditTab.Content = container.New(padded, container.NewBorder(header, nil, nil, nil, list))
+}
@@ -0,0 +1,197 @@
+//go:build !headless
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// formatLastSeen describes when a client last made a request
+func formatLastSeen(c Client) string {
+	if c.LastSeen.IsZero() {
+		return "never seen"
+	}
+	return "last seen " + c.LastSeen.Format("Jan 2 15:04")
+}
+
+func (g *GUI) buildClientsTab() {
+	clients := getClients()
+
+	list := widget.NewList(
+		func() int { return len(clients) },
+		func() fyne.CanvasObject {
+			return container.NewHBox(
+				widget.NewLabel(""),
+				layout.NewSpacer(),
+				widget.NewButtonWithIcon("Permissions", theme.AccountIcon(), func() {}),
+				widget.NewButtonWithIcon("Revoke", theme.DeleteIcon(), func() {}))
+		},
+		func(i widget.ListItemID, obj fyne.CanvasObject) {
+			client := clients[i]
+			objects := obj.(*fyne.Container).Objects
+			access := "all tasks"
+			if client.Restricted {
+				access = "restricted"
+			}
+			objects[0].(*widget.Label).SetText(fmt.Sprintf("%s  (paired %s, %s, %s)",
+				client.Name, client.Paired.Format("Jan 2 2006"), formatLastSeen(client), access))
+			objects[2].(*widget.Button).OnTapped = func() {
+				g.showPermissionsDialog(client)
+			}
+			objects[3].(*widget.Button).OnTapped = func() {
+				message := fmt.Sprintf("Revoke %s? It will have to be paired again.", client.Name)
+				dialog.ShowConfirm("Revoke Client", message, func(confirmed bool) {
+					if !confirmed {
+						return
+					}
+					if err := revokeClient(client.ID); err != nil {
+						dialog.ShowError(err, g.window)
+					} else {
+						recordAudit(AuditEntry{Action: AuditRevoke, Client: actorGUI, Detail: client.Name + " (" + client.ID + ")"})
+					}
+					g.refreshGUI(g.tabs.SelectedIndex())
+				}, g.window)
+			}
+		})
+
+	pairBtn := widget.NewButtonWithIcon("Pair Client", theme.ContentAddIcon(), g.showPairingDialog)
+	refreshBtn := widget.NewButtonWithIcon("", theme.ViewRefreshIcon(), func() {
+		g.refreshGUI(g.tabs.SelectedIndex())
+	})
+
+	var content fyne.CanvasObject = list
+	if len(clients) == 0 {
+		content = container.NewCenter(widget.NewLabel("No paired clients"))
+	}
+
+	header := container.NewHBox(pairBtn, layout.NewSpacer(), refreshBtn)
+	padded := layout.NewCustomPaddedLayout(0, 0, 16, 0)
+	g.clientsTab.Content = container.New(padded, container.NewBorder(header, nil, nil, nil, content))
+}
+
+// newTagsEntry returns an entry for the comma separated tags of a task
+func newTagsEntry(tags []string) *widget.Entry {
+	entry := widget.NewEntry()
+	entry.SetText(strings.Join(tags, ", "))
+	entry.SetPlaceHolder("Comma separated, e.g. media, lab")
+	return entry
+}
+
+// showPermissionsDialog edits which tasks a client may see and run
+func (g *GUI) showPermissionsDialog(client Client) {
+	scripts := getScripts()
+	sort.Slice(scripts, func(i, j int) bool { return scripts[i].ID < scripts[j].ID })
+
+	labels := make([]string, len(scripts))
+	ids := map[string]int{}
+	var selected []string
+	for i, s := range scripts {
+		labels[i] = fmt.Sprintf("%d: %s", s.ID, s.Name())
+		ids[labels[i]] = s.ID
+		if slices.Contains(client.Scripts, s.ID) {
+			selected = append(selected, labels[i])
+		}
+	}
+
+	scriptsGroup := widget.NewCheckGroup(labels, nil)
+	scriptsGroup.SetSelected(selected)
+	tagsEntry := newTagsEntry(client.Tags)
+	tagsEntry.SetPlaceHolder("Allow tasks with any of these tags")
+
+	setEnabled := func(restricted bool) {
+		if restricted {
+			scriptsGroup.Enable()
+			tagsEntry.Enable()
+		} else {
+			scriptsGroup.Disable()
+			tagsEntry.Disable()
+		}
+	}
+	restrictedCheck := widget.NewCheck("Only allow selected tasks and tags", setEnabled)
+	restrictedCheck.SetChecked(client.Restricted)
+	setEnabled(client.Restricted)
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Access", restrictedCheck),
+		widget.NewFormItem("Tags", tagsEntry),
+		widget.NewFormItem("Tasks", container.NewVScroll(scriptsGroup)),
+	}
+	d := dialog.NewForm("Permissions for "+client.Name, "Save", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		var allowed []int
+		for _, label := range scriptsGroup.Selected {
+			allowed = append(allowed, ids[label])
+		}
+		sort.Ints(allowed)
+		if err := setClientPermissions(client.ID, restrictedCheck.Checked, allowed, parseTags(tagsEntry.Text)); err != nil {
+			dialog.ShowError(err, g.window)
+		} else {
+			recordAudit(AuditEntry{Action: AuditPermissions, Client: actorGUI, Detail: client.Name + " (" + client.ID + ")"})
+		}
+		g.refreshGUI(g.tabs.SelectedIndex())
+	}, g.window)
+	d.Resize(fyne.NewSize(480, 420))
+	d.Show()
+}
+
+// showPairingDialog shows a fresh pairing PIN until it expires or the
+// dialog is closed
+func (g *GUI) showPairingDialog() {
+	pin, expires := startPairing()
+
+	pinLabel := widget.NewRichText(&widget.TextSegment{
+		Text: pin,
+		Style: widget.RichTextStyle{
+			Alignment: fyne.TextAlignCenter,
+			SizeName:  theme.SizeNameHeadingText,
+			TextStyle: fyne.TextStyle{Bold: true, Monospace: true},
+		},
+	})
+	countdown := widget.NewLabelWithStyle("", fyne.TextAlignCenter, fyne.TextStyle{})
+
+	content := container.NewVBox(
+		widget.NewLabel("Enter this PIN on the client to pair it."),
+		pinLabel,
+		countdown)
+
+	done := make(chan struct{})
+	d := dialog.NewCustom("Pair Client", "Close", content, g.window)
+	d.SetOnClosed(func() {
+		close(done)
+		stopPairing()
+		g.refreshGUI(g.tabs.SelectedIndex())
+	})
+
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			remaining := time.Until(expires).Round(time.Second)
+			if remaining <= 0 {
+				countdown.SetText("PIN expired")
+				return
+			}
+			countdown.SetText(fmt.Sprintf("Valid for %s", remaining))
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	d.Show()
+}
@@ -0,0 +1,14 @@
+//go:build headless
+
+package main
+
+import "errors"
+
+// headlessOnly is set in builds without the GUI, which leave out Fyne and
+// its graphics dependencies
+const headlessOnly = true
+
+// runGUI is not available without the GUI
+func runGUI(opts Options) error {
+	return errors.New("built without the GUI, run with -headless")
+}
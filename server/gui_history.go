@@ -0,0 +1,90 @@
+//go:build !headless
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// runStatus summarizes the outcome of a run in a few words
+func runStatus(run RunResult) string {
+	switch {
+	case run.Skipped:
+		return "skipped, already running"
+	case run.ExitCode == 0 && run.Error == "":
+		return fmt.Sprintf("ok in %s", run.Duration.Round(time.Millisecond))
+	default:
+		return fmt.Sprintf("exit %d in %s", run.ExitCode, run.Duration.Round(time.Millisecond))
+	}
+}
+
+// formatRunDetail describes a run, including the steps of macros
+func formatRunDetail(run RunResult) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (ID %d)\n", run.Script, run.ScriptID)
+	fmt.Fprintf(&b, "Started: %s via %s\n", run.Started.Format(time.DateTime), run.Trigger)
+	fmt.Fprintf(&b, "Result: %s\n", runStatus(run))
+	if run.Error != "" {
+		fmt.Fprintf(&b, "Error: %s\n", run.Error)
+	}
+
+	for _, step := range run.Steps {
+		status := fmt.Sprintf("exit %d in %s", step.ExitCode, step.Duration.Round(time.Millisecond))
+		if step.Skipped {
+			status = "skipped"
+		}
+		fmt.Fprintf(&b, "\nStep %d (%s): %s\n", step.Index+1, step.Type, status)
+		if step.Error != "" {
+			fmt.Fprintf(&b, "  Error: %s\n", step.Error)
+		}
+		if step.Output != "" {
+			fmt.Fprintf(&b, "  Output: %s\n", step.Output)
+		}
+	}
+
+	if run.Stdout != "" {
+		fmt.Fprintf(&b, "\nStdout:\n%s\n", run.Stdout)
+	}
+	if run.Stderr != "" {
+		fmt.Fprintf(&b, "\nStderr:\n%s\n", run.Stderr)
+	}
+	return b.String()
+}
+
+func (g *GUI) buildHistoryTab() {
+	runs := getRunHistory(nil)
+
+	detail := widget.NewLabelWithStyle("Select a run to see its output", fyne.TextAlignLeading, fyne.TextStyle{Monospace: true})
+	detail.Wrapping = fyne.TextWrapWord
+
+	list := widget.NewList(
+		func() int { return len(runs) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, obj fyne.CanvasObject) {
+			run := runs[i]
+			obj.(*widget.Label).SetText(fmt.Sprintf("%s  %s  [%s]  %s",
+				run.Started.Format("15:04:05"), run.Script, run.Trigger, runStatus(run)))
+		})
+	list.OnSelected = func(i widget.ListItemID) {
+		detail.SetText(formatRunDetail(runs[i]))
+	}
+
+	refreshBtn := widget.NewButtonWithIcon("", theme.ViewRefreshIcon(), func() {
+		g.refreshGUI(g.tabs.SelectedIndex())
+	})
+
+	split := container.NewHSplit(list, container.NewVScroll(detail))
+	split.Offset = 0.45
+
+	header := container.NewHBox(layout.NewSpacer(), refreshBtn)
+	padded := layout.NewCustomPaddedLayout(0, 0, 16, 0)
+	g.historyTab.Content = container.New(padded, container.NewBorder(header, nil, nil, nil, split))
+}
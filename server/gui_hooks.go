@@ -0,0 +1,82 @@
+//go:build !headless
+
+package main
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// newHookEditor builds the webhook controls of the edit dialog. Changes are
+// made to script and saved together with the rest of the dialog.
+func (g *GUI) newHookEditor(script *Script) fyne.CanvasObject {
+	urlLabel := widget.NewLabel("")
+	urlLabel.Wrapping = fyne.TextWrapBreak
+	secretLabel := widget.NewLabel("")
+	secretLabel.Wrapping = fyne.TextWrapBreak
+
+	signedCheck := widget.NewCheck("Require HMAC signature", nil)
+	signedCheck.SetChecked(script.Hook != nil && script.Hook.Secret != "")
+
+	generateBtn := widget.NewButtonWithIcon("", theme.ViewRefreshIcon(), nil)
+	revokeBtn := widget.NewButtonWithIcon("Revoke", theme.DeleteIcon(), nil)
+	copyBtn := widget.NewButtonWithIcon("Copy URL", theme.ContentCopyIcon(), nil)
+
+	update := func() {
+		if script.Hook == nil {
+			urlLabel.SetText("Disabled")
+			secretLabel.Hide()
+			generateBtn.SetText("Generate")
+			revokeBtn.Disable()
+			copyBtn.Disable()
+			return
+		}
+
+		urlLabel.SetText("POST " + hookURL(script.Hook.Token))
+		if script.Hook.Secret != "" {
+			secretLabel.SetText("Secret: " + script.Hook.Secret)
+			secretLabel.Show()
+		} else {
+			secretLabel.Hide()
+		}
+		generateBtn.SetText("Rotate")
+		revokeBtn.Enable()
+		copyBtn.Enable()
+	}
+
+	generateBtn.OnTapped = func() {
+		script.Hook = newHook(signedCheck.Checked)
+		update()
+	}
+	revokeBtn.OnTapped = func() {
+		script.Hook = nil
+		update()
+	}
+	copyBtn.OnTapped = func() {
+		if script.Hook != nil {
+			g.window.Clipboard().SetContent(hookURL(script.Hook.Token))
+		}
+	}
+	signedCheck.OnChanged = func(signed bool) {
+		if script.Hook == nil {
+			return
+		}
+		hook := *script.Hook
+		hook.Secret = ""
+		if signed {
+			hook.Secret = generateToken(32)
+		}
+		script.Hook = &hook
+		update()
+	}
+
+	update()
+	return container.NewVBox(
+		urlLabel,
+		secretLabel,
+		container.NewHBox(generateBtn, revokeBtn, copyBtn),
+		signedCheck,
+	)
+}
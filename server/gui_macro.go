@@ -0,0 +1,276 @@
+//go:build !headless
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+var stepTypeLabels = []string{"Run script", "Delay", "HTTP request", "Set variable", "Native action"}
+var stepTypes = []string{StepScript, StepDelay, StepHTTP, StepSet, StepAction}
+
+var stepConditionLabels = []string{"Always", "If previous succeeded", "If previous failed"}
+var stepConditions = []string{IfAlways, IfSuccess, IfFailure}
+
+// labelFor maps a value to its label in a pair of option slices
+func labelFor(values, labels []string, value string) string {
+	if i := slices.Index(values, value); i >= 0 {
+		return labels[i]
+	}
+	return ""
+}
+
+// valueFor maps a label back to its value in a pair of option slices
+func valueFor(values, labels []string, label string) string {
+	if i := slices.Index(labels, label); i >= 0 {
+		return values[i]
+	}
+	return ""
+}
+
+func (g *GUI) showNewMacroDialog() {
+	g.showMacroDialog(Script{ID: getMaxScriptId() + 1, Type: TypeMacro}, true)
+}
+
+// showMacroDialog opens the macro builder for macro. isNew selects whether
+// confirming creates a macro or updates the existing one.
+func (g *GUI) showMacroDialog(macro Script, isNew bool) {
+	oldId := macro.ID
+	draft := macro
+	draft.Steps = slices.Clone(macro.Steps)
+	scripts := getScripts()
+
+	idEntry := widget.NewEntry()
+	idEntry.SetText(strconv.Itoa(draft.ID))
+	titleEntry := widget.NewEntry()
+	titleEntry.SetText(draft.Title)
+	scheduleEntry := widget.NewMultiLineEntry()
+	scheduleEntry.SetText(strings.Join(draft.Schedules, "\n"))
+	scheduleEntry.SetPlaceHolder("One cron expression per line, e.g. 55 9 * * 1-5")
+	scheduleEntry.Validator = validateScheduleText
+	tagsEntry := newTagsEntry(draft.Tags)
+
+	stepsBox := container.NewVBox()
+	var rebuild func()
+	rebuild = func() {
+		stepsBox.RemoveAll()
+		for i := range draft.Steps {
+			stepsBox.Add(g.newStepRow(&draft, i, scripts, rebuild))
+		}
+		stepsBox.Add(widget.NewButtonWithIcon("Add Step", theme.ContentAddIcon(), func() {
+			draft.Steps = append(draft.Steps, MacroStep{Type: StepScript})
+			rebuild()
+		}))
+		stepsBox.Refresh()
+	}
+	rebuild()
+
+	form := widget.NewForm(
+		widget.NewFormItem("ID", idEntry),
+		widget.NewFormItem("Name", titleEntry),
+		widget.NewFormItem("Schedule", scheduleEntry),
+		widget.NewFormItem("Tags", tagsEntry),
+		widget.NewFormItem("Webhook", g.newHookEditor(&draft)),
+	)
+	content := container.NewBorder(form, nil, nil, nil, container.NewVScroll(stepsBox))
+
+	title := "Edit Macro"
+	if isNew {
+		title = "New Macro"
+	}
+
+	d := dialog.NewCustomConfirm(title, "Confirm", "Cancel", content, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+
+		draft.Title = strings.TrimSpace(titleEntry.Text)
+		draft.Schedules = parseScheduleText(scheduleEntry.Text)
+		draft.Tags = parseTags(tagsEntry.Text)
+		if err := g.handleSaveMacro(oldId, idEntry.Text, draft, isNew); err != nil {
+			fmt.Println("Failed to save macro:", err.Error())
+			// Reopen the builder so the draft is not lost
+			g.showMacroDialog(draft, isNew)
+			dialog.ShowError(err, g.window)
+		}
+	}, g.window)
+	d.Resize(fyne.NewSize(640, 560))
+	d.Show()
+}
+
+func (g *GUI) handleSaveMacro(oldId int, idText string, macro Script, isNew bool) error {
+	id, err := strconv.Atoi(idText)
+	if err != nil {
+		return fmt.Errorf("ID is not a number")
+	}
+	macro.ID = id
+
+	if macro.Title == "" {
+		return fmt.Errorf("macro needs a name")
+	}
+	if err := validateScheduleText(strings.Join(macro.Schedules, "\n")); err != nil {
+		return err
+	}
+	if err := validateMacro(macro, getScripts()); err != nil {
+		return err
+	}
+
+	action := AuditUpdate
+	if isNew {
+		action = AuditCreate
+		err = writeScriptMetadata(macro)
+	} else {
+		err = updateScriptMetadata(oldId, macro)
+	}
+	if err != nil {
+		return err
+	}
+	auditGUI(action, macro)
+
+	reloadSchedules()
+	g.refreshGUI(0)
+	return nil
+}
+
+// newStepRow builds the editor for step i of macro. rebuild is called when
+// steps are added, removed or reordered.
+func (g *GUI) newStepRow(macro *Script, i int, scripts []Script, rebuild func()) fyne.CanvasObject {
+	step := &macro.Steps[i]
+
+	typeSelect := widget.NewSelect(stepTypeLabels, nil)
+	typeSelect.SetSelected(labelFor(stepTypes, stepTypeLabels, step.Type))
+	typeSelect.OnChanged = func(label string) {
+		if t := valueFor(stepTypes, stepTypeLabels, label); t != step.Type {
+			*step = MacroStep{Type: t, If: step.If}
+			rebuild()
+		}
+	}
+
+	condSelect := widget.NewSelect(stepConditionLabels, func(label string) {
+		step.If = valueFor(stepConditions, stepConditionLabels, label)
+	})
+	condSelect.SetSelected(labelFor(stepConditions, stepConditionLabels, step.If))
+
+	move := func(to int) {
+		if to < 0 || to >= len(macro.Steps) {
+			return
+		}
+		macro.Steps[i], macro.Steps[to] = macro.Steps[to], macro.Steps[i]
+		rebuild()
+	}
+	upBtn := widget.NewButtonWithIcon("", theme.MoveUpIcon(), func() { move(i - 1) })
+	downBtn := widget.NewButtonWithIcon("", theme.MoveDownIcon(), func() { move(i + 1) })
+	removeBtn := widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {
+		macro.Steps = slices.Delete(macro.Steps, i, i+1)
+		rebuild()
+	})
+
+	header := container.NewHBox(
+		widget.NewLabel(fmt.Sprintf("Step %d", i+1)),
+		typeSelect,
+		condSelect,
+		layout.NewSpacer(),
+		upBtn, downBtn, removeBtn,
+	)
+
+	return container.NewVBox(header, g.newStepFields(step, macro.ID, scripts, rebuild), widget.NewSeparator())
+}
+
+// newStepFields builds the inputs specific to the type of step
+func (g *GUI) newStepFields(step *MacroStep, macroID int, scripts []Script, rebuild func()) fyne.CanvasObject {
+	entry := func(value, placeholder string, onChanged func(string)) *widget.Entry {
+		e := widget.NewEntry()
+		e.SetText(value)
+		e.SetPlaceHolder(placeholder)
+		e.OnChanged = onChanged
+		return e
+	}
+
+	switch step.Type {
+	case StepScript:
+		var options []string
+		selected := ""
+		for _, s := range scripts {
+			if s.ID == macroID {
+				continue
+			}
+			option := fmt.Sprintf("%d: %s", s.ID, s.Name())
+			options = append(options, option)
+			if s.ID == step.ScriptID {
+				selected = option
+			}
+		}
+		scriptSelect := widget.NewSelect(options, func(option string) {
+			id, _, _ := strings.Cut(option, ":")
+			step.ScriptID, _ = strconv.Atoi(id)
+		})
+		scriptSelect.SetSelected(selected)
+		return widget.NewForm(widget.NewFormItem("Script", scriptSelect))
+
+	case StepDelay:
+		return widget.NewForm(widget.NewFormItem("Duration",
+			entry(step.Duration, "500ms", func(s string) { step.Duration = s })))
+
+	case StepHTTP:
+		methodSelect := widget.NewSelect([]string{"GET", "POST", "PUT", "PATCH", "DELETE"}, func(m string) {
+			step.Method = m
+		})
+		methodSelect.SetSelected(step.Method)
+		if step.Method == "" {
+			methodSelect.SetSelected("GET")
+		}
+		body := widget.NewMultiLineEntry()
+		body.SetText(step.Body)
+		body.SetPlaceHolder(`{"text": "{{.Output}}"}`)
+		body.OnChanged = func(s string) { step.Body = s }
+		return widget.NewForm(
+			widget.NewFormItem("Method", methodSelect),
+			widget.NewFormItem("URL", entry(step.URL, "https://example.com/hook", func(s string) { step.URL = s })),
+			widget.NewFormItem("Body", body),
+		)
+
+	case StepSet:
+		return widget.NewForm(
+			widget.NewFormItem("Variable", entry(step.Name, "status", func(s string) { step.Name = s })),
+			widget.NewFormItem("Value", entry(step.Value, "{{.Output}}", func(s string) { step.Value = s })),
+		)
+
+	case StepAction:
+		var titles []string
+		for _, name := range actionNames {
+			titles = append(titles, actions[name].Title)
+		}
+		actionSelect := widget.NewSelect(titles, nil)
+		actionSelect.SetSelected(actions[step.Action].Title)
+		actionSelect.OnChanged = func(title string) {
+			if name := taskTemplate(title); name != step.Action {
+				step.Action = name
+				step.Params = map[string]string{}
+				rebuild()
+			}
+		}
+
+		form := widget.NewForm(widget.NewFormItem("Action", actionSelect))
+		if action, ok := actions[step.Action]; ok {
+			if step.Params == nil {
+				step.Params = map[string]string{}
+			}
+			for _, item := range newActionParamItems(action, step.Params) {
+				form.AppendItem(item)
+			}
+		}
+		return form
+	}
+
+	return container.NewVBox()
+}
@@ -0,0 +1,204 @@
+//go:build !headless
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// notificationFilters maps the labels of the run filter to their values
+var notificationFilters = map[string]string{
+	"Every run": IfAlways,
+	"Successes": IfSuccess,
+	"Failures":  IfFailure,
+}
+
+// filterLabel returns the label of a run filter
+func filterLabel(on string) string {
+	for label, value := range notificationFilters {
+		if value == on {
+			return label
+		}
+	}
+	return ""
+}
+
+// formatDelivery returns a one line summary of a delivery
+func formatDelivery(d Delivery) string {
+	status := "delivered"
+	if !d.Delivered {
+		status = "failed: " + d.Error
+	}
+	task := d.Script
+	if d.ScriptID != 0 {
+		task += fmt.Sprintf(" #%d", d.ScriptID)
+	}
+	return fmt.Sprintf("%s  %s  %s  %s after %d attempts",
+		d.Time.Format("Jan 2 15:04:05"), d.Name, task, status, d.Attempts)
+}
+
+func (g *GUI) buildNotificationsTab() {
+	notifications := getNotifications()
+	deliveries := getDeliveries()
+
+	save := func(updated []Notification) {
+		if err := setNotifications(updated); err != nil {
+			dialog.ShowError(err, g.window)
+			return
+		}
+		g.refreshGUI(g.tabs.SelectedIndex())
+	}
+
+	list := widget.NewList(
+		func() int { return len(notifications) },
+		func() fyne.CanvasObject {
+			return container.NewHBox(
+				widget.NewLabel(""),
+				layout.NewSpacer(),
+				widget.NewButtonWithIcon("", theme.MailSendIcon(), func() {}),
+				widget.NewButtonWithIcon("", theme.SettingsIcon(), func() {}),
+				widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {}))
+		},
+		func(i widget.ListItemID, obj fyne.CanvasObject) {
+			n := notifications[i]
+			objects := obj.(*fyne.Container).Objects
+			scope := "all tasks"
+			if len(n.Scripts) > 0 {
+				scope = fmt.Sprintf("%d tasks", len(n.Scripts))
+			}
+			objects[0].(*widget.Label).SetText(fmt.Sprintf("%s  (%s of %s)", n.Name, strings.ToLower(filterLabel(n.On)), scope))
+			objects[2].(*widget.Button).OnTapped = func() {
+				go func() {
+					d := testNotification(n)
+					if !d.Delivered {
+						dialog.ShowError(fmt.Errorf("test notification failed: %s", d.Error), g.window)
+					} else {
+						dialog.ShowInformation("Test Notification", "Sent a test notification to "+n.URL, g.window)
+					}
+					g.refreshGUI(g.tabs.SelectedIndex())
+				}()
+			}
+			objects[3].(*widget.Button).OnTapped = func() {
+				g.showNotificationDialog(n, func(edited Notification) {
+					updated := slices.Clone(notifications)
+					updated[i] = edited
+					save(updated)
+				})
+			}
+			objects[4].(*widget.Button).OnTapped = func() {
+				message := fmt.Sprintf("Delete the notification %s?", n.Name)
+				dialog.ShowConfirm("Delete Notification", message, func(confirmed bool) {
+					if confirmed {
+						save(slices.Delete(slices.Clone(notifications), i, i+1))
+					}
+				}, g.window)
+			}
+		})
+
+	deliveryList := widget.NewList(
+		func() int { return len(deliveries) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, obj fyne.CanvasObject) {
+			obj.(*widget.Label).SetText(formatDelivery(deliveries[i]))
+		})
+
+	addBtn := widget.NewButtonWithIcon("Add Notification", theme.ContentAddIcon(), func() {
+		g.showNotificationDialog(Notification{}, func(n Notification) {
+			save(append(slices.Clone(notifications), n))
+		})
+	})
+	refreshBtn := widget.NewButtonWithIcon("", theme.ViewRefreshIcon(), func() {
+		g.refreshGUI(g.tabs.SelectedIndex())
+	})
+
+	var content fyne.CanvasObject = list
+	if len(notifications) == 0 {
+		content = container.NewCenter(widget.NewLabel("No notifications"))
+	}
+	deliveriesPane := container.NewBorder(widget.NewLabel("Deliveries"), nil, nil, nil, deliveryList)
+
+	header := container.NewHBox(addBtn, layout.NewSpacer(), refreshBtn)
+	padded := layout.NewCustomPaddedLayout(0, 0, 16, 0)
+	g.notificationsTab.Content = container.New(padded,
+		container.NewBorder(header, nil, nil, nil, container.NewVSplit(content, deliveriesPane)))
+}
+
+// showNotificationDialog edits a notification and passes it to onSave
+func (g *GUI) showNotificationDialog(n Notification, onSave func(Notification)) {
+	scripts := getScripts()
+	sort.Slice(scripts, func(i, j int) bool { return scripts[i].ID < scripts[j].ID })
+
+	labels := make([]string, len(scripts))
+	ids := map[string]int{}
+	var selected []string
+	for i, s := range scripts {
+		labels[i] = fmt.Sprintf("%d: %s", s.ID, s.Name())
+		ids[labels[i]] = s.ID
+		if slices.Contains(n.Scripts, s.ID) {
+			selected = append(selected, labels[i])
+		}
+	}
+	scriptsGroup := widget.NewCheckGroup(labels, nil)
+	scriptsGroup.SetSelected(selected)
+
+	nameEntry := widget.NewEntry()
+	nameEntry.SetText(n.Name)
+	urlEntry := widget.NewEntry()
+	urlEntry.SetText(n.URL)
+	urlEntry.SetPlaceHolder("https://chat.example.com/hooks/...")
+	filterSelect := widget.NewSelect([]string{"Every run", "Successes", "Failures"}, nil)
+	filterSelect.SetSelected(filterLabel(n.On))
+	bodyEntry := widget.NewMultiLineEntry()
+	bodyEntry.SetText(n.Body)
+	bodyEntry.SetPlaceHolder(`{"text": {{json .Run.Script}}}`)
+	headersEntry := widget.NewMultiLineEntry()
+	headersEntry.SetText(formatHeaders(n.Headers))
+	headersEntry.SetPlaceHolder("One header per line, e.g. Authorization: Bearer ...")
+	secretEntry := widget.NewPasswordEntry()
+	secretEntry.SetText(n.Secret)
+	secretEntry.SetPlaceHolder("Unsigned")
+
+	bodyItem := widget.NewFormItem("Body", bodyEntry)
+	bodyItem.HintText = "Template of the JSON body, the run event is sent if empty"
+	tasksItem := widget.NewFormItem("Tasks", container.NewVScroll(scriptsGroup))
+	tasksItem.HintText = "Every task if none are selected"
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Name", nameEntry),
+		widget.NewFormItem("URL", urlEntry),
+		widget.NewFormItem("Send", filterSelect),
+		tasksItem,
+		bodyItem,
+		widget.NewFormItem("Headers", headersEntry),
+		widget.NewFormItem("Secret", secretEntry),
+	}
+	d := dialog.NewForm("Notification", "Save", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		n.Name = strings.TrimSpace(nameEntry.Text)
+		n.URL = strings.TrimSpace(urlEntry.Text)
+		n.On = notificationFilters[filterSelect.Selected]
+		n.Body = strings.TrimSpace(bodyEntry.Text)
+		n.Headers = parseHeaders(headersEntry.Text)
+		n.Secret = secretEntry.Text
+		n.Scripts = nil
+		for _, label := range scriptsGroup.Selected {
+			n.Scripts = append(n.Scripts, ids[label])
+		}
+		sort.Ints(n.Scripts)
+		onSave(n)
+	}, g.window)
+	d.Resize(fyne.NewSize(520, 560))
+	d.Show()
+}
@@ -0,0 +1,78 @@
+//go:build !headless
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// parseScheduleText splits the schedule entry into one expression per line
+func parseScheduleText(text string) []string {
+	var specs []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			specs = append(specs, line)
+		}
+	}
+	return specs
+}
+
+// validateScheduleText validates every expression in the schedule entry
+func validateScheduleText(text string) error {
+	var errs []error
+	for _, spec := range parseScheduleText(text) {
+		if err := validateSchedule(spec); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (g *GUI) buildScheduleTab() {
+	upcoming := scheduler.Upcoming()
+	past := getRunHistory(func(r RunResult) bool { return r.Trigger == TriggerSchedule })
+
+	upcomingList := widget.NewList(
+		func() int { return len(upcoming) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, obj fyne.CanvasObject) {
+			run := upcoming[i]
+			obj.(*widget.Label).SetText(fmt.Sprintf("%s  %s  (%s)",
+				run.Next.Format("Mon 15:04"), run.Script, run.Spec))
+		})
+
+	pastList := widget.NewList(
+		func() int { return len(past) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, obj fyne.CanvasObject) {
+			run := past[i]
+			status := fmt.Sprintf("exit %d in %s", run.ExitCode, run.Duration.Round(time.Millisecond))
+			if run.Skipped {
+				status = "skipped, already running"
+			}
+			obj.(*widget.Label).SetText(fmt.Sprintf("%s  %s  %s",
+				run.Started.Format("Mon 15:04:05"), run.Script, status))
+		})
+
+	refreshBtn := widget.NewButtonWithIcon("", theme.ViewRefreshIcon(), func() {
+		g.refreshGUI(g.tabs.SelectedIndex())
+	})
+
+	split := container.NewVSplit(
+		container.NewBorder(widget.NewLabelWithStyle("Upcoming", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}), nil, nil, nil, upcomingList),
+		container.NewBorder(widget.NewLabelWithStyle("Recent", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}), nil, nil, nil, pastList),
+	)
+
+	header := container.NewHBox(layout.NewSpacer(), refreshBtn)
+	padded := layout.NewCustomPaddedLayout(0, 0, 16, 0)
+	g.scheduleTab.Content = container.New(padded, container.NewBorder(header, nil, nil, nil, split))
+}
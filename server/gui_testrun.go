@@ -0,0 +1,60 @@
+//go:build !headless
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// newTestRunPanel builds the editor controls that run the unsaved script
+// buffer returned by source and show its output
+func (g *GUI) newTestRunPanel(ext string, source func() string) fyne.CanvasObject {
+	argsEntry := widget.NewEntry()
+	argsEntry.SetPlaceHolder("Arguments (optional)")
+
+	statusLabel := widget.NewLabel("")
+	stdoutText := widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Monospace: true})
+	stdoutText.Wrapping = fyne.TextWrapWord
+	stderrText := widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Monospace: true})
+	stderrText.Wrapping = fyne.TextWrapWord
+	stderrText.Importance = widget.DangerImportance
+
+	output := container.NewVScroll(container.NewVBox(stdoutText, stderrText))
+	output.SetMinSize(fyne.NewSize(0, 120))
+	output.Hide()
+
+	var runBtn *widget.Button
+	runBtn = widget.NewButtonWithIcon("Run", theme.MediaPlayIcon(), func() {
+		runBtn.Disable()
+		statusLabel.SetText("Running...")
+
+		go func() {
+			defer runBtn.Enable()
+
+			opts := RunOptions{Trigger: TriggerEditor, Args: strings.Fields(argsEntry.Text)}
+			result, err := runBuffer(source(), ext, opts)
+
+			status := fmt.Sprintf("Exit code %d in %s", result.ExitCode, result.Duration.Round(time.Millisecond))
+			if err != nil && result.ExitCode == -1 {
+				status = "Failed: " + err.Error()
+			}
+			statusLabel.SetText(status)
+			stdoutText.SetText(result.Stdout)
+			stderrText.SetText(result.Stderr)
+			output.Show()
+		}()
+	})
+
+	return container.NewVBox(
+		container.NewBorder(nil, nil, nil, runBtn, argsEntry),
+		statusLabel,
+		output,
+	)
+}
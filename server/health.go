@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HealthCheck is the result of a single health check. Details are only
+// given for failed checks since the health endpoint is public.
+type HealthCheck struct {
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// runtimeCheckTimeout is how long the runtime may take to print its version
+var runtimeCheckTimeout = 5 * time.Second
+
+// runtimeCheckTTL is how long the result of the runtime check is reused.
+// The health endpoint is public, so requests must not start a process
+// each.
+var runtimeCheckTTL = 30 * time.Second
+
+// runtimeCheck is the last result of checkRuntime and the runtime it was
+// for
+var runtimeCheck struct {
+	sync.Mutex
+	runtime string
+	checked time.Time
+	result  HealthCheck
+}
+
+// checkRuntime checks that the script runtime starts, by asking it for its
+// version. A runtime built for another architecture or missing libraries
+// is found on the path but fails here.
+func checkRuntime() HealthCheck {
+	ctx, cancel := context.WithTimeout(context.Background(), runtimeCheckTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, scriptRuntime[0], "--version").CombinedOutput()
+	if ctx.Err() != nil {
+		err = fmt.Errorf("no answer within %s", runtimeCheckTimeout)
+	}
+	if err != nil {
+		detail := fmt.Sprintf("%s --version: %s", scriptRuntime[0], err)
+		if out := strings.TrimSpace(string(out)); out != "" {
+			detail += ": " + out
+		}
+		return HealthCheck{Detail: detail}
+	}
+	return HealthCheck{OK: true}
+}
+
+// cachedRuntimeCheck returns the result of checkRuntime, running it at most
+// once per runtimeCheckTTL. Concurrent requests wait for the same check.
+func cachedRuntimeCheck() HealthCheck {
+	runtimeCheck.Lock()
+	defer runtimeCheck.Unlock()
+	if runtimeCheck.runtime == scriptRuntime[0] && time.Since(runtimeCheck.checked) < runtimeCheckTTL {
+		return runtimeCheck.result
+	}
+	runtimeCheck.result = checkRuntime()
+	runtimeCheck.runtime, runtimeCheck.checked = scriptRuntime[0], time.Now()
+	return runtimeCheck.result
+}
+
+// checkScriptsWritable checks that files can be created in the scripts
+// directory
+func checkScriptsWritable() HealthCheck {
+	f, err := os.CreateTemp(getScriptsPath(), ".opendeck-health-*")
+	if err != nil {
+		return HealthCheck{Detail: err.Error()}
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return HealthCheck{OK: true}
+}
+
+// fiberHealth reports whether scripts can be run and saved. It responds
+// with 503 if any check fails.
+func fiberHealth(c *fiber.Ctx) error {
+	checks := map[string]HealthCheck{
+		"runtime": cachedRuntimeCheck(),
+		"scripts": checkScriptsWritable(),
+	}
+	status := "ok"
+	for _, check := range checks {
+		if !check.OK {
+			status = "unhealthy"
+			c.Status(fiber.StatusServiceUnavailable)
+		}
+	}
+	return c.JSON(fiber.Map{"status": status, "checks": checks})
+}
+
+// limitHealth rejects health and readiness checks with 429 once an
+// address sent more than healthCheckLimit per minute
+func limitHealth(c *fiber.Ctx) error {
+	wait, ok := healthLimiter.allowKey(c.IP(), healthCheckLimit, time.Now())
+	if ok {
+		return c.Next()
+	}
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return fiber.NewError(fiber.StatusTooManyRequests, "too many health checks, try again later")
+}
+
+// fiberReady reports whether the server is ready for requests: it is
+// listening and scheduled tasks run. It responds with 503 otherwise, for
+// example while the server shuts down.
+func fiberReady(c *fiber.Ctx) error {
+	checks := map[string]HealthCheck{
+		"listener":  {OK: server.Running()},
+		"scheduler": {OK: scheduler.Running()},
+	}
+	status := "ok"
+	for _, check := range checks {
+		if !check.OK {
+			status = "not ready"
+			c.Status(fiber.StatusServiceUnavailable)
+		}
+	}
+	return c.JSON(fiber.Map{"status": status, "checks": checks})
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"slices"
+	"sync"
+)
+
+// maxHistory is the number of runs kept in memory
+const maxHistory = 200
+
+var (
+	historyMu  sync.Mutex
+	runHistory []RunResult
+)
+
+// recordRun appends a run to the history, dropping the oldest entries
+// once maxHistory is reached
+func recordRun(result RunResult) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	runHistory = append(runHistory, result)
+	if len(runHistory) > maxHistory {
+		runHistory = slices.Clone(runHistory[len(runHistory)-maxHistory:])
+	}
+}
+
+// getRunHistory returns recorded runs, newest first. If filter is not nil
+// only runs it accepts are returned.
+func getRunHistory(filter func(RunResult) bool) []RunResult {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	var out []RunResult
+	for i := len(runHistory) - 1; i >= 0; i-- {
+		if filter == nil || filter(runHistory[i]) {
+			out = append(out, runHistory[i])
+		}
+	}
+	return out
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// signatureHeader carries the HMAC-SHA256 of the request body for signed hooks
+const signatureHeader = "X-OpenDeck-Signature"
+
+// Hook is an inbound webhook that runs a script when its URL is called
+type Hook struct {
+	Token string `json:"token"`
+	// Secret is the HMAC key requests must be signed with. Unsigned hooks
+	// leave it empty.
+	Secret string `json:"secret,omitempty"`
+}
+
+// generateToken returns a random hex encoded token of n bytes
+func generateToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("failed to read random bytes: %s", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// newHook creates a hook with a fresh token and, if signed, a fresh secret
+func newHook(signed bool) *Hook {
+	hook := &Hook{Token: generateToken(24)}
+	if signed {
+		hook.Secret = generateToken(32)
+	}
+	return hook
+}
+
+// signPayload returns the signature header value for body
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifySignature checks a signature header value against body
+func verifySignature(secret string, body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	return hmac.Equal([]byte(signPayload(secret, body)), []byte(signature))
+}
+
+// hookURL returns the URL a hook token is reachable at on this machine,
+// with the scheme and address the server listens on. Listening on every
+// interface is shown as localhost.
+func hookURL(token string) string {
+	host, port := bindAddress(), serverPort()
+	if addrs := server.Addrs(); len(addrs) > 0 {
+		// The TCP listener comes first, the Unix socket has no URL
+		if h, p, err := net.SplitHostPort(addrs[0]); err == nil {
+			host, port = h, p
+		}
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+
+	scheme := "http"
+	if useHTTPS() {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port) + "/hooks/" + token
+}
+
+// findScriptByHook looks up the script a hook token belongs to
+func findScriptByHook(scripts []Script, token string) (Script, bool) {
+	for _, s := range scripts {
+		if s.Hook != nil && subtle.ConstantTimeCompare([]byte(s.Hook.Token), []byte(token)) == 1 {
+			return s, true
+		}
+	}
+	return Script{}, false
+}
+
+// fiberRunHook runs the script registered for a hook token. The request
+// body is passed to the script on stdin.
+func fiberRunHook(c *fiber.Ctx) error {
+	script, ok := findScriptByHook(getScripts(), c.Params("token"))
+	if !ok || !hasValidFile(script) {
+		return fiber.ErrNotFound
+	}
+
+	entry := AuditEntry{Action: AuditRun, Client: actorWebhook, IP: c.IP()}.withScript(script)
+	body := c.Body()
+	if script.Hook.Secret != "" && !verifySignature(script.Hook.Secret, body, c.Get(signatureHeader)) {
+		entry.Action, entry.Detail = AuditAuthFailed, "invalid webhook signature"
+		recordAudit(entry)
+		return fiber.NewError(fiber.StatusUnauthorized, "invalid signature")
+	}
+	if err := limitRun(c, script); err != nil {
+		return err
+	}
+	recordAudit(entry)
+
+	result, err := runScript(script, RunOptions{Trigger: TriggerWebhook, Stdin: body, Context: c.Context()})
+	if errors.Is(err, errBusy) {
+		return busy(c)
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		c.Status(fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(result)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"build":"green"}`)
+	signature := signPayload("secret", body)
+
+	if !verifySignature("secret", body, signature) {
+		t.Error("Expected valid signature to verify")
+	}
+	if verifySignature("other", body, signature) {
+		t.Error("Expected signature with wrong secret to fail")
+	}
+	if verifySignature("secret", []byte("tampered"), signature) {
+		t.Error("Expected signature over a different body to fail")
+	}
+	if verifySignature("secret", body, "") {
+		t.Error("Expected missing signature to fail")
+	}
+}
+
+func TestNewHook(t *testing.T) {
+	unsigned := newHook(false)
+	if unsigned.Token == "" || unsigned.Secret != "" {
+		t.Errorf("Expected token without secret, got %+v", unsigned)
+	}
+
+	signed := newHook(true)
+	if signed.Token == "" || signed.Secret == "" {
+		t.Errorf("Expected token and secret, got %+v", signed)
+	}
+	if signed.Token == unsigned.Token {
+		t.Error("Expected tokens to be unique")
+	}
+}
+
+func TestFiberRunHook(t *testing.T) {
+	// Setup test directory
+	tmpDir := t.TempDir()
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+
+	// Run scripts with sh so the test does not depend on bun
+	originalRuntime := scriptRuntime
+	scriptRuntime = []string{"sh"}
+	defer func() { scriptRuntime = originalRuntime }()
+
+	err := os.WriteFile(filepath.Join(tmpDir, "echo.js"), []byte("cat"), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	scripts := []Script{
+		{ID: 1, File: "echo.js", Hook: &Hook{Token: "open"}},
+		{ID: 2, File: "echo.js", Hook: &Hook{Token: "signed", Secret: "s3cret"}},
+	}
+	scriptsData, _ := json.MarshalIndent(scripts, "", "\t")
+	err = os.WriteFile(filepath.Join(tmpDir, "scripts.json"), scriptsData, 0644)
+	if err != nil {
+		t.Fatalf("Failed to create scripts.json: %v", err)
+	}
+
+	app := fiber.New()
+	app.Post("/hooks/:token", fiberRunHook)
+
+	payload := []byte(`{"status":"ok"}`)
+	testCases := []struct {
+		name       string
+		token      string
+		signature  string
+		wantStatus int
+	}{
+		{"unknown token", "missing", "", 404},
+		{"unsigned hook", "open", "", 200},
+		{"missing signature", "signed", "", 401},
+		{"bad signature", "signed", signPayload("wrong", payload), 401},
+		{"valid signature", "signed", signPayload("s3cret", payload), 200},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/hooks/"+tc.token, bytes.NewReader(payload))
+			if tc.signature != "" {
+				req.Header.Set(signatureHeader, tc.signature)
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Failed to test request: %v", err)
+			}
+			if resp.StatusCode != tc.wantStatus {
+				t.Fatalf("Expected status code %d, got %d", tc.wantStatus, resp.StatusCode)
+			}
+			if tc.wantStatus != 200 {
+				return
+			}
+
+			var result RunResult
+			if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if result.Stdout != string(payload) {
+				t.Errorf("Expected payload %q on stdout, got %q", payload, result.Stdout)
+			}
+			if result.Trigger != TriggerWebhook {
+				t.Errorf("Expected trigger %q, got %q", TriggerWebhook, result.Trigger)
+			}
+		})
+	}
+}
+
+func TestHookURL(t *testing.T) {
+	defer func() {
+		settings.SetBool("https", true)
+		settings.SetString("bind_address", "")
+		settings.SetString("port", "9212")
+	}()
+
+	testCases := []struct {
+		https bool
+		bind  string
+		want  string
+	}{
+		{true, "", "https://localhost:9212/hooks/abc"},
+		{false, "0.0.0.0", "http://localhost:9212/hooks/abc"},
+		{true, "::1", "https://[::1]:9212/hooks/abc"},
+	}
+	for _, tc := range testCases {
+		settings.SetBool("https", tc.https)
+		settings.SetString("bind_address", tc.bind)
+		if got := hookURL("abc"); got != tc.want {
+			t.Errorf("Expected %q with https %v and bind address %q, got %q", tc.want, tc.https, tc.bind, got)
+		}
+	}
+
+	// A running server reports the address it actually listens on
+	tmpDir := t.TempDir()
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+
+	settings.SetBool("https", false)
+	settings.SetString("bind_address", "127.0.0.1")
+	settings.SetString("port", "0")
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer server.Stop()
+
+	want := "http://" + server.Addrs()[0] + "/hooks/abc"
+	if got := hookURL("abc"); got != want || strings.HasSuffix(got, ":0/hooks/abc") {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxSocketPath is the longest Unix socket path all platforms accept
+const maxSocketPath = 103
+
+// bindAddress returns the address the server binds to. Empty means every
+// interface.
+func bindAddress() string {
+	return settings.String("bind_address")
+}
+
+// unixSocketPath returns the Unix socket the server also listens on, or an
+// empty string if it is turned off
+var unixSocketPath = func() string {
+	return expandHome(settings.String("unix_socket"))
+}
+
+// localAddresses returns the IP addresses of this machine's interfaces
+func localAddresses() []string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			out = append(out, ipNet.IP.String())
+		}
+	}
+	return out
+}
+
+// validatePort checks a port entered in the settings
+func validatePort(port string) error {
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("port must be a number from 1 to 65535, got %q", port)
+	}
+	return nil
+}
+
+// validateBindAddress checks that the server can bind to an address: every
+// interface, localhost or an IP address of one of this machine's interfaces
+func validateBindAddress(addr string) error {
+	if addr == "" || addr == "localhost" {
+		return nil
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return fmt.Errorf("bind address %q is not an IP address", addr)
+	}
+	if ip.IsUnspecified() {
+		return nil
+	}
+	if !slices.ContainsFunc(localAddresses(), func(local string) bool { return net.ParseIP(local).Equal(ip) }) {
+		return fmt.Errorf("bind address %s does not belong to any interface of this machine", addr)
+	}
+	return nil
+}
+
+// validateUnixSocket checks that a Unix socket can be created at path. An
+// existing socket is fine, it is replaced when the server starts.
+func validateUnixSocket(path string) error {
+	if path == "" {
+		return nil
+	}
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("socket path %q must be absolute", path)
+	}
+	if len(path) > maxSocketPath {
+		return fmt.Errorf("socket path must be at most %d characters long", maxSocketPath)
+	}
+	if info, err := os.Stat(filepath.Dir(path)); err != nil || !info.IsDir() {
+		return fmt.Errorf("directory %s does not exist", filepath.Dir(path))
+	}
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	return nil
+}
+
+// listen opens the listener the server is reached on over the network,
+// using TLS unless HTTPS is turned off
+func listen(addr string) (net.Listener, error) {
+	if !useHTTPS() {
+		if authMode() == AuthMTLS {
+			return nil, errors.New("client certificates require HTTPS")
+		}
+		return net.Listen("tcp", addr)
+	}
+
+	config, err := serverTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return tls.NewListener(ln, config), nil
+}
+
+// listenUnix opens a Unix socket only the current user can connect to.
+// A socket left behind by a previous run is removed first.
+func listenUnix(path string) (net.Listener, error) {
+	if err := validateUnixSocket(path); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// Create the socket without permissions for others from the start
+	mask := umask(0177)
+	ln, err := net.Listen("unix", path)
+	umask(mask)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// fromUnixSocket reports whether a request came in over the Unix socket.
+// Only the user running the server can connect to it, so such requests are
+// trusted like the API key.
+func fromUnixSocket(c *fiber.Ctx) bool {
+	_, ok := c.Context().LocalAddr().(*net.UnixAddr)
+	return ok
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidatePort(t *testing.T) {
+	testCases := []struct {
+		port    string
+		wantErr bool
+	}{
+		{"9212", false},
+		{"1", false},
+		{"65535", false},
+		{"", true},
+		{"0", true},
+		{"65536", true},
+		{"http", true},
+		{" 9212", true},
+	}
+
+	for _, tc := range testCases {
+		if err := validatePort(tc.port); (err != nil) != tc.wantErr {
+			t.Errorf("validatePort(%q) error = %v, wantErr %v", tc.port, err, tc.wantErr)
+		}
+	}
+}
+
+func TestValidateBindAddress(t *testing.T) {
+	testCases := []struct {
+		addr    string
+		wantErr bool
+	}{
+		{"", false},
+		{"localhost", false},
+		{"127.0.0.1", false},
+		{"::", false},
+		{"example.com", true},
+		{"192.0.2.1", true},
+	}
+
+	for _, tc := range testCases {
+		if err := validateBindAddress(tc.addr); (err != nil) != tc.wantErr {
+			t.Errorf("validateBindAddress(%q) error = %v, wantErr %v", tc.addr, err, tc.wantErr)
+		}
+	}
+}
+
+func TestValidateUnixSocket(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	testCases := []struct {
+		path    string
+		wantErr bool
+	}{
+		{"", false},
+		{filepath.Join(tmpDir, "opendeck.sock"), false},
+		{"opendeck.sock", true},
+		{filepath.Join(tmpDir, "missing", "opendeck.sock"), true},
+		{file, true},
+	}
+
+	for _, tc := range testCases {
+		if err := validateUnixSocket(tc.path); (err != nil) != tc.wantErr {
+			t.Errorf("validateUnixSocket(%q) error = %v, wantErr %v", tc.path, err, tc.wantErr)
+		}
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	// Setup test directory
+	tmpDir := t.TempDir()
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+	originalDataPath := getDataPath
+	getDataPath = func() string { return tmpDir }
+	defer func() { getDataPath = originalDataPath }()
+
+	socket := filepath.Join(tmpDir, "opendeck.sock")
+	originalSocket := unixSocketPath
+	unixSocketPath = func() string { return socket }
+	defer func() { unixSocketPath = originalSocket }()
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "test.js"), []byte("console.log('test')"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	scriptsData, _ := json.MarshalIndent([]Script{{ID: 1, File: "test.js"}}, "", "\t")
+	if err := os.WriteFile(filepath.Join(tmpDir, "scripts.json"), scriptsData, 0644); err != nil {
+		t.Fatalf("Failed to create scripts.json: %v", err)
+	}
+
+	// A stale socket from a previous run is replaced
+	stale, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Failed to create stale socket: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	s := &Server{}
+	if err := s.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer s.Stop()
+
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatalf("Expected socket to exist: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected socket mode 0600, got %o", info.Mode().Perm())
+	}
+
+	// Requests over the socket need no token
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	for _, path := range []string{"/api/v1/scripts", "/api/v1/scripts/1/document"} {
+		resp, err := client.Get("http://opendeck" + path)
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s: expected status 200, got %d", path, resp.StatusCode)
+		}
+	}
+}
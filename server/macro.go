@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Task types
+const (
+	TypeScript = ""
+	TypeMacro  = "macro"
+)
+
+// Macro step types
+const (
+	StepScript = "script"
+	StepDelay  = "delay"
+	StepHTTP   = "http"
+	StepSet    = "set"
+	StepAction = "action"
+)
+
+// Step conditions on the exit code of the previous step
+const (
+	IfAlways  = ""
+	IfSuccess = "success"
+	IfFailure = "failure"
+)
+
+// maxMacroDepth limits how deeply macros may run other macros
+const maxMacroDepth = 8
+
+// maxStepOutput caps the output kept for a single step
+const maxStepOutput = 4096
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// MacroStep is a single step of a macro
+type MacroStep struct {
+	Type string `json:"type"`
+	// If makes the step depend on the exit code of the previous step
+	If string `json:"if,omitempty"`
+
+	// ScriptID is the script run by script steps
+	ScriptID int `json:"script,omitempty"`
+	// Duration is the wait of delay steps, e.g. "500ms"
+	Duration string `json:"duration,omitempty"`
+	// Method, URL, Body and Headers describe the request of http steps.
+	// URL and Body are templates.
+	Method  string            `json:"method,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Name and Value are the variable set by set steps. Value is a template.
+	Name  string `json:"name,omitempty"`
+	Value string `json:"value,omitempty"`
+	// Action and Params select the native action run by action steps
+	Action string            `json:"action,omitempty"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// StepResult records the outcome of a single macro step
+type StepResult struct {
+	Index    int           `json:"index"`
+	Type     string        `json:"type"`
+	Skipped  bool          `json:"skipped,omitempty"`
+	ExitCode int           `json:"exitCode"`
+	Output   string        `json:"output,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// validateMacro checks the steps of macro for errors that can be found
+// before running it
+func validateMacro(macro Script, scripts []Script) error {
+	if len(macro.Steps) == 0 {
+		return errors.New("macro has no steps")
+	}
+
+	var errs []error
+	for i, step := range macro.Steps {
+		if err := validateStep(step, macro.ID, scripts); err != nil {
+			errs = append(errs, fmt.Errorf("step %d: %w", i+1, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func validateStep(step MacroStep, macroID int, scripts []Script) error {
+	switch step.If {
+	case IfAlways, IfSuccess, IfFailure:
+	default:
+		return fmt.Errorf("unknown condition %q", step.If)
+	}
+
+	switch step.Type {
+	case StepScript:
+		if step.ScriptID == macroID {
+			return errors.New("macro cannot run itself")
+		}
+		if !slices.ContainsFunc(scripts, func(s Script) bool { return s.ID == step.ScriptID }) {
+			return fmt.Errorf("script %d does not exist", step.ScriptID)
+		}
+	case StepDelay:
+		if _, err := time.ParseDuration(step.Duration); err != nil {
+			return fmt.Errorf("invalid delay: %w", err)
+		}
+	case StepHTTP:
+		if step.URL == "" {
+			return errors.New("missing URL")
+		}
+	case StepSet:
+		if step.Name == "" {
+			return errors.New("missing variable name")
+		}
+	case StepAction:
+		return validateAction(step.Action, step.Params)
+	default:
+		return fmt.Errorf("unknown step type %q", step.Type)
+	}
+	return nil
+}
+
+// runMacro runs the steps of a macro in order and fills in result. The
+// macro's exit code and output are those of the last step that ran.
+func runMacro(macro Script, opts RunOptions, result *RunResult) error {
+	if opts.depth >= maxMacroDepth {
+		result.ExitCode = -1
+		result.Error = fmt.Sprintf("macros nested deeper than %d levels", maxMacroDepth)
+		return errors.New(result.Error)
+	}
+
+	start := time.Now()
+	defer func() { result.Duration = time.Since(start) }()
+
+	prev := StepResult{}
+	for i, step := range macro.Steps {
+		res := StepResult{Index: i, Type: step.Type}
+
+		if (step.If == IfSuccess && prev.ExitCode != 0) || (step.If == IfFailure && prev.ExitCode == 0) {
+			res.Skipped = true
+			result.Steps = append(result.Steps, res)
+			continue
+		}
+
+		stepStart := time.Now()
+		runStep(step, prev, opts, &res)
+		res.Duration = time.Since(stepStart)
+		result.Steps = append(result.Steps, res)
+
+		prev.ExitCode = res.ExitCode
+		prev.Output = res.Output
+	}
+
+	result.ExitCode = prev.ExitCode
+	result.Stdout = prev.Output
+	if prev.ExitCode != 0 {
+		result.Error = fmt.Sprintf("macro finished with exit code %d", prev.ExitCode)
+		return errors.New(result.Error)
+	}
+	return nil
+}
+
+// runStep runs a single macro step. Delay and set steps pass on the exit
+// code and output of the previous step so conditions can look past them.
+func runStep(step MacroStep, prev StepResult, opts RunOptions, res *StepResult) {
+	fail := func(err error) {
+		res.ExitCode = 1
+		res.Error = err.Error()
+	}
+
+	data := TemplateData{Vars: getVariables(), ExitCode: prev.ExitCode, Output: prev.Output}
+
+	switch step.Type {
+	case StepScript:
+		scripts := getScripts()
+		idx := slices.IndexFunc(scripts, func(s Script) bool { return s.ID == step.ScriptID })
+		if idx < 0 {
+			fail(fmt.Errorf("script %d does not exist", step.ScriptID))
+			return
+		}
+		child, err := runScript(scripts[idx], RunOptions{Trigger: TriggerMacro, Stdout: opts.Stdout, Stderr: opts.Stderr, Context: opts.Context, depth: opts.depth + 1})
+		res.ExitCode = child.ExitCode
+		res.Output = truncate(child.Stdout, maxStepOutput)
+		if err != nil {
+			res.Error = err.Error()
+			if res.ExitCode == 0 {
+				res.ExitCode = 1
+			}
+		}
+
+	case StepDelay:
+		d, err := time.ParseDuration(step.Duration)
+		if err != nil {
+			fail(err)
+			return
+		}
+		time.Sleep(d)
+		res.ExitCode, res.Output = prev.ExitCode, prev.Output
+
+	case StepHTTP:
+		params := map[string]string{
+			"method":  step.Method,
+			"url":     step.URL,
+			"body":    step.Body,
+			"headers": formatHeaders(step.Headers),
+		}
+		output, err := runActionParams("http", params, data)
+		res.Output = truncate(output, maxStepOutput)
+		if err != nil {
+			fail(err)
+		}
+
+	case StepSet:
+		params := map[string]string{"name": step.Name, "value": step.Value}
+		if _, err := runActionParams("set-variable", params, data); err != nil {
+			fail(err)
+			return
+		}
+		res.ExitCode, res.Output = prev.ExitCode, prev.Output
+
+	case StepAction:
+		output, err := runActionParams(step.Action, step.Params, data)
+		res.Output = truncate(strings.TrimSpace(output), maxStepOutput)
+		if err != nil {
+			fail(err)
+		}
+
+	default:
+		fail(fmt.Errorf("unknown step type %q", step.Type))
+	}
+}
+
+// doHTTPRequest sends a request and returns the status code and response body
+func doHTTPRequest(method, url, body string, headers map[string]string) (int, string, error) {
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid request: %w", err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxStepOutput))
+	if err != nil {
+		return resp.StatusCode, "", err
+	}
+	return resp.StatusCode, strings.TrimSpace(string(respBody)), nil
+}
+
+// formatHeaders writes headers as "Key: Value" lines
+func formatHeaders(headers map[string]string) string {
+	var lines []string
+	for k, v := range headers {
+		lines = append(lines, k+": "+v)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
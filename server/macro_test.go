@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateMacro(t *testing.T) {
+	scripts := []Script{{ID: 1, File: "test.js"}}
+
+	testCases := []struct {
+		name    string
+		steps   []MacroStep
+		wantErr bool
+	}{
+		{"valid", []MacroStep{
+			{Type: StepScript, ScriptID: 1},
+			{Type: StepDelay, Duration: "250ms"},
+			{Type: StepHTTP, URL: "http://localhost/hook", If: IfFailure},
+			{Type: StepSet, Name: "status", Value: "{{.Output}}", If: IfSuccess},
+		}, false},
+		{"no steps", nil, true},
+		{"unknown script", []MacroStep{{Type: StepScript, ScriptID: 5}}, true},
+		{"runs itself", []MacroStep{{Type: StepScript, ScriptID: 10}}, true},
+		{"bad delay", []MacroStep{{Type: StepDelay, Duration: "soon"}}, true},
+		{"missing url", []MacroStep{{Type: StepHTTP}}, true},
+		{"missing variable", []MacroStep{{Type: StepSet}}, true},
+		{"unknown condition", []MacroStep{{Type: StepDelay, Duration: "1s", If: "maybe"}}, true},
+		{"unknown type", []MacroStep{{Type: "launch"}}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			macro := Script{ID: 10, Type: TypeMacro, Title: "macro", Steps: tc.steps}
+			err := validateMacro(macro, scripts)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("validateMacro() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunMacro(t *testing.T) {
+	// Setup test directory
+	tmpDir := t.TempDir()
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+	originalDataPath := getDataPath
+	getDataPath = func() string { return tmpDir }
+	defer func() { getDataPath = originalDataPath }()
+
+	// Run scripts with sh so the test does not depend on bun
+	originalRuntime := scriptRuntime
+	scriptRuntime = []string{"sh"}
+	defer func() { scriptRuntime = originalRuntime }()
+
+	files := map[string]string{
+		"ok.js":   "echo ok",
+		"fail.js": "echo failed; exit 3",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	var received string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		w.Write([]byte("delivered"))
+	}))
+	defer srv.Close()
+
+	macro := Script{ID: 3, Type: TypeMacro, Title: "chain", Steps: []MacroStep{
+		{Type: StepScript, ScriptID: 2},
+		{Type: StepDelay, Duration: "1ms"},
+		{Type: StepSet, Name: "last", Value: "{{.Output}} ({{.ExitCode}})"},
+		{Type: StepScript, ScriptID: 1, If: IfSuccess},
+		{Type: StepHTTP, Method: "POST", URL: srv.URL, Body: `{"status":"{{.Vars.last}}"}`, If: IfFailure},
+	}}
+	scripts := []Script{{ID: 1, File: "ok.js"}, {ID: 2, File: "fail.js"}, macro}
+	scriptsData, _ := json.MarshalIndent(scripts, "", "\t")
+	if err := os.WriteFile(filepath.Join(tmpDir, "scripts.json"), scriptsData, 0644); err != nil {
+		t.Fatalf("Failed to create scripts.json: %v", err)
+	}
+
+	result, err := runScript(macro, RunOptions{Trigger: TriggerClient})
+	if err != nil {
+		t.Fatalf("Expected macro to succeed, got %v", err)
+	}
+
+	if len(result.Steps) != 5 {
+		t.Fatalf("Expected 5 step results, got %d", len(result.Steps))
+	}
+	if result.Steps[0].ExitCode != 3 {
+		t.Errorf("Expected first step to exit with 3, got %d", result.Steps[0].ExitCode)
+	}
+	if result.Steps[2].ExitCode != 3 {
+		t.Errorf("Expected set step to pass on the exit code, got %d", result.Steps[2].ExitCode)
+	}
+	if !result.Steps[3].Skipped {
+		t.Error("Expected success-only step to be skipped")
+	}
+	if result.Steps[4].Skipped || result.Steps[4].ExitCode != 0 {
+		t.Errorf("Expected failure-only HTTP step to run, got %+v", result.Steps[4])
+	}
+
+	if got := getVariables()["last"]; got != "failed (3)" {
+		t.Errorf("Expected variable last to be %q, got %q", "failed (3)", got)
+	}
+	if received != `{"status":"failed (3)"}` {
+		t.Errorf("Unexpected HTTP body %q", received)
+	}
+	if result.Stdout != "delivered" {
+		t.Errorf("Expected macro output from last step, got %q", result.Stdout)
+	}
+
+	history := getRunHistory(func(r RunResult) bool { return r.ScriptID == 3 })
+	if len(history) == 0 || len(history[0].Steps) != 5 {
+		t.Error("Expected macro run with steps in the run history")
+	}
+}
+
+func TestRunMacroNestingLimit(t *testing.T) {
+	// Setup test directory
+	tmpDir := t.TempDir()
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+
+	// Two macros that run each other
+	scripts := []Script{
+		{ID: 1, Type: TypeMacro, Title: "ping", Steps: []MacroStep{{Type: StepScript, ScriptID: 2}}},
+		{ID: 2, Type: TypeMacro, Title: "pong", Steps: []MacroStep{{Type: StepScript, ScriptID: 1}}},
+	}
+	scriptsData, _ := json.MarshalIndent(scripts, "", "\t")
+	if err := os.WriteFile(filepath.Join(tmpDir, "scripts.json"), scriptsData, 0644); err != nil {
+		t.Fatalf("Failed to create scripts.json: %v", err)
+	}
+
+	if _, err := runScript(scripts[0], RunOptions{Trigger: TriggerClient}); err == nil {
+		t.Error("Expected nested macros to fail")
+	}
+}
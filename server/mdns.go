@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/grandcat/zeroconf"
+)
+
+// mdnsService is the DNS-SD service type servers are advertised as
+const mdnsService = "_opendeck._tcp"
+
+// useMDNS reports whether the server is advertised on the local network
+var useMDNS = func() bool {
+	return settings.BoolWithFallback("mdns", true)
+}
+
+// serverName is the name the server is advertised with
+func serverName() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		return "OpenDeck"
+	}
+	return name
+}
+
+// mdnsText returns the TXT records clients read the server's name, API
+// version and scheme from
+func mdnsText() []string {
+	scheme := "http"
+	if useHTTPS() {
+		scheme = "https"
+	}
+	return []string{"name=" + serverName(), "version=" + apiVersion, "scheme=" + scheme}
+}
+
+// advertise announces the server listening on addr via mDNS. Servers bound
+// to a loopback address are not reachable from other devices and are not
+// advertised.
+func advertise(addr string) (*zeroconf.Server, error) {
+	host, portText, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil, nil
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q: %w", portText, err)
+	}
+	return zeroconf.Register(serverName(), mdnsService, "local.", port, mdnsText(), nil)
+}
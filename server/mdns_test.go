@@ -0,0 +1,27 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAdvertise(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1:9212", "[::1]:9212"} {
+		mdns, err := advertise(addr)
+		if err != nil || mdns != nil {
+			t.Errorf("Expected loopback address %s not to be advertised, got %v", addr, err)
+		}
+	}
+	if _, err := advertise("9212"); err == nil {
+		t.Error("Expected an error for an address without a port")
+	}
+}
+
+func TestMDNSText(t *testing.T) {
+	text := mdnsText()
+	for _, want := range []string{"version=" + apiVersion, "name=" + serverName()} {
+		if !slices.Contains(text, want) {
+			t.Errorf("Expected TXT record %q, got %q", want, text)
+		}
+	}
+}
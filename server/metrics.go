@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// durationBuckets are the upper bounds in seconds of the run duration
+// histogram
+var durationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// scriptMetrics holds the run statistics of a single task
+type scriptMetrics struct {
+	name string
+	// runs counts finished runs per trigger
+	runs     map[string]uint64
+	failures uint64
+	skipped  uint64
+	// buckets counts runs per duration bucket, not cumulative
+	buckets     []uint64
+	durationSum float64
+}
+
+var (
+	metricsMu  sync.Mutex
+	runMetrics = map[int]*scriptMetrics{}
+)
+
+// observeRun adds a run to the metrics
+func observeRun(result RunResult) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	m, ok := runMetrics[result.ScriptID]
+	if !ok {
+		m = &scriptMetrics{runs: map[string]uint64{}, buckets: make([]uint64, len(durationBuckets)+1)}
+		runMetrics[result.ScriptID] = m
+	}
+	m.name = result.Script
+
+	if result.Skipped {
+		m.skipped++
+		return
+	}
+	m.runs[result.Trigger]++
+	if result.ExitCode != 0 || result.Error != "" {
+		m.failures++
+	}
+	seconds := result.Duration.Seconds()
+	m.durationSum += seconds
+	m.buckets[sort.SearchFloat64s(durationBuckets, seconds)]++
+}
+
+// activeRunCount returns the number of runs in progress
+func activeRunCount() int {
+	activeMu.Lock()
+	defer activeMu.Unlock()
+	n := 0
+	for _, runs := range activeRuns {
+		n += runs
+	}
+	return n
+}
+
+// subscriberCount returns the number of clients connected to the event
+// stream
+func subscriberCount() int {
+	return int(connectedClients.Load())
+}
+
+// labelValue escapes a Prometheus label value
+func labelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// formatFloat formats a sample value the way Prometheus expects
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// writeMetrics writes all metrics in the Prometheus text format
+func writeMetrics(w io.Writer) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	ids := make([]int, 0, len(runMetrics))
+	for id := range runMetrics {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	labels := func(id int) string {
+		return fmt.Sprintf(`script_id="%d",script="%s"`, id, labelValue(runMetrics[id].name))
+	}
+
+	fmt.Fprintln(w, "# HELP opendeck_runs_total Finished task runs.")
+	fmt.Fprintln(w, "# TYPE opendeck_runs_total counter")
+	for _, id := range ids {
+		triggers := make([]string, 0, len(runMetrics[id].runs))
+		for trigger := range runMetrics[id].runs {
+			triggers = append(triggers, trigger)
+		}
+		sort.Strings(triggers)
+		for _, trigger := range triggers {
+			fmt.Fprintf(w, "opendeck_runs_total{%s,trigger=\"%s\"} %d\n", labels(id), labelValue(trigger), runMetrics[id].runs[trigger])
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP opendeck_run_failures_total Task runs that failed or exited with a non-zero code.")
+	fmt.Fprintln(w, "# TYPE opendeck_run_failures_total counter")
+	for _, id := range ids {
+		fmt.Fprintf(w, "opendeck_run_failures_total{%s} %d\n", labels(id), runMetrics[id].failures)
+	}
+
+	fmt.Fprintln(w, "# HELP opendeck_runs_skipped_total Task runs skipped because the task was already running.")
+	fmt.Fprintln(w, "# TYPE opendeck_runs_skipped_total counter")
+	for _, id := range ids {
+		fmt.Fprintf(w, "opendeck_runs_skipped_total{%s} %d\n", labels(id), runMetrics[id].skipped)
+	}
+
+	fmt.Fprintln(w, "# HELP opendeck_run_duration_seconds Duration of task runs.")
+	fmt.Fprintln(w, "# TYPE opendeck_run_duration_seconds histogram")
+	for _, id := range ids {
+		m := runMetrics[id]
+		var count uint64
+		for i, bound := range durationBuckets {
+			count += m.buckets[i]
+			fmt.Fprintf(w, "opendeck_run_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels(id), formatFloat(bound), count)
+		}
+		count += m.buckets[len(durationBuckets)]
+		fmt.Fprintf(w, "opendeck_run_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels(id), count)
+		fmt.Fprintf(w, "opendeck_run_duration_seconds_sum{%s} %s\n", labels(id), formatFloat(m.durationSum))
+		fmt.Fprintf(w, "opendeck_run_duration_seconds_count{%s} %d\n", labels(id), count)
+	}
+
+	fmt.Fprintln(w, "# HELP opendeck_active_runs Task runs in progress.")
+	fmt.Fprintln(w, "# TYPE opendeck_active_runs gauge")
+	fmt.Fprintf(w, "opendeck_active_runs %d\n", activeRunCount())
+
+	fmt.Fprintln(w, "# HELP opendeck_processes Child processes running, scripts and action commands.")
+	fmt.Fprintln(w, "# TYPE opendeck_processes gauge")
+	fmt.Fprintf(w, "opendeck_processes %d\n", processes.count())
+
+	fmt.Fprintln(w, "# HELP opendeck_runs_rate_limited_total Run requests rejected by rate limits.")
+	fmt.Fprintln(w, "# TYPE opendeck_runs_rate_limited_total counter")
+	fmt.Fprintf(w, "opendeck_runs_rate_limited_total %d\n", runLimiter.limitedCount())
+
+	fmt.Fprintln(w, "# HELP opendeck_connected_clients Clients connected to the event stream.")
+	fmt.Fprintln(w, "# TYPE opendeck_connected_clients gauge")
+	fmt.Fprintf(w, "opendeck_connected_clients %d\n", subscriberCount())
+
+	fmt.Fprintln(w, "# HELP opendeck_paired_clients Paired clients.")
+	fmt.Fprintln(w, "# TYPE opendeck_paired_clients gauge")
+	fmt.Fprintf(w, "opendeck_paired_clients %d\n", len(getClients()))
+}
+
+// fiberMetrics serves the metrics in the Prometheus text format
+func fiberMetrics(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	writeMetrics(c)
+	return nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// fakeRuntime creates a script runtime that prints its version and runs
+// scripts with sh, so tests do not depend on bun
+func fakeRuntime(t *testing.T, script string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "bun")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatalf("Failed to create runtime: %v", err)
+	}
+	return path
+}
+
+func TestWriteMetrics(t *testing.T) {
+	originalMetrics := runMetrics
+	runMetrics = map[int]*scriptMetrics{}
+	defer func() { runMetrics = originalMetrics }()
+
+	observeRun(RunResult{ScriptID: 1, Script: `say "hi"`, Trigger: TriggerClient, Duration: 200 * time.Millisecond})
+	observeRun(RunResult{ScriptID: 1, Script: `say "hi"`, Trigger: TriggerSchedule, Duration: 3 * time.Second, ExitCode: 1})
+	observeRun(RunResult{ScriptID: 1, Script: `say "hi"`, Trigger: TriggerSchedule, Skipped: true})
+
+	// Subscribers within the server, like the MQTT bridge, are no clients
+	events := subscribe()
+	defer unsubscribe(events)
+
+	var sb strings.Builder
+	writeMetrics(&sb)
+	out := sb.String()
+
+	labels := `script_id="1",script="say \"hi\""`
+	for _, want := range []string{
+		`opendeck_runs_total{` + labels + `,trigger="client"} 1`,
+		`opendeck_runs_total{` + labels + `,trigger="schedule"} 1`,
+		`opendeck_run_failures_total{` + labels + `} 1`,
+		`opendeck_runs_skipped_total{` + labels + `} 1`,
+		`opendeck_run_duration_seconds_bucket{` + labels + `,le="0.25"} 1`,
+		`opendeck_run_duration_seconds_bucket{` + labels + `,le="2.5"} 1`,
+		`opendeck_run_duration_seconds_bucket{` + labels + `,le="5"} 2`,
+		`opendeck_run_duration_seconds_bucket{` + labels + `,le="+Inf"} 2`,
+		`opendeck_run_duration_seconds_sum{` + labels + `} 3.2`,
+		`opendeck_run_duration_seconds_count{` + labels + `} 2`,
+		"opendeck_active_runs 0",
+		"opendeck_connected_clients 0",
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestHealthAndMetricsRoutes(t *testing.T) {
+	// Setup test directory
+	tmpDir := t.TempDir()
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+	originalDataPath := getDataPath
+	getDataPath = func() string { return tmpDir }
+	defer func() { getDataPath = originalDataPath }()
+	originalKey := getAPIKey
+	getAPIKey = func() string { return "test-key" }
+	defer func() { getAPIKey = originalKey }()
+	originalRuntime := scriptRuntime
+	defer func() { scriptRuntime = originalRuntime }()
+
+	app := newFiberApp()
+	get := func(path string, key string) (int, string) {
+		req := httptest.NewRequest("GET", path, nil)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	working := fakeRuntime(t, `[ "$1" = --version ] && echo 1.1.0`)
+	scriptRuntime = []string{working}
+	if status, body := get("/healthz", ""); status != fiber.StatusOK {
+		t.Errorf("Expected healthy server, got %d: %s", status, body)
+	}
+
+	originalTimeout := runtimeCheckTimeout
+	runtimeCheckTimeout = 100 * time.Millisecond
+	defer func() { runtimeCheckTimeout = originalTimeout }()
+	for name, runtime := range map[string]string{
+		"missing": "opendeck-missing-runtime",
+		"broken":  fakeRuntime(t, "echo 'cannot execute binary file' >&2; exit 126"),
+		"hanging": fakeRuntime(t, "exec sleep 10"),
+	} {
+		scriptRuntime = []string{runtime}
+		if status, body := get("/healthz", ""); status != fiber.StatusServiceUnavailable || !strings.Contains(body, "unhealthy") {
+			t.Errorf("Expected %s runtime to be unhealthy, got %d: %s", name, status, body)
+		}
+	}
+
+	// Scripts cannot be saved when the scripts path is not a directory
+	scriptRuntime = []string{working}
+	notDir := filepath.Join(tmpDir, "scripts.txt")
+	if err := os.WriteFile(notDir, nil, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	getScriptsPath = func() string { return notDir }
+	if status, _ := get("/healthz", ""); status != fiber.StatusServiceUnavailable {
+		t.Errorf("Expected unwritable scripts directory to be unhealthy, got %d", status)
+	}
+
+	// Ready once listening with the scheduler started
+	if status, body := get("/readyz", ""); status != fiber.StatusServiceUnavailable || !strings.Contains(body, "not ready") {
+		t.Errorf("Expected a stopped server not to be ready, got %d: %s", status, body)
+	}
+	getScriptsPath = func() string { return tmpDir }
+	scheduler.Start()
+	defer scheduler.Stop()
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer server.Stop()
+	if status, body := get("/readyz", ""); status != fiber.StatusOK {
+		t.Errorf("Expected the server to be ready, got %d: %s", status, body)
+	}
+
+	if status, _ := get("/metrics", ""); status != fiber.StatusUnauthorized {
+		t.Errorf("Expected metrics to require the API key, got %d", status)
+	}
+	if status, body := get("/metrics", "test-key"); status != fiber.StatusOK || !strings.Contains(body, "opendeck_active_runs") {
+		t.Errorf("Expected metrics, got %d: %s", status, body)
+	}
+}
+
+func TestHealthChecksAreLimited(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+	originalRuntime := scriptRuntime
+	defer func() { scriptRuntime = originalRuntime }()
+	originalLimiter := healthLimiter
+	healthLimiter = &rateLimiter{buckets: map[string]*bucket{}}
+	defer func() { healthLimiter = originalLimiter }()
+
+	// The runtime records every start
+	starts := filepath.Join(tmpDir, "starts")
+	scriptRuntime = []string{fakeRuntime(t, `echo >> "`+starts+`"; echo 1.1.0`)}
+
+	app := newFiberApp()
+	get := func(path string) *http.Response {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		return resp
+	}
+
+	for range 3 {
+		if resp := get("/healthz"); resp.StatusCode != fiber.StatusOK {
+			t.Fatalf("Expected healthy server, got %d", resp.StatusCode)
+		}
+	}
+	if data, _ := os.ReadFile(starts); len(data) != 1 {
+		t.Errorf("Expected the runtime to be started once, got %d", len(data))
+	}
+
+	// Every address has a budget of checks per minute
+	for range healthCheckLimit - 4 {
+		get("/readyz")
+	}
+	if resp := get("/readyz"); resp.StatusCode != fiber.StatusServiceUnavailable {
+		t.Errorf("Expected the last check within the limit to be answered, got %d", resp.StatusCode)
+	}
+	resp := get("/healthz")
+	if resp.StatusCode != fiber.StatusTooManyRequests || resp.Header.Get(fiber.HeaderRetryAfter) == "" {
+		t.Errorf("Expected status 429 with Retry-After, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// mqttTimeout is how long publishing may take when the bridge stops
+const mqttTimeout = 5 * time.Second
+
+// mqttRetryInterval is the wait between attempts to reach the broker until
+// the bridge connected the first time. Later it reconnects by itself.
+var mqttRetryInterval = 10 * time.Second
+
+// MQTT bridge topics below the configured prefix. Task topics are
+// tasks/<id>/<name>.
+const (
+	// mqttStatusTopic is "online" while the bridge is connected and
+	// "offline" otherwise, it is retained
+	mqttStatusTopic = "status"
+	// mqttStateTopic holds the retained button state of a task
+	mqttStateTopic = "state"
+	// mqttRunTopic receives the run.started and run.finished events of a
+	// task
+	mqttRunTopic = "run"
+	// mqttTriggerTopic runs a task, the payload is passed on stdin. Tasks
+	// can be addressed by ID or slug.
+	mqttTriggerTopic = "trigger"
+)
+
+// mqttBroker returns the broker URL, the bridge is off if it is empty
+func mqttBroker() string {
+	return settings.String("mqtt_broker")
+}
+
+// mqttPrefix returns the prefix of all topics
+func mqttPrefix() string {
+	if prefix := strings.Trim(settings.String("mqtt_prefix"), "/"); prefix != "" {
+		return prefix
+	}
+	return "opendeck"
+}
+
+// validateMQTTBroker checks a broker URL, which may be empty
+func validateMQTTBroker(broker string) error {
+	if broker == "" {
+		return nil
+	}
+	u, err := url.Parse(broker)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid MQTT broker %q, expected e.g. tcp://localhost:1883", broker)
+	}
+	switch u.Scheme {
+	case "tcp", "mqtt", "ssl", "tls", "mqtts", "ws", "wss":
+		return nil
+	}
+	return fmt.Errorf("unsupported MQTT broker scheme %q", u.Scheme)
+}
+
+// taskTopic returns the topic name of a task
+func taskTopic(prefix string, id int, name string) string {
+	return fmt.Sprintf("%s/tasks/%d/%s", prefix, id, name)
+}
+
+// mqttMessage returns the message an event is published as. Only run
+// events and button states are published.
+func mqttMessage(prefix string, e Event) (topic string, payload []byte, retained bool, ok bool) {
+	switch e.Type {
+	case EventButtonState:
+		return taskTopic(prefix, e.ScriptID, mqttStateTopic), []byte(e.State), true, true
+	case EventRunStarted, EventRunFinished:
+		payload, err := json.Marshal(e)
+		if err != nil {
+			return "", nil, false, false
+		}
+		return taskTopic(prefix, e.ScriptID, mqttRunTopic), payload, false, true
+	}
+	return "", nil, false, false
+}
+
+// taskFromTopic resolves the task of a trigger topic by ID or slug
+func taskFromTopic(prefix, topic string, scripts []Script) (Script, error) {
+	rest, ok := strings.CutPrefix(topic, prefix+"/tasks/")
+	if !ok {
+		return Script{}, fmt.Errorf("unexpected topic %q", topic)
+	}
+	name, ok := strings.CutSuffix(rest, "/"+mqttTriggerTopic)
+	if !ok || name == "" || strings.Contains(name, "/") {
+		return Script{}, fmt.Errorf("unexpected topic %q", topic)
+	}
+
+	if id, err := strconv.Atoi(name); err == nil {
+		if script, ok := findScriptByID(scripts, id); ok {
+			return script, nil
+		}
+	}
+	for id, slug := range assignSlugs(scripts) {
+		if slug == name {
+			script, _ := findScriptByID(scripts, id)
+			return script, nil
+		}
+	}
+	return Script{}, fmt.Errorf("task %q not found", name)
+}
+
+// mqttTrigger runs the task addressed by a trigger topic. The broker
+// controls who may publish, every task can be triggered. Triggers share the
+// rate limit of a single client.
+func mqttTrigger(prefix, topic string, payload []byte) {
+	script, err := taskFromTopic(prefix, topic, getScripts())
+	if err != nil {
+		fmt.Println("MQTT:", err)
+		return
+	}
+	if _, ok := runLimiter.allow(actorMQTT, script.ID, time.Now()); !ok {
+		fmt.Printf("MQTT: too many runs of %s, ignoring trigger\n", script.Name())
+		return
+	}
+	recordAudit(AuditEntry{Action: AuditRun, Client: actorMQTT}.withScript(script))
+	if _, err := runScript(script, RunOptions{Trigger: TriggerMQTT, Stdin: payload}); err != nil {
+		fmt.Println("Error:", err)
+	}
+}
+
+// MQTTBridge publishes events to an MQTT broker and runs tasks on
+// messages to their trigger topics
+type MQTTBridge struct {
+	mu     sync.Mutex
+	client mqtt.Client
+	prefix string
+	// stop ends forwarding events
+	stop chan struct{}
+	err  error
+}
+
+// bridge is the MQTT bridge of this process
+var bridge = &MQTTBridge{}
+
+// Start connects to the configured broker in the background, retrying until
+// the broker can be reached. It does nothing if no broker is set. Whether
+// the bridge is connected is reported by Status.
+func (b *MQTTBridge) Start() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	broker := mqttBroker()
+	b.err = nil
+	if b.client != nil || broker == "" {
+		return nil
+	}
+	if err := validateMQTTBroker(broker); err != nil {
+		b.err = err
+		return err
+	}
+
+	prefix := mqttPrefix()
+	statusTopic := prefix + "/" + mqttStatusTopic
+	opts := mqtt.NewClientOptions().
+		AddBroker(broker).
+		SetClientID("opendeck-"+serverName()).
+		SetUsername(settings.String("mqtt_username")).
+		SetPassword(settings.String("mqtt_password")).
+		SetWill(statusTopic, "offline", 1, true).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(mqttRetryInterval).
+		SetOnConnectHandler(func(c mqtt.Client) {
+			// Subscriptions and retained states are set up again on every
+			// reconnect
+			c.Publish(statusTopic, 1, true, "online")
+			for _, s := range getScripts() {
+				state := ButtonIdle
+				if isRunning(s.ID) {
+					state = ButtonRunning
+				}
+				c.Publish(taskTopic(prefix, s.ID, mqttStateTopic), 1, true, state)
+			}
+			c.Subscribe(prefix+"/tasks/+/"+mqttTriggerTopic, 1, func(_ mqtt.Client, m mqtt.Message) {
+				go mqttTrigger(prefix, m.Topic(), m.Payload())
+			})
+		}).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			fmt.Println("MQTT connection lost:", err)
+		})
+
+	// Events are received from before connecting, so none are missed
+	// between publishing the retained states and forwarding
+	events := subscribe()
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+
+	b.client, b.prefix, b.stop = client, prefix, make(chan struct{})
+	go b.forward(client, prefix, events, b.stop)
+	go func() {
+		// With retries the token only completes once connected, or with an
+		// error if the bridge stopped first
+		if token.Wait(); token.Error() != nil {
+			fmt.Println("MQTT:", token.Error())
+		}
+	}()
+	return nil
+}
+
+// forward publishes events until stop is closed. While disconnected events
+// are dropped, connecting publishes the current states again.
+func (b *MQTTBridge) forward(client mqtt.Client, prefix string, events chan Event, stop chan struct{}) {
+	defer func() { unsubscribe(events) }()
+	for {
+		select {
+		case <-stop:
+			return
+		case e, ok := <-events:
+			if !ok {
+				// Dropped for falling behind, states may be stale
+				// until the next change
+				events = subscribe()
+				continue
+			}
+			if !client.IsConnectionOpen() {
+				continue
+			}
+			if topic, payload, retained, ok := mqttMessage(prefix, e); ok {
+				client.Publish(topic, 1, retained, payload)
+			}
+		}
+	}
+}
+
+// Stop disconnects from the broker, marking the server offline
+func (b *MQTTBridge) Stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.client == nil {
+		return
+	}
+	close(b.stop)
+	// Disconnecting cleanly does not publish the will
+	if b.client.IsConnectionOpen() {
+		b.client.Publish(b.prefix+"/"+mqttStatusTopic, 1, true, "offline").WaitTimeout(mqttTimeout)
+	}
+	b.client.Disconnect(250)
+	b.client = nil
+}
+
+// Restart reconnects with the current settings
+func (b *MQTTBridge) Restart() error {
+	b.Stop()
+	return b.Start()
+}
+
+// Status describes the state of the bridge for the settings
+func (b *MQTTBridge) Status() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.err != nil:
+		return b.err.Error()
+	case b.client == nil:
+		return "Off"
+	case !b.client.IsConnectionOpen():
+		return "Connecting to " + mqttBroker()
+	}
+	return "Connected to " + mqttBroker()
+}
+
+// Err returns the error that stopped the bridge from starting
+func (b *MQTTBridge) Err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
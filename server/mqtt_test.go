@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mqttPacket is a packet received by testBroker
+type mqttPacket struct {
+	kind  byte
+	flags byte
+	body  []byte
+}
+
+// testBroker is just enough of an MQTT 3.1.1 broker for a single client
+type testBroker struct {
+	ln         net.Listener
+	mu         sync.Mutex
+	conn       net.Conn
+	published  chan [2]string
+	subscribed chan string
+}
+
+func newTestBroker(t *testing.T, addr string) *testBroker {
+	t.Helper()
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	b := &testBroker{ln: ln, published: make(chan [2]string, 64), subscribed: make(chan string, 4)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			b.mu.Lock()
+			b.conn = conn
+			b.mu.Unlock()
+			go b.serve(conn)
+		}
+	}()
+	return b
+}
+
+func readPacket(r *bufio.Reader) (mqttPacket, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return mqttPacket{}, err
+	}
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return mqttPacket{}, err
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return mqttPacket{}, err
+	}
+	return mqttPacket{kind: header >> 4, flags: header & 0x0f, body: body}, nil
+}
+
+func writePacket(w io.Writer, header byte, body []byte) {
+	packet := append([]byte{header}, binary.AppendUvarint(nil, uint64(len(body)))...)
+	w.Write(append(packet, body...))
+}
+
+// mqttString encodes a length prefixed string
+func mqttString(s string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(s))), s...)
+}
+
+func (b *testBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		p, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		switch p.kind {
+		case 1: // CONNECT
+			writePacket(conn, 0x20, []byte{0, 0})
+		case 3: // PUBLISH
+			n := binary.BigEndian.Uint16(p.body)
+			topic, rest := string(p.body[2:2+n]), p.body[2+n:]
+			if qos := (p.flags >> 1) & 3; qos > 0 {
+				writePacket(conn, 0x40, rest[:2])
+				rest = rest[2:]
+			}
+			b.published <- [2]string{topic, string(rest)}
+		case 8: // SUBSCRIBE
+			n := binary.BigEndian.Uint16(p.body[2:])
+			b.subscribed <- string(p.body[4 : 4+n])
+			writePacket(conn, 0x90, append(p.body[:2:2], 1))
+		case 12: // PINGREQ
+			writePacket(conn, 0xd0, nil)
+		case 14: // DISCONNECT
+			return
+		}
+	}
+}
+
+// send publishes a message to the connected client
+func (b *testBroker) send(topic, payload string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	writePacket(b.conn, 0x30, append(mqttString(topic), payload...))
+}
+
+// expect waits for a message on topic and returns its payload
+func (b *testBroker) expect(t *testing.T, topic string) string {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case m := <-b.published:
+			if m[0] == topic {
+				return m[1]
+			}
+		case <-timeout:
+			t.Fatalf("Expected message on %s", topic)
+		}
+	}
+}
+
+func TestMQTTMessage(t *testing.T) {
+	topic, payload, retained, ok := mqttMessage("home/deck", Event{Type: EventButtonState, ScriptID: 3, State: ButtonRunning})
+	if !ok || topic != "home/deck/tasks/3/state" || string(payload) != "running" || !retained {
+		t.Errorf("Unexpected state message %s %s %v", topic, payload, retained)
+	}
+
+	run := RunResult{ScriptID: 3, ExitCode: 1}
+	topic, payload, retained, ok = mqttMessage("home/deck", Event{Type: EventRunFinished, ScriptID: 3, Run: &run})
+	var e Event
+	if !ok || topic != "home/deck/tasks/3/run" || retained || json.Unmarshal(payload, &e) != nil || e.Run.ExitCode != 1 {
+		t.Errorf("Unexpected run message %s %s %v", topic, payload, retained)
+	}
+
+	if _, _, _, ok := mqttMessage("home/deck", Event{Type: EventScriptAdded, ScriptID: 3}); ok {
+		t.Error("Expected task changes not to be published")
+	}
+}
+
+func TestTaskFromTopic(t *testing.T) {
+	scripts := []Script{{ID: 1, File: "lights.ts"}, {ID: 7, Type: TypeMacro, Title: "Start Stream"}}
+
+	testCases := []struct {
+		topic  string
+		wantID int
+	}{
+		{"opendeck/tasks/7/trigger", 7},
+		{"opendeck/tasks/lights/trigger", 1},
+		{"opendeck/tasks/start-stream/trigger", 7},
+		{"opendeck/tasks/9/trigger", 0},
+		{"opendeck/tasks/7/state", 0},
+		{"other/tasks/7/trigger", 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.topic, func(t *testing.T) {
+			script, err := taskFromTopic("opendeck", tc.topic, scripts)
+			if tc.wantID == 0 {
+				if err == nil {
+					t.Errorf("Expected error, got task %d", script.ID)
+				}
+				return
+			}
+			if err != nil || script.ID != tc.wantID {
+				t.Errorf("Expected task %d, got %d (%v)", tc.wantID, script.ID, err)
+			}
+		})
+	}
+}
+
+func TestValidateMQTTBroker(t *testing.T) {
+	for _, broker := range []string{"", "tcp://localhost:1883", "ssl://broker.local:8883", "ws://broker:9001/mqtt"} {
+		if err := validateMQTTBroker(broker); err != nil {
+			t.Errorf("Expected %q to be valid: %v", broker, err)
+		}
+	}
+	for _, broker := range []string{"localhost:1883", "http://broker", "tcp://"} {
+		if err := validateMQTTBroker(broker); err == nil {
+			t.Errorf("Expected %q to be invalid", broker)
+		}
+	}
+}
+
+func TestMQTTBridge(t *testing.T) {
+	// Setup test directory
+	tmpDir := t.TempDir()
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+
+	// Run scripts with sh so the test does not depend on bun
+	originalRuntime := scriptRuntime
+	scriptRuntime = []string{"sh"}
+	defer func() { scriptRuntime = originalRuntime }()
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "lights.js"), []byte("read level; echo dim $level"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	scriptsData, _ := json.MarshalIndent([]Script{{ID: 1, File: "lights.js"}}, "", "\t")
+	if err := os.WriteFile(filepath.Join(tmpDir, "scripts.json"), scriptsData, 0644); err != nil {
+		t.Fatalf("Failed to create scripts.json: %v", err)
+	}
+
+	originalInterval := mqttRetryInterval
+	mqttRetryInterval = 50 * time.Millisecond
+	defer func() { mqttRetryInterval = originalInterval }()
+
+	// The broker is not up yet when the bridge starts
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	settings.SetString("mqtt_broker", "tcp://"+addr)
+	settings.SetString("mqtt_prefix", "home/deck/")
+	defer settings.SetString("mqtt_broker", "")
+	defer settings.SetString("mqtt_prefix", "")
+
+	started := time.Now()
+	if err := bridge.Start(); err != nil {
+		t.Fatalf("Failed to start bridge: %v", err)
+	}
+	defer bridge.Stop()
+	if time.Since(started) > time.Second {
+		t.Errorf("Expected Start not to wait for the broker, took %v", time.Since(started))
+	}
+	if !strings.HasPrefix(bridge.Status(), "Connecting") {
+		t.Errorf("Expected bridge to be connecting, got %q", bridge.Status())
+	}
+
+	broker := newTestBroker(t, addr)
+	if got := broker.expect(t, "home/deck/status"); got != "online" {
+		t.Errorf("Expected online status, got %q", got)
+	}
+	if got := broker.expect(t, "home/deck/tasks/1/state"); got != ButtonIdle {
+		t.Errorf("Expected initial idle state, got %q", got)
+	}
+	select {
+	case topic := <-broker.subscribed:
+		if topic != "home/deck/tasks/+/trigger" {
+			t.Errorf("Unexpected subscription %q", topic)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the bridge to subscribe to triggers")
+	}
+	if !strings.HasPrefix(bridge.Status(), "Connected") {
+		t.Errorf("Expected bridge to be connected, got %q", bridge.Status())
+	}
+
+	broker.send("home/deck/tasks/lights/trigger", "50\n")
+	if got := broker.expect(t, "home/deck/tasks/1/state"); got != ButtonRunning {
+		t.Errorf("Expected running state, got %q", got)
+	}
+	broker.expect(t, "home/deck/tasks/1/run")
+	var e Event
+	if err := json.Unmarshal([]byte(broker.expect(t, "home/deck/tasks/1/run")), &e); err != nil {
+		t.Fatalf("Invalid run event: %v", err)
+	}
+	if e.Type != EventRunFinished || e.Run.Stdout != "dim 50" || e.Run.Trigger != TriggerMQTT {
+		t.Errorf("Unexpected run event %+v", e)
+	}
+
+	bridge.Stop()
+	if got := broker.expect(t, "home/deck/status"); got != "offline" {
+		t.Errorf("Expected offline status on stop, got %q", got)
+	}
+}
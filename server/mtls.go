@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// AuthToken authenticates clients with bearer tokens
+	AuthToken = "token"
+	// AuthMTLS authenticates clients with certificates issued on pairing
+	AuthMTLS = "mtls"
+)
+
+// clientCertValidity is how long issued client certificates are valid for
+const clientCertValidity = 2 * 365 * 24 * time.Hour
+
+// authMode returns how paired clients authenticate
+var authMode = func() string {
+	return settings.StringWithFallback("auth_mode", AuthToken)
+}
+
+// randomSerial returns a serial number for a new certificate
+func randomSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// ensureCA returns the certificate authority client certificates are
+// issued by, creating it on first use
+func ensureCA() (*x509.Certificate, crypto.Signer, error) {
+	dir := getTLSPath()
+	certFile, keyFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem")
+
+	if pair, err := tls.LoadX509KeyPair(certFile, keyFile); err == nil {
+		cert, err := x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		return cert, pair.PrivateKey.(crypto.Signer), nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "OpenDeck Client CA", Organization: []string{"OpenDeck"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(certificateValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, nil, err
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return nil, nil, fmt.Errorf("failed to write CA key: %w", err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return nil, nil, fmt.Errorf("failed to write CA certificate: %w", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	return cert, key, err
+}
+
+// parseClientCSR decodes a PEM encoded certificate request and checks
+// that it is signed by the key it asks a certificate for
+func parseClientCSR(csrPEM string) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode([]byte(csrPEM))
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, errors.New("csr is not a PEM encoded certificate request")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid csr: %w", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid csr signature: %w", err)
+	}
+	return csr, nil
+}
+
+// signClientCSR issues a client certificate for a certificate request
+// checked by parseClientCSR. The certificate's common name is the client
+// ID, whatever the request asked for.
+func signClientCSR(csr *x509.CertificateRequest, clientID string) (*x509.Certificate, []byte, error) {
+	ca, caKey, err := ensureCA()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load CA: %w", err)
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: clientID, Organization: []string{"OpenDeck"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(clientCertValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, ca, csr.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+// serverTLSConfig returns the TLS configuration of the server. In mTLS
+// mode client certificates issued by the CA are verified when presented.
+// They are not required at the TLS level so that new clients can still
+// reach the pairing endpoint.
+func serverTLSConfig() (*tls.Config, error) {
+	certFile, keyFile, err := tlsFiles()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if authMode() == AuthMTLS {
+		ca, _, err := ensureCA()
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		pool.AddCert(ca)
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config, nil
+}
+
+// clientFromCertificate returns the paired client whose verified
+// certificate was presented on the connection
+func clientFromCertificate(c *fiber.Ctx) (Client, bool) {
+	state := c.Context().TLSConnectionState()
+	if state == nil || len(state.VerifiedChains) == 0 {
+		return Client{}, false
+	}
+	cert := state.VerifiedChains[0][0]
+
+	return seenClient(func(client Client) bool {
+		return client.ID == cert.Subject.CommonName && client.CertSerial != "" &&
+			client.CertSerial == cert.SerialNumber.String()
+	})
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// newTestCSR returns a certificate request and its PEM encoded key
+func newTestCSR(t *testing.T) (string, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, key)
+	if err != nil {
+		t.Fatalf("Failed to create csr: %v", err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestSignClientCSR(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalDataPath := getDataPath
+	getDataPath = func() string { return tmpDir }
+	defer func() { getDataPath = originalDataPath }()
+
+	if _, err := parseClientCSR("not a csr"); err == nil {
+		t.Error("Expected error for invalid csr")
+	}
+
+	csrPEM, _ := newTestCSR(t)
+	csr, err := parseClientCSR(csrPEM)
+	if err != nil {
+		t.Fatalf("Failed to parse csr: %v", err)
+	}
+	cert, _, err := signClientCSR(csr, "abc")
+	if err != nil {
+		t.Fatalf("Failed to sign csr: %v", err)
+	}
+	ca, _, _ := ensureCA()
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	opts := x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}
+	if _, err := cert.Verify(opts); err != nil {
+		t.Errorf("Expected certificate to be issued by the CA: %v", err)
+	}
+	if cert.Subject.CommonName != "abc" {
+		t.Errorf("Expected client ID as common name, got %q", cert.Subject.CommonName)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	// Setup test directory
+	tmpDir := t.TempDir()
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+	originalDataPath := getDataPath
+	getDataPath = func() string { return tmpDir }
+	defer func() { getDataPath = originalDataPath }()
+	originalMode := authMode
+	authMode = func() string { return AuthMTLS }
+	defer func() { authMode = originalMode }()
+
+	scriptsData, _ := json.MarshalIndent([]Script{{ID: 1, File: "test.js"}}, "", "\t")
+	if err := os.WriteFile(filepath.Join(tmpDir, "scripts.json"), scriptsData, 0644); err != nil {
+		t.Fatalf("Failed to create scripts.json: %v", err)
+	}
+
+	config, err := serverTLSConfig()
+	if err != nil {
+		t.Fatalf("Failed to create TLS config: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	registerAPIRoutes(app)
+	go app.Listener(tls.NewListener(ln, config))
+	defer app.Shutdown()
+	baseURL := "https://" + ln.Addr().String() + "/api/v1"
+
+	newClient := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+			Certificates:       certs,
+		}}}
+	}
+	pair := func(body map[string]string) (int, pairResponse) {
+		data, _ := json.Marshal(body)
+		resp, err := newClient().Post(baseURL+"/pair", "application/json", bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Failed to pair: %v", err)
+		}
+		defer resp.Body.Close()
+		var paired pairResponse
+		json.NewDecoder(resp.Body).Decode(&paired)
+		return resp.StatusCode, paired
+	}
+	list := func(client *http.Client) int {
+		resp, err := client.Get(baseURL + "/scripts")
+		if err != nil {
+			t.Fatalf("Failed to list scripts: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	pin, _ := startPairing()
+	defer stopPairing()
+	if status, _ := pair(map[string]string{"pin": pin, "name": "lab"}); status != fiber.StatusBadRequest {
+		t.Errorf("Expected status 400 without csr, got %d", status)
+	}
+
+	// A malformed csr is rejected without using up the PIN
+	if status, _ := pair(map[string]string{"pin": pin, "name": "lab", "csr": "not a csr"}); status != fiber.StatusBadRequest {
+		t.Errorf("Expected status 400 for a malformed csr, got %d", status)
+	}
+
+	csr, keyPEM := newTestCSR(t)
+	status, paired := pair(map[string]string{"pin": pin, "name": "lab", "csr": csr})
+	if status != fiber.StatusCreated || paired.Certificate == "" {
+		t.Fatalf("Expected certificate from pairing, got status %d", status)
+	}
+	if paired.Token != "" {
+		t.Error("Expected no token in mTLS mode")
+	}
+
+	cert, err := tls.X509KeyPair([]byte(paired.Certificate), keyPEM)
+	if err != nil {
+		t.Fatalf("Issued certificate does not match key: %v", err)
+	}
+	if status := list(newClient()); status != fiber.StatusUnauthorized {
+		t.Errorf("Expected status 401 without certificate, got %d", status)
+	}
+	if status := list(newClient(cert)); status != fiber.StatusOK {
+		t.Errorf("Expected status 200 with certificate, got %d", status)
+	}
+
+	if err := revokeClient(paired.ClientID); err != nil {
+		t.Fatalf("Failed to revoke client: %v", err)
+	}
+	if status := list(newClient(cert)); status != fiber.StatusUnauthorized {
+		t.Errorf("Expected status 401 after revoking, got %d", status)
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxDeliveryAttempts is how often a notification is sent before it is
+// given up on
+const maxDeliveryAttempts = 5
+
+// maxDeliveries is the number of deliveries kept in the delivery log
+const maxDeliveries = 200
+
+// deliveryBackoff is the wait before the first retry, it doubles with
+// every further attempt
+var deliveryBackoff = 2 * time.Second
+
+// Notification is an outbound webhook sent when a run finishes
+type Notification struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// On selects the runs that are sent, IfAlways, IfSuccess or IfFailure
+	On string `json:"on,omitempty"`
+	// Scripts limits the notification to these tasks. It covers every task
+	// if empty.
+	Scripts []int `json:"scripts,omitempty"`
+	// Body is a template of the JSON body, see NotificationData. The
+	// run.finished event is sent if it is empty.
+	Body    string            `json:"body,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Secret signs the body like the requests of signed inbound hooks
+	Secret string `json:"secret,omitempty"`
+}
+
+// NotificationData is available to notification body templates. The json
+// function quotes a value for use in the body, e.g. {{json .Run.Stderr}}.
+type NotificationData struct {
+	Run     RunResult
+	Success bool
+	Vars    map[string]string
+}
+
+// Delivery records the outcome of sending a notification
+type Delivery struct {
+	Notification string    `json:"notification"`
+	Name         string    `json:"name"`
+	URL          string    `json:"url"`
+	ScriptID     int       `json:"scriptId"`
+	Script       string    `json:"script"`
+	Time         time.Time `json:"time"`
+	Attempts     int       `json:"attempts"`
+	Status       int       `json:"status,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	Delivered    bool      `json:"delivered"`
+}
+
+var (
+	notificationsMu sync.Mutex
+	deliveriesMu    sync.Mutex
+	deliveries      []Delivery
+)
+
+func notificationsFile() string {
+	return filepath.Join(getDataPath(), "notifications.json")
+}
+
+// getNotifications returns the configured notifications
+func getNotifications() []Notification {
+	notificationsMu.Lock()
+	defer notificationsMu.Unlock()
+	return readNotifications()
+}
+
+func readNotifications() []Notification {
+	var notifications []Notification
+	data, err := os.ReadFile(notificationsFile())
+	if err != nil {
+		return notifications
+	}
+	if err := json.Unmarshal(data, &notifications); err != nil {
+		fmt.Println("Failed to parse notifications.json:", err)
+	}
+	return notifications
+}
+
+// prepareNotifications assigns IDs to new notifications and validates all
+// of them
+func prepareNotifications(notifications []Notification) error {
+	var errs []error
+	for i := range notifications {
+		if notifications[i].ID == "" {
+			notifications[i].ID = generateToken(8)
+		}
+		if err := validateNotification(notifications[i]); err != nil {
+			errs = append(errs, fmt.Errorf("notification %q: %w", notifications[i].Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// setNotifications validates and saves notifications, replacing the
+// configured ones
+func setNotifications(notifications []Notification) error {
+	if err := prepareNotifications(notifications); err != nil {
+		return err
+	}
+
+	notificationsMu.Lock()
+	defer notificationsMu.Unlock()
+	if err := os.MkdirAll(getDataPath(), 0755); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+	data, err := json.MarshalIndent(notifications, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to marshal notifications: %w", err)
+	}
+	// Headers and secrets may hold credentials
+	if err := os.WriteFile(notificationsFile(), data, 0600); err != nil {
+		return fmt.Errorf("failed to write notifications.json: %w", err)
+	}
+	return nil
+}
+
+// validateNotification checks the URL, filter and body template
+func validateNotification(n Notification) error {
+	var errs []error
+	if u, err := url.Parse(n.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("invalid URL %q", n.URL))
+	}
+	switch n.On {
+	case IfAlways, IfSuccess, IfFailure:
+	default:
+		errs = append(errs, fmt.Errorf("unknown filter %q", n.On))
+	}
+	if n.Body != "" {
+		if _, err := notificationTemplate(n.Body); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// notificationTemplate parses a body template
+func notificationTemplate(text string) (*template.Template, error) {
+	funcs := template.FuncMap{
+		"json": func(v any) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}
+	tmpl, err := template.New("").Funcs(funcs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// runSucceeded reports whether a run counts as a success for filters
+func runSucceeded(result RunResult) bool {
+	return result.ExitCode == 0 && result.Error == ""
+}
+
+// matches reports whether a finished run of script should be sent
+func (n Notification) matches(script Script, result RunResult) bool {
+	if len(n.Scripts) > 0 && !slices.Contains(n.Scripts, script.ID) {
+		return false
+	}
+	switch n.On {
+	case IfSuccess:
+		return runSucceeded(result)
+	case IfFailure:
+		return !runSucceeded(result)
+	}
+	return true
+}
+
+// body renders the request body for a run
+func (n Notification) body(result RunResult) ([]byte, error) {
+	if n.Body == "" {
+		return json.Marshal(Event{Type: EventRunFinished, Time: time.Now(), ScriptID: result.ScriptID, Run: &result})
+	}
+	tmpl, err := notificationTemplate(n.Body)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	data := NotificationData{Run: result, Success: runSucceeded(result), Vars: getVariables()}
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render template: %w", err)
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, errors.New("template did not render valid JSON")
+	}
+	return buf.Bytes(), nil
+}
+
+// notifyRun sends the notifications matching a finished run in the
+// background. Skipped runs did not finish and are not sent.
+func notifyRun(script Script, result RunResult) {
+	if result.Skipped {
+		return
+	}
+	for _, n := range getNotifications() {
+		if n.matches(script, result) {
+			go deliver(n, result, maxDeliveryAttempts)
+		}
+	}
+}
+
+// deliver sends a notification, retrying failed attempts with exponential
+// backoff, and records the outcome in the delivery log
+func deliver(n Notification, result RunResult, attempts int) Delivery {
+	d := Delivery{
+		Notification: n.ID,
+		Name:         n.Name,
+		URL:          n.URL,
+		ScriptID:     result.ScriptID,
+		Script:       result.Script,
+		Time:         time.Now(),
+	}
+	defer func() { recordDelivery(d) }()
+
+	body, err := n.body(result)
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+
+	wait := deliveryBackoff
+	for d.Attempts < attempts {
+		if d.Attempts > 0 {
+			time.Sleep(wait)
+			wait *= 2
+		}
+		d.Attempts++
+
+		var retry bool
+		d.Status, retry, err = sendNotification(n, body)
+		if err == nil {
+			d.Delivered, d.Error = true, ""
+			return d
+		}
+		d.Error = err.Error()
+		if !retry {
+			return d
+		}
+	}
+	return d
+}
+
+// sendNotification makes a single delivery attempt. Network errors, server
+// errors and rate limiting are worth retrying, other rejections are not.
+func sendNotification(n Notification, body []byte) (status int, retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range n.Headers {
+		req.Header.Set(key, value)
+	}
+	if n.Secret != "" {
+		req.Header.Set(signatureHeader, signPayload(n.Secret, body))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return resp.StatusCode, retry, fmt.Errorf("server responded %s", resp.Status)
+	}
+	return resp.StatusCode, false, nil
+}
+
+// testNotification sends a notification once for a sample failed run
+func testNotification(n Notification) Delivery {
+	result := RunResult{
+		Script:   "Test",
+		Trigger:  TriggerClient,
+		Started:  time.Now(),
+		ExitCode: 1,
+		Stdout:   "test notification from OpenDeck",
+		Error:    "exit status 1",
+	}
+	return deliver(n, result, 1)
+}
+
+// recordDelivery appends a delivery to the log, dropping the oldest
+// entries once maxDeliveries is reached
+func recordDelivery(d Delivery) {
+	deliveriesMu.Lock()
+	defer deliveriesMu.Unlock()
+
+	deliveries = append(deliveries, d)
+	if len(deliveries) > maxDeliveries {
+		deliveries = slices.Clone(deliveries[len(deliveries)-maxDeliveries:])
+	}
+}
+
+// getDeliveries returns the delivery log, newest first
+func getDeliveries() []Delivery {
+	deliveriesMu.Lock()
+	defer deliveriesMu.Unlock()
+
+	out := slices.Clone(deliveries)
+	slices.Reverse(out)
+	return out
+}
+
+// apiGetNotifications returns the configured notifications
+func apiGetNotifications(c *fiber.Ctx) error {
+	notifications := getNotifications()
+	if notifications == nil {
+		notifications = []Notification{}
+	}
+	return c.JSON(notifications)
+}
+
+// apiSetNotifications replaces the configured notifications
+func apiSetNotifications(c *fiber.Ctx) error {
+	var notifications []Notification
+	if err := json.Unmarshal(c.Body(), &notifications); err != nil {
+		return badRequest(fmt.Errorf("invalid notifications: %w", err))
+	}
+	if err := prepareNotifications(notifications); err != nil {
+		return badRequest(err)
+	}
+	if err := setNotifications(notifications); err != nil {
+		return err
+	}
+	return apiGetNotifications(c)
+}
+
+// apiListDeliveries returns the delivery log
+func apiListDeliveries(c *fiber.Ctx) error {
+	out := getDeliveries()
+	if out == nil {
+		out = []Delivery{}
+	}
+	return c.JSON(out)
+}
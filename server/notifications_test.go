@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// waitDeliveries waits until the delivery log holds n entries
+func waitDeliveries(t *testing.T, n int) []Delivery {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got := getDeliveries()
+		if len(got) >= n {
+			return got
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d deliveries, got %d", n, len(got))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// resetDeliveries clears the delivery log for a test
+func resetDeliveries(t *testing.T) {
+	deliveriesMu.Lock()
+	deliveries = nil
+	deliveriesMu.Unlock()
+	t.Cleanup(func() {
+		deliveriesMu.Lock()
+		deliveries = nil
+		deliveriesMu.Unlock()
+	})
+}
+
+func TestNotificationMatches(t *testing.T) {
+	ok := RunResult{ScriptID: 1}
+	failed := RunResult{ScriptID: 1, ExitCode: 2, Error: "exit status 2"}
+
+	testCases := []struct {
+		name   string
+		n      Notification
+		script Script
+		result RunResult
+		want   bool
+	}{
+		{"global always", Notification{}, Script{ID: 1}, ok, true},
+		{"failure filter on success", Notification{On: IfFailure}, Script{ID: 1}, ok, false},
+		{"failure filter on failure", Notification{On: IfFailure}, Script{ID: 1}, failed, true},
+		{"success filter on failure", Notification{On: IfSuccess}, Script{ID: 1}, failed, false},
+		{"other task", Notification{Scripts: []int{2}}, Script{ID: 1}, ok, false},
+		{"listed task", Notification{Scripts: []int{2, 1}}, Script{ID: 1}, ok, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.n.matches(tc.script, tc.result); got != tc.want {
+				t.Errorf("Expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestNotificationBody(t *testing.T) {
+	result := RunResult{ScriptID: 3, Script: "Backup", ExitCode: 1, Stderr: "disk \"full\"\n"}
+
+	n := Notification{Body: `{"text": {{json (printf "%s failed: %s" .Run.Script .Run.Stderr)}}, "ok": {{.Success}}}`}
+	body, err := n.body(result)
+	if err != nil {
+		t.Fatalf("Failed to render body: %v", err)
+	}
+	var got struct {
+		Text string `json:"text"`
+		OK   bool   `json:"ok"`
+	}
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("Invalid body %s: %v", body, err)
+	}
+	if got.Text != "Backup failed: disk \"full\"\n" || got.OK {
+		t.Errorf("Unexpected body %s", body)
+	}
+
+	// Without a template the run.finished event is sent
+	body, err = Notification{}.body(result)
+	if err != nil {
+		t.Fatalf("Failed to render body: %v", err)
+	}
+	var e Event
+	if err := json.Unmarshal(body, &e); err != nil || e.Type != EventRunFinished || e.Run == nil || e.Run.Script != "Backup" {
+		t.Errorf("Expected run.finished event, got %s", body)
+	}
+
+	if _, err := (Notification{Body: `{"text": {{.Run.Script}}}`}).body(result); err == nil {
+		t.Error("Expected body that is not JSON to fail")
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	resetDeliveries(t)
+	originalBackoff := deliveryBackoff
+	deliveryBackoff = time.Millisecond
+	defer func() { deliveryBackoff = originalBackoff }()
+
+	var calls atomic.Int32
+	var signature string
+	var received []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			signature = r.Header.Get(signatureHeader)
+			received, _ = io.ReadAll(r.Body)
+		}
+	}))
+	defer srv.Close()
+
+	n := Notification{ID: "chat", Name: "Chat", URL: srv.URL, Secret: "secret"}
+	d := deliver(n, RunResult{ScriptID: 1, Script: "Lights"}, maxDeliveryAttempts)
+	if !d.Delivered || d.Attempts != 3 || d.Status != http.StatusOK {
+		t.Errorf("Expected delivery on the third attempt, got %+v", d)
+	}
+	if !verifySignature("secret", received, signature) {
+		t.Error("Expected signed body")
+	}
+
+	rejected := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer rejected.Close()
+	d = deliver(Notification{URL: rejected.URL}, RunResult{}, maxDeliveryAttempts)
+	if d.Delivered || d.Attempts != 1 || d.Status != http.StatusBadRequest {
+		t.Errorf("Expected rejected delivery not to be retried, got %+v", d)
+	}
+
+	log := getDeliveries()
+	if len(log) != 2 || log[0].Status != http.StatusBadRequest || log[1].Name != "Chat" {
+		t.Errorf("Expected both deliveries in the log newest first, got %+v", log)
+	}
+}
+
+func TestNotifyRun(t *testing.T) {
+	// Setup test directory
+	tmpDir := t.TempDir()
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+	originalDataPath := getDataPath
+	getDataPath = func() string { return tmpDir }
+	defer func() { getDataPath = originalDataPath }()
+	resetDeliveries(t)
+
+	// Run scripts with sh so the test does not depend on bun
+	originalRuntime := scriptRuntime
+	scriptRuntime = []string{"sh"}
+	defer func() { scriptRuntime = originalRuntime }()
+
+	files := map[string]string{"ok.js": "echo fine", "fail.js": "echo broken >&2; exit 1"}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	bodies := make(chan string, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- string(body)
+	}))
+	defer srv.Close()
+
+	err := setNotifications([]Notification{{
+		Name: "Failures",
+		URL:  srv.URL,
+		On:   IfFailure,
+		Body: `{"text": {{json .Run.Stderr}}}`,
+	}})
+	if err != nil {
+		t.Fatalf("Failed to save notifications: %v", err)
+	}
+
+	runScript(Script{ID: 1, File: "ok.js"}, RunOptions{Trigger: TriggerSchedule})
+	runScript(Script{ID: 2, File: "fail.js"}, RunOptions{Trigger: TriggerSchedule})
+
+	select {
+	case body := <-bodies:
+		if body != `{"text": "broken"}` {
+			t.Errorf("Unexpected body %s", body)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected failed run to be sent")
+	}
+	log := waitDeliveries(t, 1)
+	if len(log) != 1 || log[0].ScriptID != 2 || !log[0].Delivered {
+		t.Errorf("Expected only the failed run in the log, got %+v", log)
+	}
+}
+
+func TestNotificationsAPI(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalDataPath := getDataPath
+	getDataPath = func() string { return tmpDir }
+	defer func() { getDataPath = originalDataPath }()
+
+	originalKey := getAPIKey
+	getAPIKey = func() string { return "test-key" }
+	defer func() { getAPIKey = originalKey }()
+
+	app := fiber.New()
+	registerAPIRoutes(app)
+
+	put := func(body string) *http.Response {
+		req := authorized(httptest.NewRequest("PUT", "/api/v1/notifications", strings.NewReader(body)))
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to test request: %v", err)
+		}
+		return resp
+	}
+
+	if resp := put(`[{"name":"Chat","url":"ftp://example.com","on":"sometimes"}]`); resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid notification, got %d", resp.StatusCode)
+	}
+
+	resp := put(`[{"name":"Chat","url":"https://chat.example.com/hook","on":"failure","scripts":[1]}]`)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	var saved []Notification
+	json.NewDecoder(resp.Body).Decode(&saved)
+	if len(saved) != 1 || saved[0].ID == "" || saved[0].On != IfFailure {
+		t.Errorf("Expected saved notification with an ID, got %+v", saved)
+	}
+
+	info, err := os.Stat(notificationsFile())
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected private notifications file, got %v", err)
+	}
+
+	resp, _ = app.Test(httptest.NewRequest("GET", "/api/v1/notifications", nil))
+	if resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("Expected status 401 without the API key, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	_ "embed"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// openAPIDocument describes every route of the server. It is checked
+// against the handlers by the contract tests in openapi_test.go.
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// fiberOpenAPI returns the OpenAPI document. Like the health check it is
+// public, it only describes what the server can do.
+func fiberOpenAPI(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(openAPIDocument)
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// openAPISpec is the parsed OpenAPI document with helpers to check
+// responses against it
+type openAPISpec map[string]any
+
+func loadOpenAPISpec(t *testing.T) openAPISpec {
+	t.Helper()
+	var spec openAPISpec
+	if err := json.Unmarshal(openAPIDocument, &spec); err != nil {
+		t.Fatalf("Invalid OpenAPI document: %v", err)
+	}
+	return spec
+}
+
+// resolve follows a local $ref such as #/components/schemas/Script
+func (s openAPISpec) resolve(node map[string]any) map[string]any {
+	ref, ok := node["$ref"].(string)
+	if !ok {
+		return node
+	}
+	var current any = map[string]any(s)
+	for _, key := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		m, _ := current.(map[string]any)
+		current = m[key]
+	}
+	resolved, ok := current.(map[string]any)
+	if !ok {
+		panic("unresolved reference " + ref)
+	}
+	return s.resolve(resolved)
+}
+
+// operation returns the operation of a method and path template
+func (s openAPISpec) operation(method, path string) (map[string]any, bool) {
+	paths, _ := s["paths"].(map[string]any)
+	item, _ := paths[path].(map[string]any)
+	op, ok := item[strings.ToLower(method)].(map[string]any)
+	return op, ok
+}
+
+// jsonType returns the JSON schema type of a decoded value
+func jsonType(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// validate checks a decoded JSON value against the subset of JSON schema
+// used by the document. Objects with declared properties may not carry
+// undeclared ones, so fields added to responses must be documented.
+func (s openAPISpec) validate(schema map[string]any, v any, at string) []error {
+	schema = s.resolve(schema)
+	var errs []error
+
+	if want, ok := schema["type"]; ok {
+		types := []string{}
+		switch want := want.(type) {
+		case string:
+			types = append(types, want)
+		case []any:
+			for _, t := range want {
+				types = append(types, t.(string))
+			}
+		}
+		got := jsonType(v)
+		if !slices.Contains(types, got) && !(got == "integer" && slices.Contains(types, "number")) {
+			return []error{fmt.Errorf("%s: expected %v, got %s", at, types, got)}
+		}
+	}
+	if enum, ok := schema["enum"].([]any); ok && !slices.Contains(enum, v) {
+		errs = append(errs, fmt.Errorf("%s: %v is not one of %v", at, v, enum))
+	}
+	if schema["format"] == "date-time" {
+		if str, _ := v.(string); str != "" {
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", at, err))
+			}
+		}
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		properties, _ := schema["properties"].(map[string]any)
+		required, _ := schema["required"].([]any)
+		for _, name := range required {
+			if _, ok := v[name.(string)]; !ok {
+				errs = append(errs, fmt.Errorf("%s: missing required property %s", at, name))
+			}
+		}
+		additional, _ := schema["additionalProperties"].(map[string]any)
+		for name, value := range v {
+			if property, ok := properties[name].(map[string]any); ok {
+				errs = append(errs, s.validate(property, value, at+"."+name)...)
+			} else if additional != nil {
+				errs = append(errs, s.validate(additional, value, at+"."+name)...)
+			} else if properties != nil {
+				errs = append(errs, fmt.Errorf("%s: undocumented property %s", at, name))
+			}
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				errs = append(errs, s.validate(items, item, fmt.Sprintf("%s[%d]", at, i))...)
+			}
+		}
+	}
+	return errs
+}
+
+// checkResponse checks that a response of the operation at method and path
+// is documented, and that its headers and body match the document
+func (s openAPISpec) checkResponse(method, path string, resp *http.Response) error {
+	op, ok := s.operation(method, path)
+	if !ok {
+		return fmt.Errorf("%s %s is not documented", method, path)
+	}
+	responses := op["responses"].(map[string]any)
+	documented, ok := responses[strconv.Itoa(resp.StatusCode)].(map[string]any)
+	if !ok {
+		return fmt.Errorf("%s %s: status %d is not documented", method, path, resp.StatusCode)
+	}
+	documented = s.resolve(documented)
+
+	var errs []error
+	headers, _ := documented["headers"].(map[string]any)
+	for name := range headers {
+		if resp.Header.Get(name) == "" {
+			errs = append(errs, fmt.Errorf("missing header %s", name))
+		}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	content, ok := documented["content"].(map[string]any)
+	if !ok {
+		if len(body) > 0 && resp.StatusCode == fiber.StatusNoContent {
+			errs = append(errs, fmt.Errorf("expected no body, got %q", body))
+		}
+		return joinContractErrors(method, path, resp.StatusCode, errs)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get(fiber.HeaderContentType))
+	media, ok := content[mediaType].(map[string]any)
+	if !ok {
+		errs = append(errs, fmt.Errorf("content type %q is not documented", mediaType))
+		return joinContractErrors(method, path, resp.StatusCode, errs)
+	}
+	schema, _ := media["schema"].(map[string]any)
+
+	switch mediaType {
+	case fiber.MIMEApplicationJSON:
+		var v any
+		if err := json.Unmarshal(body, &v); err != nil {
+			errs = append(errs, fmt.Errorf("invalid JSON: %w", err))
+		} else {
+			errs = append(errs, s.validate(schema, v, "body")...)
+		}
+	case "application/x-ndjson":
+		// Every line is a value of the schema
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		for i := 0; scanner.Scan(); i++ {
+			var v any
+			if err := json.Unmarshal(scanner.Bytes(), &v); err != nil {
+				errs = append(errs, fmt.Errorf("line %d: invalid JSON: %w", i, err))
+				continue
+			}
+			errs = append(errs, s.validate(schema, v, fmt.Sprintf("line %d", i))...)
+		}
+	}
+	return joinContractErrors(method, path, resp.StatusCode, errs)
+}
+
+func joinContractErrors(method, path string, status int, errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return fmt.Errorf("%s %s %d:\n\t%s", method, path, status, strings.Join(messages, "\n\t"))
+}
+
+var routeParam = regexp.MustCompile(`:(\w+)`)
+
+func TestOpenAPIRoutes(t *testing.T) {
+	spec := loadOpenAPISpec(t)
+	if spec["openapi"] != "3.1.0" {
+		t.Errorf("Unexpected OpenAPI version %v", spec["openapi"])
+	}
+
+	// Every route is documented
+	app := newFiberApp()
+	served := map[string]bool{}
+	for _, route := range app.GetRoutes(true) {
+		if route.Method == fiber.MethodHead {
+			continue
+		}
+		path := routeParam.ReplaceAllString(route.Path, "{$1}")
+		served[route.Method+" "+path] = true
+		if _, ok := spec.operation(route.Method, path); !ok {
+			t.Errorf("%s %s is not documented", route.Method, path)
+		}
+	}
+
+	// Every documented operation is served. The browser deck is served by
+	// middleware and has no routes of its own.
+	operationIDs := map[string]bool{}
+	for path, item := range spec["paths"].(map[string]any) {
+		for method, op := range item.(map[string]any) {
+			if method == "parameters" {
+				continue
+			}
+			id, _ := op.(map[string]any)["operationId"].(string)
+			if id == "" || operationIDs[id] {
+				t.Errorf("%s %s needs a unique operationId, got %q", method, path, id)
+			}
+			operationIDs[id] = true
+			if !served[strings.ToUpper(method)+" "+path] && !strings.HasPrefix(path, webUIPath+"/") {
+				t.Errorf("%s %s is documented but not served", method, path)
+			}
+		}
+	}
+}
+
+func TestOpenAPIContract(t *testing.T) {
+	// Setup test directory
+	tmpDir := t.TempDir()
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+	originalDataPath := getDataPath
+	getDataPath = func() string { return tmpDir }
+	defer func() { getDataPath = originalDataPath }()
+
+	// Run scripts with sh so the test does not depend on bun
+	originalRuntime := scriptRuntime
+	scriptRuntime = []string{fakeRuntime(t, `[ "$1" = --version ] && echo 1.1.0 || exec sh "$@"`)}
+	defer func() { scriptRuntime = originalRuntime }()
+
+	originalKey := getAPIKey
+	getAPIKey = func() string { return "test-key" }
+	defer func() { getAPIKey = originalKey }()
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "greet.js"), []byte("echo hello; echo oops >&2"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	scripts := []Script{
+		{ID: 1, File: "greet.js", Schedules: []string{"@every 1h"}, Tags: []string{"home"}, Hook: &Hook{Token: "hook-token"}},
+		{ID: 2, Type: TypeMacro, Title: "Greet Twice", Steps: []MacroStep{
+			{Type: StepScript, ScriptID: 1},
+			{Type: StepDelay, Duration: "1ms"},
+			{Type: StepScript, ScriptID: 1, If: IfSuccess},
+		}},
+	}
+	scriptsData, _ := json.MarshalIndent(scripts, "", "\t")
+	if err := os.WriteFile(filepath.Join(tmpDir, "scripts.json"), scriptsData, 0644); err != nil {
+		t.Fatalf("Failed to create scripts.json: %v", err)
+	}
+
+	defer settings.SetString("profile", "")
+
+	// Events are checked against the document like responses
+	var eventsMu sync.Mutex
+	var events []Event
+	ch := subscribe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for e := range ch {
+			eventsMu.Lock()
+			events = append(events, e)
+			eventsMu.Unlock()
+		}
+	}()
+
+	spec := loadOpenAPISpec(t)
+	app := newFiberApp()
+
+	var pin string
+	testCases := []struct {
+		method, path, url string
+		body              string
+		header            map[string]string
+		unauthorized      bool
+		wantStatus        int
+	}{
+		{"GET", "/openapi.json", "/openapi.json", "", nil, true, 200},
+		{"GET", "/healthz", "/healthz", "", nil, true, 200},
+		{"GET", "/readyz", "/readyz", "", nil, true, 503},
+		{"GET", "/metrics", "/metrics", "", nil, false, 200},
+		{"GET", "/metrics", "/metrics", "", nil, true, 401},
+		{"GET", "/", "/", "", nil, true, 302},
+		{"GET", "/ui/{file}", "/ui/index.html", "", nil, true, 200},
+		{"GET", "/api/v1/scripts", "/api/v1/scripts", "", nil, false, 200},
+		{"GET", "/api/v1/scripts", "/api/v1/scripts", "", nil, true, 401},
+		{"GET", "/api/v1/scripts/{id}", "/api/v1/scripts/1", "", nil, false, 200},
+		{"GET", "/api/v1/scripts/{id}", "/api/v1/scripts/9", "", nil, false, 404},
+		{"GET", "/api/v1/scripts/{id}", "/api/v1/scripts/one", "", nil, false, 400},
+		{"POST", "/api/v1/scripts/{id}/run", "/api/v1/scripts/2/run", "", nil, false, 200},
+		{"POST", "/api/v1/scripts/{id}/run/stream", "/api/v1/scripts/1/run/stream", "", nil, false, 200},
+		{"GET", "/api/v1/runs", "/api/v1/runs?script=1&limit=2", "", nil, false, 200},
+		{"GET", "/api/v1/runs", "/api/v1/runs?limit=0", "", nil, false, 400},
+		{"GET", "/api/v1/scripts/{id}/document", "/api/v1/scripts/2/document", "", nil, false, 200},
+		{"POST", "/api/v1/scripts", "/api/v1/scripts", `{"title":"Hello","file":"hello.js","source":"echo hi","tags":["home"]}`, nil, false, 201},
+		{"POST", "/api/v1/scripts", "/api/v1/scripts", `{"id":1,"file":"other.js"}`, nil, false, 409},
+		{"POST", "/api/v1/scripts", "/api/v1/scripts", `{"type":"widget"}`, nil, false, 400},
+		{"GET", "/api/v1/scripts/{id}/document", "/api/v1/scripts/3/document", "", nil, false, 200},
+		{"PUT", "/api/v1/scripts/{id}/document", "/api/v1/scripts/3/document", `{"source":"echo hey"}`, nil, false, 428},
+		{"PUT", "/api/v1/scripts/{id}/document", "/api/v1/scripts/3/document", `{"source":"echo hey"}`, map[string]string{"If-Match": "*"}, false, 200},
+		{"POST", "/api/v1/scripts/{id}/rename", "/api/v1/scripts/3/rename", `{"title":"Hey"}`, map[string]string{"If-Match": `"stale"`}, false, 412},
+		{"POST", "/api/v1/scripts/{id}/rename", "/api/v1/scripts/3/rename", `{"title":"Hey"}`, nil, false, 200},
+		{"DELETE", "/api/v1/scripts/{id}", "/api/v1/scripts/3", "", map[string]string{"If-Match": "*"}, false, 204},
+		{"POST", "/api/v1/pairing", "/api/v1/pairing", "", nil, false, 201},
+		{"POST", "/api/v1/pair", "/api/v1/pair", `{"pin":"000000","name":"Phone"}`, nil, true, 403},
+		{"POST", "/api/v1/pair", "/api/v1/pair", "", nil, true, 201},
+		{"PUT", "/api/v1/notifications", "/api/v1/notifications", `[{"name":"Chat","url":"https://chat.example.com/hook","on":"failure","scripts":[1]}]`, nil, false, 200},
+		{"PUT", "/api/v1/notifications", "/api/v1/notifications", `[{"url":"ftp://example.com"}]`, nil, false, 400},
+		{"GET", "/api/v1/notifications", "/api/v1/notifications", "", nil, false, 200},
+		{"GET", "/api/v1/notifications/deliveries", "/api/v1/notifications/deliveries", "", nil, false, 200},
+		{"GET", "/api/v1/events", "/api/v1/events", "", nil, false, 426},
+		{"GET", "/api/v1/profile", "/api/v1/profile", "", nil, false, 200},
+		{"PUT", "/api/v1/profile", "/api/v1/profile", `{"active":"home"}`, nil, false, 200},
+		{"PUT", "/api/v1/profile", "/api/v1/profile", `{"active":"garage"}`, nil, false, 400},
+		{"GET", "/api/v1/audit", "/api/v1/audit", "", nil, false, 200},
+		{"GET", "/scripts", "/scripts", "", nil, false, 200},
+		{"GET", "/scripts/{id}", "/scripts/1", "", nil, false, 200},
+		{"GET", "/scripts/{id}", "/scripts/missing", "", nil, false, 404},
+		{"POST", "/hooks/{token}", "/hooks/hook-token", "payload", nil, true, 200},
+		{"POST", "/hooks/{token}", "/hooks/unknown", "", nil, true, 404},
+	}
+
+	for _, tc := range testCases {
+		body := tc.body
+		if tc.path == "/api/v1/pair" && body == "" {
+			body = fmt.Sprintf(`{"pin":%q,"name":"Phone"}`, pin)
+		}
+		req := httptest.NewRequest(tc.method, tc.url, strings.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		for key, value := range tc.header {
+			req.Header.Set(key, value)
+		}
+		if !tc.unauthorized {
+			authorized(req)
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("Failed to test %s %s: %v", tc.method, tc.url, err)
+		}
+		if resp.StatusCode != tc.wantStatus {
+			msg, _ := io.ReadAll(resp.Body)
+			t.Errorf("%s %s: expected status %d, got %d: %s", tc.method, tc.url, tc.wantStatus, resp.StatusCode, msg)
+			continue
+		}
+
+		if tc.path == "/api/v1/pairing" {
+			var pairing pairingResponse
+			data, _ := io.ReadAll(resp.Body)
+			json.Unmarshal(data, &pairing)
+			pin = pairing.PIN
+			resp.Body = io.NopCloser(bytes.NewReader(data))
+		}
+		if err := spec.checkResponse(tc.method, tc.path, resp); err != nil {
+			t.Error(err)
+		}
+	}
+
+	unsubscribe(ch)
+	<-done
+	if len(events) == 0 {
+		t.Fatal("Expected events")
+	}
+	eventSchema := map[string]any{"$ref": "#/components/schemas/Event"}
+	for _, e := range events {
+		data, _ := json.Marshal(e)
+		var v any
+		json.Unmarshal(data, &v)
+		if errs := spec.validate(eventSchema, v, e.Type); len(errs) > 0 {
+			t.Errorf("Event does not match the document: %v", errs)
+		}
+	}
+}
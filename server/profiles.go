@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// A profile is a page of the deck, the tasks carrying the tag of its name.
+// Clients show the tasks of the active profile, or every task they may
+// access while no profile is active.
+
+// Profiles is the active profile and the profiles that can be switched to
+type Profiles struct {
+	Active   string   `json:"active"`
+	Profiles []string `json:"profiles"`
+}
+
+// profileMu serializes profile switches so that the events are published
+// in the order the switches were made
+var profileMu sync.Mutex
+
+// activeProfile returns the name of the active profile, empty if none is
+func activeProfile() string {
+	return settings.String("profile")
+}
+
+// profileNames returns the profiles of the tasks, their tags, sorted
+func profileNames(scripts []Script) []string {
+	var names []string
+	for _, s := range scripts {
+		for _, tag := range s.Tags {
+			if !slices.Contains(names, tag) {
+				names = append(names, tag)
+			}
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// switchProfile activates the profile name, or none if name is empty, and
+// tells clients. scripts are the tasks whose profiles can be switched to.
+func switchProfile(name string, scripts []Script) error {
+	if name != "" && !slices.Contains(profileNames(scripts), name) {
+		return fmt.Errorf("profile %q does not exist", name)
+	}
+
+	profileMu.Lock()
+	defer profileMu.Unlock()
+	if name == activeProfile() {
+		return nil
+	}
+	settings.SetString("profile", name)
+	publishEvent(Event{Type: EventProfileSwitched, Profile: name})
+	return nil
+}
+
+// apiGetProfile returns the active profile and the profiles of the tasks
+// the client may access
+func apiGetProfile(c *fiber.Ctx) error {
+	return c.JSON(Profiles{
+		Active:   activeProfile(),
+		Profiles: append([]string{}, profileNames(accessibleScripts(c, getScripts()))...),
+	})
+}
+
+// apiSwitchProfile switches every client to another profile. Clients can
+// only switch to profiles of tasks they may access.
+func apiSwitchProfile(c *fiber.Ctx) error {
+	var req Profiles
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return badRequest(fmt.Errorf("invalid request: %w", err))
+	}
+	if err := switchProfile(req.Active, accessibleScripts(c, getScripts())); err != nil {
+		return badRequest(err)
+	}
+	entry := auditRequest(c, AuditProfile)
+	entry.Detail = req.Active
+	recordAudit(entry)
+	return apiGetProfile(c)
+}
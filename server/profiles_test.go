@@ -0,0 +1,53 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSwitchProfile(t *testing.T) {
+	defer settings.SetString("profile", "")
+
+	scripts := []Script{
+		{ID: 1, File: "lights.js", Tags: []string{"home", "evening"}},
+		{ID: 2, File: "stream.js", Tags: []string{"stream"}},
+		{ID: 3, File: "other.js"},
+	}
+	if names := profileNames(scripts); !slices.Equal(names, []string{"evening", "home", "stream"}) {
+		t.Errorf("Unexpected profiles %v", names)
+	}
+
+	events := subscribe()
+	defer unsubscribe(events)
+
+	if err := switchProfile("garage", scripts); err == nil {
+		t.Error("Expected an error for an unknown profile")
+	}
+	if err := switchProfile("home", scripts); err != nil {
+		t.Fatalf("Failed to switch profile: %v", err)
+	}
+	if activeProfile() != "home" {
+		t.Errorf("Expected home to be active, got %q", activeProfile())
+	}
+	if e := receiveEvents(t, events, 1)[0]; e.Type != EventProfileSwitched || e.Profile != "home" {
+		t.Errorf("Expected a profile switch to home, got %+v", e)
+	}
+
+	// Switching to the active profile changes nothing
+	if err := switchProfile("home", scripts); err != nil {
+		t.Fatalf("Failed to switch profile: %v", err)
+	}
+	select {
+	case e := <-events:
+		t.Errorf("Expected no event, got %s", e.Type)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := switchProfile("", scripts); err != nil {
+		t.Fatalf("Failed to leave the profile: %v", err)
+	}
+	if e := receiveEvents(t, events, 1)[0]; e.Type != EventProfileSwitched || e.Profile != "" {
+		t.Errorf("Expected a switch to no profile, got %+v", e)
+	}
+}
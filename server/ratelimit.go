@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Defaults of the limits, a limit of 0 turns it off
+const (
+	defaultClientRunLimit = 120
+	defaultScriptRunLimit = 60
+	defaultMaxProcesses   = 16
+)
+
+// healthCheckLimit is how many health and readiness checks an address may
+// send per minute, enough for any monitoring
+const healthCheckLimit = 60
+
+// processWait is how long a run waits for a process slot before it is
+// given up with errBusy
+var processWait = 30 * time.Second
+
+// busyRetryAfter is the Retry-After sent with errBusy, in seconds
+const busyRetryAfter = 5
+
+// errBusy is returned when no process slot became free in time
+var errBusy = errors.New("too many processes running, try again later")
+
+// maxBuckets is the number of rate limit buckets kept before full ones are
+// pruned
+const maxBuckets = 1000
+
+// limitSetting returns a non-negative number setting, or fallback if it is
+// not set or invalid
+func limitSetting(key string, fallback int) int {
+	n, err := strconv.Atoi(settings.String(key))
+	if err != nil || n < 0 {
+		return fallback
+	}
+	return n
+}
+
+// validateLimit checks a limit entered in the settings
+func validateLimit(name, value string) error {
+	if value == "" {
+		return nil
+	}
+	if n, err := strconv.Atoi(value); err != nil || n < 0 {
+		return fmt.Errorf("%s must be a number, 0 for no limit", name)
+	}
+	return nil
+}
+
+// clientRunLimit returns how many runs a single client may start per minute
+func clientRunLimit() int {
+	return limitSetting("rate_limit_client", defaultClientRunLimit)
+}
+
+// scriptRunLimit returns how often a single task may be run per minute by
+// requests
+func scriptRunLimit() int {
+	return limitSetting("rate_limit_script", defaultScriptRunLimit)
+}
+
+// maxProcesses returns how many child processes, scripts and the commands
+// of actions, may run at once
+func maxProcesses() int {
+	return limitSetting("max_processes", defaultMaxProcesses)
+}
+
+// bucket is a token bucket holding up to a minute's worth of runs
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter limits runs per key with token buckets that refill at limit
+// tokens per minute
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	// limited counts rejected runs
+	limited uint64
+}
+
+// runLimiter limits the runs requested by clients, webhooks and MQTT
+var runLimiter = &rateLimiter{buckets: map[string]*bucket{}}
+
+// healthLimiter limits the health and readiness checks per address
+var healthLimiter = &rateLimiter{buckets: map[string]*bucket{}}
+
+// refill returns the bucket of key with the tokens it gained since it was
+// last used
+func (l *rateLimiter) refill(key string, limit int, now time.Time) *bucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit), last: now}
+		l.buckets[key] = b
+	}
+	perSecond := float64(limit) / 60
+	b.tokens = math.Min(float64(limit), b.tokens+now.Sub(b.last).Seconds()*perSecond)
+	b.last = now
+	return b
+}
+
+// wait returns how long until the bucket holds a token
+func (b *bucket) wait(limit int) time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / (float64(limit) / 60) * float64(time.Second))
+}
+
+// allow takes a token from the client's and the task's bucket. If either is
+// empty nothing is taken and the wait until both have a token is returned.
+func (l *rateLimiter) allow(client string, scriptID int, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	type limited struct {
+		key   string
+		limit int
+	}
+	checks := []limited{
+		{"client:" + client, clientRunLimit()},
+		{"script:" + strconv.Itoa(scriptID), scriptRunLimit()},
+	}
+
+	var wait time.Duration
+	var buckets []*bucket
+	for _, check := range checks {
+		if check.limit == 0 {
+			continue
+		}
+		b := l.refill(check.key, check.limit, now)
+		wait = max(wait, b.wait(check.limit))
+		buckets = append(buckets, b)
+	}
+	if wait > 0 {
+		l.limited++
+		return wait, false
+	}
+	for _, b := range buckets {
+		b.tokens--
+	}
+	l.prune(now)
+	return 0, true
+}
+
+// allowKey takes a token from the bucket of key. If it is empty nothing is
+// taken and the wait until it has a token is returned.
+func (l *rateLimiter) allowKey(key string, limit int, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.refill(key, limit, now)
+	if wait := b.wait(limit); wait > 0 {
+		l.limited++
+		return wait, false
+	}
+	b.tokens--
+	l.prune(now)
+	return 0, true
+}
+
+// prune drops buckets that refilled completely, once there are many. They
+// behave the same as new ones.
+func (l *rateLimiter) prune(now time.Time) {
+	if len(l.buckets) <= maxBuckets {
+		return
+	}
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > time.Minute {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// limitedCount returns the number of rejected runs
+func (l *rateLimiter) limitedCount() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limited
+}
+
+// rateLimitKey identifies the sender of a request for rate limiting.
+// Paired clients are told apart by ID, everyone else by address.
+func rateLimitKey(c *fiber.Ctx) string {
+	if client, ok := requestClient(c); ok {
+		return client.ID
+	}
+	return c.IP()
+}
+
+// limitRun rejects a run request with 429 if the sender or the task
+// exceeded its rate limit. Retry-After tells the sender when to try again.
+func limitRun(c *fiber.Ctx, script Script) error {
+	wait, ok := runLimiter.allow(rateLimitKey(c), script.ID, time.Now())
+	if ok {
+		return nil
+	}
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return fiber.NewError(fiber.StatusTooManyRequests, fmt.Sprintf("too many runs of %s, try again later", script.Name()))
+}
+
+// busy answers a request whose run found no process slot with 503 and a
+// Retry-After header
+func busy(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(busyRetryAfter))
+	return fiber.NewError(fiber.StatusServiceUnavailable, errBusy.Error())
+}
+
+// processLimiter caps the number of child processes running at once
+type processLimiter struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	running int
+}
+
+func newProcessLimiter() *processLimiter {
+	l := &processLimiter{}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// processes limits the child processes of this server
+var processes = newProcessLimiter()
+
+// acquire waits until another child process may be started, and returns
+// the function releasing its slot. It gives up with errBusy once ctx is
+// done or after processWait. The limit is read again whenever a slot is
+// released or wake is called, so changing it takes effect for waiting
+// runs.
+func (l *processLimiter) acquire(ctx context.Context) (release func(), err error) {
+	ctx, cancel := context.WithTimeout(ctx, processWait)
+	defer cancel()
+	// Waiting runs cannot select on ctx, so they are woken to check it
+	stop := context.AfterFunc(ctx, l.wake)
+	defer stop()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for limit := maxProcesses(); limit > 0 && l.running >= limit; limit = maxProcesses() {
+		if ctx.Err() != nil {
+			return nil, errBusy
+		}
+		l.cond.Wait()
+	}
+	l.running++
+
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.running--
+		l.cond.Broadcast()
+	}, nil
+}
+
+// wake lets waiting runs check the limit again, for example after it was
+// changed in the settings
+func (l *processLimiter) wake() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cond.Broadcast()
+}
+
+// count returns the number of child processes running
+func (l *processLimiter) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.running
+}
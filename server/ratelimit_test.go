@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// setLimits sets the run limits for a test and turns them off again after it
+func setLimits(t *testing.T, client, script string) {
+	settings.SetString("rate_limit_client", client)
+	settings.SetString("rate_limit_script", script)
+	runLimiter = &rateLimiter{buckets: map[string]*bucket{}}
+	t.Cleanup(func() {
+		settings.SetString("rate_limit_client", "0")
+		settings.SetString("rate_limit_script", "0")
+	})
+}
+
+func TestRateLimiter(t *testing.T) {
+	setLimits(t, "2", "3")
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if _, ok := runLimiter.allow("tablet", 1, now); !ok {
+			t.Fatalf("Expected run %d to be allowed", i+1)
+		}
+	}
+	wait, ok := runLimiter.allow("tablet", 1, now)
+	if ok || wait != 30*time.Second {
+		t.Errorf("Expected the client to wait 30s, got %v %v", wait, ok)
+	}
+
+	// The rejected run took no token from the task
+	if _, ok := runLimiter.allow("phone", 1, now); !ok {
+		t.Error("Expected another client to run the task")
+	}
+	wait, ok = runLimiter.allow("laptop", 1, now)
+	if ok || wait != 20*time.Second {
+		t.Errorf("Expected the task to wait 20s, got %v %v", wait, ok)
+	}
+	if _, ok := runLimiter.allow("laptop", 2, now); !ok {
+		t.Error("Expected another task to run")
+	}
+
+	// Buckets refill over time
+	if _, ok := runLimiter.allow("tablet", 1, now.Add(30*time.Second)); !ok {
+		t.Error("Expected the client to run again after waiting")
+	}
+	if got := runLimiter.limitedCount(); got != 2 {
+		t.Errorf("Expected 2 rejected runs, got %d", got)
+	}
+
+	setLimits(t, "0", "0")
+	for i := 0; i < 100; i++ {
+		if _, ok := runLimiter.allow("tablet", 1, now); !ok {
+			t.Fatal("Expected no limit")
+		}
+	}
+}
+
+func TestRunRateLimitAPI(t *testing.T) {
+	// Setup test directory
+	tmpDir := t.TempDir()
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+
+	// Run scripts with sh so the test does not depend on bun
+	originalRuntime := scriptRuntime
+	scriptRuntime = []string{"sh"}
+	defer func() { scriptRuntime = originalRuntime }()
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "ping.js"), []byte("echo pong"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	scriptsData, _ := json.MarshalIndent([]Script{{ID: 1, File: "ping.js"}}, "", "\t")
+	if err := os.WriteFile(filepath.Join(tmpDir, "scripts.json"), scriptsData, 0644); err != nil {
+		t.Fatalf("Failed to create scripts.json: %v", err)
+	}
+
+	originalKey := getAPIKey
+	getAPIKey = func() string { return "test-key" }
+	defer func() { getAPIKey = originalKey }()
+
+	client, token := newClient("tablet")
+	if err := addClient(client); err != nil {
+		t.Fatalf("Failed to add client: %v", err)
+	}
+	defer revokeClient(client.ID)
+
+	historyMu.Lock()
+	original := runHistory
+	runHistory = nil
+	historyMu.Unlock()
+	defer func() {
+		historyMu.Lock()
+		runHistory = original
+		historyMu.Unlock()
+	}()
+
+	setLimits(t, "2", "0")
+	spec := loadOpenAPISpec(t)
+	app := newFiberApp()
+
+	run := func(path, bearer string) int {
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set("Authorization", "Bearer "+bearer)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to test request: %v", err)
+		}
+		if resp.StatusCode == fiber.StatusTooManyRequests {
+			if resp.Header.Get(fiber.HeaderRetryAfter) != "30" {
+				t.Errorf("Expected Retry-After 30, got %q", resp.Header.Get(fiber.HeaderRetryAfter))
+			}
+			if err := spec.checkResponse("POST", "/api/v1/scripts/{id}/run", resp); err != nil {
+				t.Error(err)
+			}
+		}
+		return resp.StatusCode
+	}
+
+	for i, want := range []int{200, 200, 429} {
+		if got := run("/api/v1/scripts/1/run", "test-key"); got != want {
+			t.Errorf("Run %d: expected status %d, got %d", i+1, want, got)
+		}
+	}
+	// Paired clients have limits of their own
+	if got := run("/api/v1/scripts/1/run/stream", token); got != fiber.StatusOK {
+		t.Errorf("Expected the paired client to run, got %d", got)
+	}
+
+	history := getRunHistory(func(RunResult) bool { return true })
+	if len(history) != 3 {
+		t.Errorf("Expected rejected runs not to run, got %d runs", len(history))
+	}
+
+	// Runs that find no process slot in time are answered with 503
+	settings.SetString("max_processes", "1")
+	defer settings.SetString("max_processes", "")
+	originalWait := processWait
+	processWait = 50 * time.Millisecond
+	defer func() { processWait = originalWait }()
+	release, _ := processes.acquire(context.Background())
+	defer release()
+
+	req := httptest.NewRequest("POST", "/api/v1/scripts/1/run", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to test request: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusServiceUnavailable || resp.Header.Get(fiber.HeaderRetryAfter) == "" {
+		t.Errorf("Expected status 503 with Retry-After, got %d", resp.StatusCode)
+	}
+	if err := spec.checkResponse("POST", "/api/v1/scripts/{id}/run", resp); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProcessLimiter(t *testing.T) {
+	settings.SetString("max_processes", "1")
+	defer settings.SetString("max_processes", "")
+
+	l := newProcessLimiter()
+	acquire := func() func() {
+		t.Helper()
+		release, err := l.acquire(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to acquire a process slot: %v", err)
+		}
+		return release
+	}
+	release := acquire()
+
+	acquired := make(chan func())
+	go func() { acquired <- acquire() }()
+	select {
+	case <-acquired:
+		t.Fatal("Expected the second process to wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if l.count() != 1 {
+		t.Errorf("Expected 1 process, got %d", l.count())
+	}
+
+	release()
+	select {
+	case release = <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the second process to start once the first finished")
+	}
+	release()
+
+	// Without a limit processes never wait
+	settings.SetString("max_processes", "0")
+	release, other := acquire(), acquire()
+	if l.count() != 2 {
+		t.Errorf("Expected 2 processes without a limit, got %d", l.count())
+	}
+	release()
+	other()
+}
+
+func TestProcessLimiterGivesUp(t *testing.T) {
+	settings.SetString("max_processes", "1")
+	defer settings.SetString("max_processes", "")
+	originalWait := processWait
+	processWait = 50 * time.Millisecond
+	defer func() { processWait = originalWait }()
+
+	l := newProcessLimiter()
+	release, _ := l.acquire(context.Background())
+	defer release()
+
+	if _, err := l.acquire(context.Background()); err != errBusy {
+		t.Errorf("Expected errBusy after waiting, got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.acquire(ctx); err != errBusy {
+		t.Errorf("Expected errBusy for a cancelled request, got %v", err)
+	}
+
+	// Raising the limit lets waiting runs start without a run finishing
+	processWait = time.Minute
+	acquired := make(chan error)
+	go func() {
+		other, err := l.acquire(context.Background())
+		if err == nil {
+			other()
+		}
+		acquired <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	settings.SetString("max_processes", "2")
+	l.wake()
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Errorf("Expected a slot after raising the limit, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the waiting run to start after raising the limit")
+	}
+	if l.count() != 1 {
+		t.Errorf("Expected the slot to be released, %d processes running", l.count())
+	}
+}
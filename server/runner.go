@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Run triggers
+const (
+	TriggerClient   = "client"
+	TriggerSchedule = "schedule"
+	TriggerWebhook  = "webhook"
+	TriggerMacro    = "macro"
+	TriggerEditor   = "editor"
+	TriggerMQTT     = "mqtt"
+)
+
+// scriptRuntime is the command scripts are run with, followed by the script path
+var scriptRuntime = []string{"bun", "run"}
+
+var errAlreadyRunning = errors.New("script is already running")
+
+// RunOptions describes how a script run was requested
+type RunOptions struct {
+	Trigger string
+	// Exclusive runs are refused while the same script is already running
+	Exclusive bool
+	// Stdin is passed to the script's standard input
+	Stdin []byte
+	// Args are passed to the script after its path
+	Args []string
+	// Stdout and Stderr receive the script's output as it is written, in
+	// addition to the result
+	Stdout, Stderr io.Writer
+	// Context ends waiting for a process slot early, such as when the
+	// request that started the run is cancelled
+	Context context.Context
+
+	// depth counts how many macros this run is nested in
+	depth int
+}
+
+// RunResult records the outcome of a single script run
+type RunResult struct {
+	ScriptID int           `json:"scriptId"`
+	Script   string        `json:"script"`
+	Trigger  string        `json:"trigger"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+	ExitCode int           `json:"exitCode"`
+	Stdout   string        `json:"stdout"`
+	Stderr   string        `json:"stderr"`
+	Error    string        `json:"error,omitempty"`
+	Skipped  bool          `json:"skipped,omitempty"`
+	// Steps holds the per-step results of macros
+	Steps []StepResult `json:"steps,omitempty"`
+}
+
+var (
+	activeMu   sync.Mutex
+	activeRuns = map[int]int{}
+)
+
+// acquireRun marks a script as running. It fails for exclusive runs when
+// the script already has a run in progress. Clients are told when the
+// script's button becomes busy and idle again.
+func acquireRun(script Script, exclusive bool) (release func(), ok bool) {
+	activeMu.Lock()
+	defer activeMu.Unlock()
+
+	id := script.ID
+	if exclusive && activeRuns[id] > 0 {
+		return nil, false
+	}
+	if activeRuns[id]++; activeRuns[id] == 1 {
+		publishButtonState(script, ButtonRunning)
+	}
+
+	return func() {
+		activeMu.Lock()
+		defer activeMu.Unlock()
+		if activeRuns[id]--; activeRuns[id] <= 0 {
+			delete(activeRuns, id)
+			publishButtonState(script, ButtonIdle)
+		}
+	}, true
+}
+
+// isRunning reports whether the script has a run in progress
+func isRunning(id int) bool {
+	activeMu.Lock()
+	defer activeMu.Unlock()
+	return activeRuns[id] > 0
+}
+
+// runScript executes a registered script with bun, the steps of a macro or
+// a native action, and records the result in the run history
+func runScript(script Script, opts RunOptions) (RunResult, error) {
+	result := RunResult{
+		ScriptID: script.ID,
+		Script:   script.Name(),
+		Trigger:  opts.Trigger,
+		Started:  time.Now(),
+	}
+
+	release, ok := acquireRun(script, opts.Exclusive)
+	if !ok {
+		result.Skipped = true
+		result.Error = errAlreadyRunning.Error()
+		recordRun(result)
+		observeRun(result)
+		return result, errAlreadyRunning
+	}
+	defer release()
+	publishRun(EventRunStarted, script, result)
+
+	var err error
+	switch script.Type {
+	case TypeMacro:
+		err = runMacro(script, opts, &result)
+	case TypeAction:
+		err = runAction(script, &result)
+	default:
+		env := []string{
+			"OPENDECK_SCRIPT_ID=" + strconv.Itoa(script.ID),
+			"OPENDECK_TRIGGER=" + opts.Trigger,
+		}
+		env = append(env, variablesEnv(getVariables())...)
+
+		var path string
+		if path, err = resolveScriptPath(script.File); err != nil {
+			result.ExitCode = -1
+			result.Error = err.Error()
+			break
+		}
+		err = runFile(path, opts, env, &result)
+	}
+
+	recordRun(result)
+	observeRun(result)
+	publishRun(EventRunFinished, script, result)
+	notifyRun(script, result)
+	return result, err
+}
+
+// runFile runs a script file with bun and fills in the output, exit code
+// and duration of result. env is added to the server's environment.
+func runFile(path string, opts RunOptions, env []string, result *RunResult) error {
+	var stdout, stderr bytes.Buffer
+
+	args := append(slices.Clone(scriptRuntime[1:]), path)
+	args = append(args, opts.Args...)
+	proc := exec.Command(scriptRuntime[0], args...)
+	proc.Stdin = bytes.NewReader(opts.Stdin)
+	proc.Stdout = &stdout
+	proc.Stderr = &stderr
+	if opts.Stdout != nil {
+		proc.Stdout = io.MultiWriter(&stdout, opts.Stdout)
+	}
+	if opts.Stderr != nil {
+		proc.Stderr = io.MultiWriter(&stderr, opts.Stderr)
+	}
+	proc.Env = append(os.Environ(), env...)
+
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	release, err := processes.acquire(ctx)
+	if err != nil {
+		result.Error = err.Error()
+		result.ExitCode = -1
+		return err
+	}
+	start := time.Now()
+	err = proc.Run()
+	result.Duration = time.Since(start)
+	release()
+	result.Stdout = strings.TrimSpace(stdout.String())
+	result.Stderr = strings.TrimSpace(stderr.String())
+
+	if err != nil {
+		result.Error = err.Error()
+		result.ExitCode = -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			result.ExitCode = exitErr.ExitCode()
+		}
+	}
+
+	return err
+}
+
+// runBuffer runs unsaved script content, as if it were a script file with
+// extension ext. The temporary file is created in the scripts directory so
+// relative imports resolve the same way. The run is not recorded.
+func runBuffer(content, ext string, opts RunOptions) (RunResult, error) {
+	result := RunResult{Trigger: opts.Trigger, Started: time.Now(), ExitCode: -1}
+
+	f, err := os.CreateTemp(getScriptsPath(), ".opendeck-run-*"+ext)
+	if err != nil {
+		return result, fmt.Errorf("failed to create temporary script: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return result, fmt.Errorf("failed to write temporary script: %w", err)
+	}
+
+	env := []string{"OPENDECK_TRIGGER=" + opts.Trigger}
+	env = append(env, variablesEnv(getVariables())...)
+	result.ExitCode = 0
+	err = runFile(f.Name(), opts, env, &result)
+	return result, err
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestRunBuffer(t *testing.T) {
+	// Setup test directory
+	tmpDir := t.TempDir()
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+
+	// Run scripts with sh so the test does not depend on bun
+	originalRuntime := scriptRuntime
+	scriptRuntime = []string{"sh"}
+	defer func() { scriptRuntime = originalRuntime }()
+
+	content := `echo "args: $1 $2"; echo oops >&2; exit 2`
+	result, err := runBuffer(content, ".ts", RunOptions{Trigger: TriggerEditor, Args: []string{"a", "b"}})
+	if err == nil {
+		t.Error("Expected non-zero exit to return an error")
+	}
+
+	if result.Stdout != "args: a b" {
+		t.Errorf("Expected stdout %q, got %q", "args: a b", result.Stdout)
+	}
+	if result.Stderr != "oops" {
+		t.Errorf("Expected stderr %q, got %q", "oops", result.Stderr)
+	}
+	if result.ExitCode != 2 {
+		t.Errorf("Expected exit code 2, got %d", result.ExitCode)
+	}
+
+	// The temporary file is cleaned up
+	entries, _ := os.ReadDir(tmpDir)
+	if len(entries) != 0 {
+		t.Errorf("Expected scripts directory to be empty, found %d entries", len(entries))
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// UpcomingRun describes the next time a scheduled script will run
+type UpcomingRun struct {
+	ScriptID int       `json:"scriptId"`
+	Script   string    `json:"script"`
+	Spec     string    `json:"spec"`
+	Next     time.Time `json:"next"`
+}
+
+// Scheduler runs scripts according to the cron schedules in their metadata
+type Scheduler struct {
+	mu      sync.Mutex
+	cron    *cron.Cron
+	entries map[cron.EntryID]UpcomingRun
+	running bool
+}
+
+var scheduler = NewScheduler()
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{
+		cron:    cron.New(),
+		entries: map[cron.EntryID]UpcomingRun{},
+	}
+}
+
+// validateSchedule checks that spec is a valid cron expression
+func validateSchedule(spec string) error {
+	if _, err := cron.ParseStandard(spec); err != nil {
+		return fmt.Errorf("invalid schedule %q: %w", spec, err)
+	}
+	return nil
+}
+
+// Start begins running scheduled scripts in the background
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cron.Start()
+	s.running = true
+}
+
+// Stop halts the scheduler. Runs already in progress are not interrupted.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cron.Stop()
+	s.running = false
+}
+
+// Running reports whether scheduled scripts are run
+func (s *Scheduler) Running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+// Reload replaces all schedule entries with those defined in scripts.
+// Invalid expressions are skipped and reported in the returned errors.
+func (s *Scheduler) Reload(scripts []Script) []error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id := range s.entries {
+		s.cron.Remove(id)
+	}
+	clear(s.entries)
+
+	var errs []error
+	for _, script := range scripts {
+		for _, spec := range script.Schedules {
+			scriptID := script.ID
+			id, err := s.cron.AddFunc(spec, func() { runScheduled(scriptID) })
+			if err != nil {
+				errs = append(errs, fmt.Errorf("script %d: invalid schedule %q: %w", script.ID, spec, err))
+				continue
+			}
+			s.entries[id] = UpcomingRun{ScriptID: script.ID, Script: script.Name(), Spec: spec}
+		}
+	}
+
+	return errs
+}
+
+// Upcoming returns the next run of every schedule entry, soonest first
+func (s *Scheduler) Upcoming() []UpcomingRun {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []UpcomingRun
+	for _, entry := range s.cron.Entries() {
+		run, ok := s.entries[entry.ID]
+		if !ok {
+			continue
+		}
+		run.Next = entry.Next
+		if run.Next.IsZero() {
+			// The cron loop has not been started, compute it ourselves
+			run.Next = entry.Schedule.Next(time.Now())
+		}
+		out = append(out, run)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Next.Before(out[j].Next)
+	})
+	return out
+}
+
+// runScheduled runs a script for the scheduler, skipping it if a previous
+// run of the same script has not finished yet
+func runScheduled(id int) {
+	scripts := getScripts()
+	idx := slices.IndexFunc(scripts, func(s Script) bool { return s.ID == id })
+	if idx < 0 {
+		return
+	}
+
+	result, err := runScript(scripts[idx], RunOptions{Trigger: TriggerSchedule, Exclusive: true})
+	if err != nil {
+		fmt.Printf("Scheduled run of %s failed: %s\n", result.Script, err)
+	}
+}
+
+// reloadSchedules reloads the scheduler from the current scripts.json
+func reloadSchedules() {
+	for _, err := range scheduler.Reload(getScripts()) {
+		fmt.Println("Failed to schedule script:", err)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateSchedule(t *testing.T) {
+	testCases := []struct {
+		spec    string
+		wantErr bool
+	}{
+		{"55 9 * * 1-5", false},
+		{"*/5 * * * *", false},
+		{"@every 5m", false},
+		{"@hourly", false},
+		{"61 * * * *", true},
+		{"* * *", true},
+		{"not a schedule", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.spec, func(t *testing.T) {
+			err := validateSchedule(tc.spec)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("validateSchedule(%q) error = %v, wantErr %v", tc.spec, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestSchedulerReload(t *testing.T) {
+	s := NewScheduler()
+	scripts := []Script{
+		{ID: 1, File: "standup.ts", Schedules: []string{"55 9 * * 1-5"}},
+		{ID: 2, File: "status.ts", Schedules: []string{"*/5 * * * *", "bogus"}},
+		{ID: 3, File: "manual.ts"},
+	}
+
+	errs := s.Reload(scripts)
+	if len(errs) != 1 {
+		t.Errorf("Expected 1 schedule error, got %d: %v", len(errs), errs)
+	}
+
+	upcoming := s.Upcoming()
+	if len(upcoming) != 2 {
+		t.Fatalf("Expected 2 upcoming runs, got %d", len(upcoming))
+	}
+	if upcoming[0].Next.After(upcoming[1].Next) {
+		t.Error("Expected upcoming runs to be sorted by next run time")
+	}
+	for _, run := range upcoming {
+		if run.Next.IsZero() {
+			t.Errorf("Expected next run time for %s", run.Script)
+		}
+	}
+
+	// Reloading replaces the previous entries
+	s.Reload(scripts[:1])
+	if upcoming := s.Upcoming(); len(upcoming) != 1 || upcoming[0].ScriptID != 1 {
+		t.Errorf("Expected only script 1 after reload, got %+v", upcoming)
+	}
+}
+
+func TestScheduledRunSkipsWhenRunning(t *testing.T) {
+	// Setup test directory
+	tmpDir := t.TempDir()
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+
+	scripts := []Script{{ID: 42, File: "slow.ts", Schedules: []string{"@every 1m"}}}
+	scriptsData, _ := json.MarshalIndent(scripts, "", "\t")
+	err := os.WriteFile(filepath.Join(tmpDir, "scripts.json"), scriptsData, 0644)
+	if err != nil {
+		t.Fatalf("Failed to create scripts.json: %v", err)
+	}
+
+	// Pretend a client started the script
+	release, ok := acquireRun(Script{ID: 42}, false)
+	if !ok {
+		t.Fatal("Failed to mark script as running")
+	}
+	defer release()
+
+	runScheduled(42)
+
+	history := getRunHistory(func(r RunResult) bool { return r.ScriptID == 42 })
+	if len(history) == 0 {
+		t.Fatal("Expected the skipped run to be recorded")
+	}
+	if !history[0].Skipped || history[0].Trigger != TriggerSchedule {
+		t.Errorf("Expected a skipped scheduled run, got %+v", history[0])
+	}
+}
+
+func TestAcquireRun(t *testing.T) {
+	release, ok := acquireRun(Script{ID: 7}, true)
+	if !ok {
+		t.Fatal("Expected first exclusive run to be allowed")
+	}
+	if _, ok := acquireRun(Script{ID: 7}, true); ok {
+		t.Error("Expected second exclusive run to be refused")
+	}
+	if !isRunning(7) {
+		t.Error("Expected script to be reported as running")
+	}
+
+	release()
+	if isRunning(7) {
+		t.Error("Expected script to be idle after release")
+	}
+}
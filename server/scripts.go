@@ -2,23 +2,49 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
+	"sync"
 )
 
-// Script represents a task script with an ID and filename
+// Script represents a task script with an ID and filename. Macros and
+// native actions have no file and are identified by their title instead.
 type Script struct {
 	ID   int    `json:"id"`
 	File string `json:"file"`
+	// Type is empty for bun scripts
+	Type  string `json:"type,omitempty"`
+	Title string `json:"title,omitempty"`
+	// Steps are run in order by macros
+	Steps []MacroStep `json:"steps,omitempty"`
+	// Action and Params configure the native action of action tasks
+	Action string            `json:"action,omitempty"`
+	Params map[string]string `json:"params,omitempty"`
+	// Schedules holds cron expressions the script is run on
+	Schedules []string `json:"schedules,omitempty"`
+	// Hook is the inbound webhook that triggers the script, if any
+	Hook *Hook `json:"hook,omitempty"`
+	// Tags group scripts for client permissions
+	Tags []string `json:"tags,omitempty"`
 }
 
 var getScriptsPath = func() string {
 	return filepath.Join(os.Getenv("HOME"), ".opendeck", "scripts")
 }
 
+// scriptExtensions are the file types bun scripts can have
+var scriptExtensions = []string{".js", ".ts", ".jsx", ".tsx", ".mjs", ".cjs"}
+
+// getDataPath returns the directory server state other than scripts is kept in
+var getDataPath = func() string {
+	return filepath.Join(os.Getenv("HOME"), ".opendeck")
+}
+
 func globExtensions(dir string, extensions []string) ([]string, error) {
 	var matches []string
 
@@ -28,7 +54,13 @@ func globExtensions(dir string, extensions []string) ([]string, error) {
 		if err != nil {
 			return nil, err
 		}
-		matches = append(matches, files...)
+		for _, file := range files {
+			// Hidden files, such as the temporary files of editor test runs,
+			// are not tasks
+			if !strings.HasPrefix(filepath.Base(file), ".") {
+				matches = append(matches, file)
+			}
+		}
 	}
 
 	return matches, nil
@@ -44,7 +76,7 @@ func getScripts() []Script {
 	scripts_json := filepath.Join(path, "scripts.json")
 	if _, err := os.Stat(scripts_json); os.IsNotExist(err) {
 		// get all .js and .ts files in the path
-		files, err := globExtensions(path, []string{".js", ".ts", ".jsx", ".tsx", ".mjs", ".cjs"})
+		files, err := globExtensions(path, scriptExtensions)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -70,7 +102,7 @@ func getScripts() []Script {
 	err = json.Unmarshal(data, &scripts)
 
 	if err != nil || len(scripts) == 0 {
-		files, _ := globExtensions(path, []string{".js", ".ts", ".jsx", ".tsx", ".mjs", ".cjs"})
+		files, _ := globExtensions(path, scriptExtensions)
 		scripts = make([]Script, len(files))
 		for i, file := range files {
 			scripts[i] = Script{
@@ -86,59 +118,283 @@ func getScripts() []Script {
 	return scripts
 }
 
+// scriptDisplayName returns a script file name without its extension
+func scriptDisplayName(file string) string {
+	return strings.TrimSuffix(file, filepath.Ext(file))
+}
+
+// Name returns the title of a script, falling back to its file name
+func (s Script) Name() string {
+	if s.Title != "" {
+		return s.Title
+	}
+	return scriptDisplayName(s.File)
+}
+
+// findScriptByName looks up a script by its file name, with or without
+// extension, or by its title
+func findScriptByName(scripts []Script, name string) (Script, bool) {
+	for _, s := range scripts {
+		if s.File == name || s.Name() == name {
+			return s, true
+		}
+	}
+	return Script{}, false
+}
+
+// resolveScriptPath returns the path of a script file inside the scripts
+// directory. Script files live directly in that directory, so names with
+// separators, parent references or absolute paths are rejected.
+func resolveScriptPath(filename string) (string, error) {
+	if filename == "" || filename == "." || filename == ".." ||
+		filepath.IsAbs(filename) || strings.ContainsAny(filename, `/\`) || filename == "scripts.json" {
+		return "", fmt.Errorf("invalid script file name %q", filename)
+	}
+
+	dir := filepath.Clean(getScriptsPath())
+	path := filepath.Join(dir, filename)
+	if rel, err := filepath.Rel(dir, path); err != nil || rel != filename {
+		return "", fmt.Errorf("script file %q is outside the scripts directory", filename)
+	}
+	return path, nil
+}
+
+// hasValidFile reports whether a script can be run from its file. Scripts
+// whose file escapes the scripts directory, for example through a tampered
+// scripts.json, are treated as if they did not exist.
+func hasValidFile(script Script) bool {
+	if script.Type != "" {
+		return true
+	}
+	_, err := resolveScriptPath(script.File)
+	return err == nil
+}
+
+// scriptsMu serializes the changes to scripts.json. Callers that check the
+// current tasks before changing them, such as the API's ETag checks, hold
+// it across both and use the Locked variants of the helpers.
+var scriptsMu sync.Mutex
+
 // writeScript creates a new script file
 func writeScript(id int, filename string, content string) error {
-	path := getScriptsPath()
+	scriptsMu.Lock()
+	defer scriptsMu.Unlock()
+	return writeScriptLocked(id, filename, content)
+}
+
+// writeScriptLocked is writeScript for callers holding scriptsMu
+func writeScriptLocked(id int, filename string, content string) error {
+	return createScriptLocked(Script{ID: id, File: filename}, content)
+}
+
+// createScriptLocked writes the file of a new script and adds it to
+// scripts.json with all its metadata in one write. The file is removed
+// again if scripts.json cannot be written. Callers hold scriptsMu.
+func createScriptLocked(script Script, content string) error {
 	scripts := getScripts()
 
+	path, err := resolveScriptPath(script.File)
+	if err != nil {
+		return err
+	}
+
 	// Check if ID already exists
-	if slices.ContainsFunc(scripts, func(s Script) bool { return s.ID == id }) {
-		return fmt.Errorf("script with ID %d already exists", id)
+	if slices.ContainsFunc(scripts, func(s Script) bool { return s.ID == script.ID }) {
+		return fmt.Errorf("script with ID %d already exists", script.ID)
 	}
 
 	// Write script file
-	err := os.WriteFile(filepath.Join(path, filename), []byte(content), 0644)
+	err = os.WriteFile(path, []byte(content), 0644)
 	if err != nil {
 		return fmt.Errorf("failed to write script file: %w", err)
 	}
 
 	// Update scripts.json
-	scripts = append(scripts, Script{ID: id, File: filename})
-	return writeScriptsJson(scripts)
+	if err := writeScriptsJson(append(scripts, script)); err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
 }
 
 // updateScript modifies an existing script
 func updateScript(script Script, newId int, content string) error {
-	path := getScriptsPath()
+	scriptsMu.Lock()
+	defer scriptsMu.Unlock()
+	return updateScriptLocked(script, newId, content)
+}
+
+// updateScriptLocked is updateScript for callers holding scriptsMu
+func updateScriptLocked(script Script, newId int, content string) error {
 	scripts := getScripts()
 
+	path, err := resolveScriptPath(script.File)
+	if err != nil {
+		return err
+	}
+
 	// Remove old script from list
 	scripts = slices.DeleteFunc(scripts, func(s Script) bool {
 		return s.ID == script.ID
 	})
 
 	// Write updated script file
-	err := os.WriteFile(filepath.Join(path, script.File), []byte(content), 0644)
+	err = os.WriteFile(path, []byte(content), 0644)
 	if err != nil {
 		return fmt.Errorf("failed to write script file: %w", err)
 	}
 
-	// Update scripts.json with new ID
-	scripts = append(scripts, Script{ID: newId, File: script.File})
+	// Update scripts.json with new ID, keeping the rest of the metadata
+	script.ID = newId
+	scripts = append(scripts, script)
 	return writeScriptsJson(scripts)
 }
 
+// writeScriptMetadata adds a task without a script file, such as a macro
+func writeScriptMetadata(script Script) error {
+	scriptsMu.Lock()
+	defer scriptsMu.Unlock()
+	return writeScriptMetadataLocked(script)
+}
+
+// writeScriptMetadataLocked is writeScriptMetadata for callers holding scriptsMu
+func writeScriptMetadataLocked(script Script) error {
+	scripts := getScripts()
+
+	if slices.ContainsFunc(scripts, func(s Script) bool { return s.ID == script.ID }) {
+		return fmt.Errorf("script with ID %d already exists", script.ID)
+	}
+
+	return writeScriptsJson(append(scripts, script))
+}
+
+// updateScriptMetadata replaces the metadata of the task with ID oldId
+func updateScriptMetadata(oldId int, script Script) error {
+	scriptsMu.Lock()
+	defer scriptsMu.Unlock()
+	return updateScriptMetadataLocked(oldId, script)
+}
+
+// updateScriptMetadataLocked is updateScriptMetadata for callers holding scriptsMu
+func updateScriptMetadataLocked(oldId int, script Script) error {
+	scripts := getScripts()
+
+	if script.ID != oldId && slices.ContainsFunc(scripts, func(s Script) bool { return s.ID == script.ID }) {
+		return fmt.Errorf("script with ID %d already exists", script.ID)
+	}
+
+	scripts = slices.DeleteFunc(scripts, func(s Script) bool {
+		return s.ID == oldId
+	})
+	return writeScriptsJson(append(scripts, script))
+}
+
+// deleteScript removes a task from scripts.json. The script file is
+// deleted too, unless another task still uses it.
+func deleteScript(id int) error {
+	scriptsMu.Lock()
+	defer scriptsMu.Unlock()
+	return deleteScriptLocked(id)
+}
+
+// deleteScriptLocked is deleteScript for callers holding scriptsMu
+func deleteScriptLocked(id int) error {
+	scripts := getScripts()
+	script, ok := findScriptByID(scripts, id)
+	if !ok {
+		return fmt.Errorf("script with ID %d does not exist", id)
+	}
+
+	scripts = slices.DeleteFunc(scripts, func(s Script) bool { return s.ID == id })
+	if err := writeScriptsJson(scripts); err != nil {
+		return err
+	}
+
+	if script.File == "" || slices.ContainsFunc(scripts, func(s Script) bool { return s.File == script.File }) {
+		return nil
+	}
+	path, err := resolveScriptPath(script.File)
+	if err != nil {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete script file: %w", err)
+	}
+	return nil
+}
+
+// renameScript changes the file name and the title of a task, leaving
+// either unchanged if it is empty. Both are checked before the file is
+// moved, and the file is moved back if scripts.json cannot be updated.
+func renameScript(id int, newName, title string) error {
+	scriptsMu.Lock()
+	defer scriptsMu.Unlock()
+	return renameScriptLocked(id, newName, title)
+}
+
+// renameScriptLocked is renameScript for callers holding scriptsMu
+func renameScriptLocked(id int, newName, title string) error {
+	scripts := getScripts()
+	script, ok := findScriptByID(scripts, id)
+	if !ok {
+		return fmt.Errorf("script with ID %d does not exist", id)
+	}
+	if title != "" {
+		if script.Title = strings.TrimSpace(title); script.Title == "" {
+			return errors.New("title cannot be blank")
+		}
+	}
+	if newName == "" || newName == script.File {
+		return updateScriptMetadataLocked(id, script)
+	}
+	if script.File == "" {
+		return fmt.Errorf("script with ID %d has no file", id)
+	}
+
+	if !slices.Contains(scriptExtensions, filepath.Ext(newName)) {
+		return fmt.Errorf("unsupported script extension %q", filepath.Ext(newName))
+	}
+	if slices.ContainsFunc(scripts, func(s Script) bool { return s.File == newName }) {
+		return fmt.Errorf("script file %q already exists", newName)
+	}
+	oldPath, err := resolveScriptPath(script.File)
+	if err != nil {
+		return err
+	}
+	newPath, err := resolveScriptPath(newName)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(newPath); err == nil {
+		return fmt.Errorf("script file %q already exists", newName)
+	}
+
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return fmt.Errorf("failed to rename script file: %w", err)
+	}
+	script.File = newName
+	if err := updateScriptMetadataLocked(id, script); err != nil {
+		os.Rename(newPath, oldPath)
+		return err
+	}
+	return nil
+}
+
 // readScript reads the content of a script file
 func readScript(filename string) (string, error) {
-	path := getScriptsPath()
-	data, err := os.ReadFile(filepath.Join(path, filename))
+	path, err := resolveScriptPath(filename)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return "", fmt.Errorf("failed to read script file: %w", err)
 	}
 	return string(data), nil
 }
 
-// writeScriptsJson updates the scripts.json file
+// writeScriptsJson updates the scripts.json file and tells clients what
+// changed. Callers changing existing tasks hold scriptsMu.
 func writeScriptsJson(scripts []Script) error {
 	path := getScriptsPath()
 	data, err := json.MarshalIndent(scripts, "", "\t")
@@ -146,11 +402,33 @@ func writeScriptsJson(scripts []Script) error {
 		return fmt.Errorf("failed to marshal scripts: %w", err)
 	}
 
-	err = os.WriteFile(filepath.Join(path, "scripts.json"), data, 0644)
+	var before []Script
+	if old, err := os.ReadFile(filepath.Join(path, "scripts.json")); err == nil {
+		json.Unmarshal(old, &before)
+	}
+
+	// The file is replaced in one step, so readers not holding scriptsMu
+	// never see it half written
+	tmp, err := os.CreateTemp(path, ".scripts.json-*")
+	if err != nil {
+		return fmt.Errorf("failed to write scripts.json: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(path, "scripts.json"))
+	}
 	if err != nil {
 		return fmt.Errorf("failed to write scripts.json: %w", err)
 	}
 
+	publishScriptChanges(before, scripts)
 	return nil
 }
 
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strconv"
+	"sync"
 	"testing"
 )
 
@@ -61,6 +63,23 @@ func TestGetScripts(t *testing.T) {
 			setupJson:   `[]`,
 			wantScripts: 1, // Should find the file despite empty JSON
 		},
+		{
+			name: "hidden files are skipped",
+			setupFiles: []struct {
+				name    string
+				content string
+			}{
+				{
+					name:    "test.js",
+					content: "console.log('test')",
+				},
+				{
+					name:    ".opendeck-run-123.ts",
+					content: "console.log('test run')",
+				},
+			},
+			wantScripts: 1,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -255,3 +274,150 @@ func TestGetMaxScriptId(t *testing.T) {
 		t.Errorf("Expected max ID 3, got %d", maxId)
 	}
 }
+
+func TestUpdateScriptKeepsMetadata(t *testing.T) {
+	// Setup test directory
+	tmpDir := t.TempDir()
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+
+	script := Script{ID: 1, File: "test.js", Schedules: []string{"@hourly"}}
+	scriptsData, _ := json.MarshalIndent([]Script{script}, "", "\t")
+	err := os.WriteFile(filepath.Join(tmpDir, "scripts.json"), scriptsData, 0644)
+	if err != nil {
+		t.Fatalf("Failed to create scripts.json: %v", err)
+	}
+
+	if err := updateScript(script, 2, "console.log('updated')"); err != nil {
+		t.Fatalf("Failed to update script: %v", err)
+	}
+
+	scripts := getScripts()
+	if len(scripts) != 1 || scripts[0].ID != 2 {
+		t.Fatalf("Expected script with ID 2, got %+v", scripts)
+	}
+	if len(scripts[0].Schedules) != 1 || scripts[0].Schedules[0] != "@hourly" {
+		t.Errorf("Expected schedules to be kept, got %v", scripts[0].Schedules)
+	}
+}
+
+func TestScriptMetadata(t *testing.T) {
+	// Setup test directory
+	tmpDir := t.TempDir()
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+
+	if err := writeScript(1, "test.js", "console.log('test')"); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+
+	macro := Script{ID: 2, Type: TypeMacro, Title: "Morning", Steps: []MacroStep{{Type: StepScript, ScriptID: 1}}}
+	if err := writeScriptMetadata(macro); err != nil {
+		t.Fatalf("Failed to write macro: %v", err)
+	}
+	if err := writeScriptMetadata(macro); err == nil {
+		t.Error("Expected duplicate ID to fail")
+	}
+
+	macro.ID = 1
+	if err := updateScriptMetadata(2, macro); err == nil {
+		t.Error("Expected update to an ID in use to fail")
+	}
+
+	macro.ID = 3
+	macro.Title = "Evening"
+	if err := updateScriptMetadata(2, macro); err != nil {
+		t.Fatalf("Failed to update macro: %v", err)
+	}
+
+	script, ok := findScriptByName(getScripts(), "Evening")
+	if !ok || script.ID != 3 || len(script.Steps) != 1 {
+		t.Errorf("Expected updated macro, got %+v", script)
+	}
+	if _, ok := findScriptByName(getScripts(), "test"); !ok {
+		t.Error("Expected script to be found by name without extension")
+	}
+}
+
+func TestResolveScriptPath(t *testing.T) {
+	// Setup test directory
+	tmpDir := t.TempDir()
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+
+	testCases := []struct {
+		name    string
+		file    string
+		wantErr bool
+	}{
+		{"plain file", "test.ts", false},
+		{"dotted name", "my.task.ts", false},
+		{"empty", "", true},
+		{"parent directory", "..", true},
+		{"relative traversal", "../evil.js", true},
+		{"nested traversal", "sub/../../evil.js", true},
+		{"subdirectory", "sub/test.js", true},
+		{"absolute path", "/etc/passwd", true},
+		{"windows separator", `..\evil.js`, true},
+		{"metadata file", "scripts.json", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path, err := resolveScriptPath(tc.file)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("resolveScriptPath(%q) error = %v, wantErr %v", tc.file, err, tc.wantErr)
+			}
+			if err == nil && filepath.Dir(path) != tmpDir {
+				t.Errorf("Expected %q to resolve inside %q, got %q", tc.file, tmpDir, path)
+			}
+		})
+	}
+
+	if err := writeScript(1, "../escape.ts", "console.log('x')"); err == nil {
+		t.Error("Expected writeScript to reject a path outside the scripts directory")
+	}
+	if _, err := readScript("../../etc/passwd"); err == nil {
+		t.Error("Expected readScript to reject a path outside the scripts directory")
+	}
+}
+
+func TestConcurrentScriptChanges(t *testing.T) {
+	// Setup test directory
+	tmpDir := t.TempDir()
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "scripts.json"), []byte("[]"), 0644); err != nil {
+		t.Fatalf("Failed to create scripts.json: %v", err)
+	}
+
+	// Writers from the GUI and the API interleave without losing changes
+	var wg sync.WaitGroup
+	for id := 1; id <= 20; id++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if id%2 == 0 {
+				scriptsMu.Lock()
+				defer scriptsMu.Unlock()
+				writeScriptMetadataLocked(Script{ID: id, Type: TypeMacro, Title: strconv.Itoa(id)})
+				return
+			}
+			writeScriptMetadata(Script{ID: id, Type: TypeMacro, Title: strconv.Itoa(id)})
+		}()
+	}
+	wg.Wait()
+
+	if got := len(getScripts()); got != 20 {
+		t.Errorf("Expected 20 scripts, got %d", got)
+	}
+	entries, _ := os.ReadDir(tmpDir)
+	if len(entries) != 1 {
+		t.Errorf("Expected only scripts.json to be left, found %d entries", len(entries))
+	}
+}
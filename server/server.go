@@ -1,85 +1,269 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"net"
 	"net/url"
-	"os/exec"
-	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
-	"fyne.io/fyne/v2"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/grandcat/zeroconf"
 )
 
-var (
-	fiberApp *fiber.App
-	// Channel to signal when server is ready
-	serverReady chan bool
-)
+// shutdownTimeout is how long Stop waits for requests in progress
+const shutdownTimeout = 5 * time.Second
+
+// Server serves the API. Start returns once the server is listening, so
+// errors such as the port being in use are returned to the caller instead
+// of being lost in a goroutine.
+type Server struct {
+	mu        sync.Mutex
+	app       *fiber.App
+	listeners []net.Listener
+	// mdns advertises the server on the local network, if enabled
+	mdns *zeroconf.Server
+	// done is closed once the running app stopped serving on all listeners
+	done chan struct{}
+	// err is the error that stopped the server from starting or serving
+	err error
+}
+
+// server is the API server of this process
+var server = &Server{}
+
+// newFiberApp creates the app with all routes
+func newFiberApp() *fiber.App {
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(cors.New())
+
+	registerAPIRoutes(app)
+
+	// Name based routes kept for clients that predate the v1 API
+	app.Get("/scripts", requireAuth, fiberGetScripts)
+	app.Get("/scripts/:id", requireAuth, executeScript)
+
+	app.Post("/hooks/:token", fiberRunHook)
 
-// StartServer initializes and starts the Fiber server
-func StartServer() {
-	// Create the channel if it doesn't exist
-	if serverReady == nil {
-		serverReady = make(chan bool, 1)
+	registerWebUI(app)
+
+	app.Get("/healthz", limitHealth, fiberHealth)
+	app.Get("/readyz", limitHealth, fiberReady)
+	app.Get("/metrics", requireAPIKey, fiberMetrics)
+	app.Get("/openapi.json", fiberOpenAPI)
+	return app
+}
+
+// serverPort returns the port configured in the settings
+func serverPort() string {
+	return settings.StringWithFallback("port", "9212")
+}
+
+// Start starts serving in the background on the configured address, and
+// the Unix socket if one is set. It fails if the server is already running
+// or cannot listen.
+func (s *Server) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.app != nil {
+		return errors.New("server is already running")
 	}
 
-	go func() {
-		if fiberApp != nil {
-			fiberApp.Shutdown()
-		}
-		fiberApp = fiber.New()
+	getScripts()
 
-		getScripts()
+	var listeners []net.Listener
+	fail := func(err error) error {
+		for _, ln := range listeners {
+			ln.Close()
+		}
+		s.err = fmt.Errorf("failed to start server: %w", err)
+		return s.err
+	}
 
-		fiberApp.Use(cors.New())
+	ln, err := listen(net.JoinHostPort(bindAddress(), serverPort()))
+	if err != nil {
+		return fail(err)
+	}
+	listeners = append(listeners, ln)
+	if path := unixSocketPath(); path != "" {
+		ln, err := listenUnix(path)
+		if err != nil {
+			return fail(err)
+		}
+		listeners = append(listeners, ln)
+	}
 
-		fiberApp.Get("/scripts", fiberGetScripts)
-		fiberApp.Get("/scripts/:id", executeScript)
+	app := newFiberApp()
+	done := make(chan struct{})
+	s.app, s.listeners, s.done, s.err = app, listeners, done, nil
 
-		port := fyne.CurrentApp().Preferences().StringWithFallback("port", "9212")
+	if useMDNS() {
+		// Clients can still connect by address, so this is not fatal
+		if s.mdns, err = advertise(listeners[0].Addr().String()); err != nil {
+			fmt.Println("Failed to advertise server:", err)
+		}
+	}
 
-		// Signal that the server is ready before starting to listen
-		serverReady <- true
+	var wg sync.WaitGroup
+	for _, ln := range listeners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := app.Listener(ln)
 
-		fiberApp.Listen(":" + port)
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			// Serving only ends by itself on errors, Stop clears s.app first
+			if s.app == app {
+				if err == nil {
+					err = errors.New("server stopped unexpectedly")
+				}
+				s.app = nil
+				s.err = fmt.Errorf("server stopped: %w", err)
+				if s.mdns != nil {
+					s.mdns.Shutdown()
+					s.mdns = nil
+				}
+				fmt.Println("Error:", s.err)
+				for _, ln := range listeners {
+					ln.Close()
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(done)
 	}()
+	return nil
+}
+
+// Stop shuts the server down, waiting for requests in progress
+func (s *Server) Stop() error {
+	s.mu.Lock()
+	app, listeners, done, mdns := s.app, s.listeners, s.done, s.mdns
+	s.app, s.mdns = nil, nil
+	s.mu.Unlock()
+
+	if app == nil {
+		return nil
+	}
+	if mdns != nil {
+		mdns.Shutdown()
+	}
+	err := app.ShutdownWithTimeout(shutdownTimeout)
+	// Shutdown only closes listeners once serving on them started
+	for _, ln := range listeners {
+		ln.Close()
+	}
+	<-done
+	return err
+}
+
+// Restart stops the server if it is running and starts it with the
+// current settings
+func (s *Server) Restart() error {
+	if err := s.Stop(); err != nil {
+		fmt.Println("Error stopping server:", err)
+	}
+	return s.Start()
+}
+
+// Running reports whether the server is serving
+func (s *Server) Running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.app != nil
+}
+
+// Addrs returns the addresses the server listens on, if it is running
+func (s *Server) Addrs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.app == nil {
+		return nil
+	}
+	var addrs []string
+	for _, ln := range s.listeners {
+		addrs = append(addrs, ln.Addr().String())
+	}
+	return addrs
+}
+
+// Done returns a channel that is closed once the server stops serving
+func (s *Server) Done() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done
+}
+
+// Err returns the error that stopped the server from starting or serving
+func (s *Server) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
 }
 
-// executeScript runs the specified script using bun
+// Status describes the state of the server for the settings tab
+func (s *Server) Status() string {
+	if addrs := s.Addrs(); len(addrs) > 0 {
+		return "Listening on " + strings.Join(addrs, " and ")
+	}
+	if err := s.Err(); err != nil {
+		return err.Error()
+	}
+	return "Stopped"
+}
+
+// executeScript runs the specified script using bun. Only scripts
+// registered in scripts.json can be run, they are looked up by name or ID.
 func executeScript(c *fiber.Ctx) error {
-	path := getScriptsPath()
-	id := c.Params("id")
-	script, err := url.PathUnescape(filepath.Join(path, id))
+	name, err := url.PathUnescape(c.Params("id"))
 	if err != nil {
-		return err
+		return fiber.NewError(fiber.StatusBadRequest, "invalid script name")
 	}
 
-	proc := exec.Command("bun", "run", script)
+	scripts := getScripts()
+	script, ok := findScriptByName(scripts, name)
+	if !ok {
+		if id, err := strconv.Atoi(name); err == nil {
+			script, ok = findScriptByID(scripts, id)
+		}
+	}
+	if !ok || !canAccess(c, script) || !hasValidFile(script) {
+		return fiber.NewError(fiber.StatusNotFound, "script not found")
+	}
 
-	output, err := proc.Output()
+	if err := limitRun(c, script); err != nil {
+		return err
+	}
+	recordAudit(auditRequest(c, AuditRun).withScript(script))
+	result, err := runScript(script, RunOptions{Trigger: TriggerClient, Context: c.Context()})
+	if errors.Is(err, errBusy) {
+		return busy(c)
+	}
 	if err != nil {
 		fmt.Println("Error:", err)
 		return err
 	}
-
-	return c.SendString(strings.TrimSpace(string(output)))
+	return c.SendString(result.Stdout)
 }
 
-// fiberGetScripts returns a list of available scripts
+// fiberGetScripts returns a list of scripts the client may access
 func fiberGetScripts(c *fiber.Ctx) error {
-	scripts := getScripts()
+	scripts := accessibleScripts(c, getScripts())
 	sort.Slice(scripts, func(i, j int) bool {
 		return scripts[i].ID < scripts[j].ID
 	})
-	for i, v := range scripts {
-		scripts[i].File = strings.Replace(v.File, filepath.Ext(v.File), "", -1)
-	}
 	var out []string
 	for _, v := range scripts {
-		out = append(out, v.File)
+		out = append(out, v.Name())
 	}
 	return c.JSON(out)
 }
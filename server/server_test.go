@@ -1,22 +1,40 @@
 package main
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
-	"time"
 
 	"net/http"
 
-	"fyne.io/fyne/v2/app"
 	"github.com/gofiber/fiber/v2"
 )
 
-func init() {
-	// Initialize Fyne app for tests with a proper ID
-	app.NewWithID("dev.ibanks.opendesk-server.test")
+func TestMain(m *testing.M) {
+	// Keep state such as the audit log out of the real data directory in
+	// tests that do not set up their own
+	dataDir, err := os.MkdirTemp("", "opendeck-test")
+	if err != nil {
+		panic(err)
+	}
+	getDataPath = func() string { return dataDir }
+	if settings, err = loadFileSettings(configFile()); err != nil {
+		panic(err)
+	}
+	// Do not announce test servers on the network
+	useMDNS = func() bool { return false }
+	// Tests run tasks far more often than clients would, the limits are
+	// tested on their own
+	settings.SetString("rate_limit_client", "0")
+	settings.SetString("rate_limit_script", "0")
+
+	code := m.Run()
+	os.RemoveAll(dataDir)
+	os.Exit(code)
 }
 
 func TestFiberGetScripts(t *testing.T) {
@@ -133,12 +151,105 @@ func TestExecuteScript(t *testing.T) {
 	}
 }
 
+func TestExecuteScriptRejectsUnregistered(t *testing.T) {
+	// Setup test directory with the scripts directory nested inside
+	baseDir := t.TempDir()
+	tmpDir := filepath.Join(baseDir, "scripts")
+	if err := os.Mkdir(tmpDir, 0755); err != nil {
+		t.Fatalf("Failed to create scripts directory: %v", err)
+	}
+	originalPath := getScriptsPath
+	getScriptsPath = func() string { return tmpDir }
+	defer func() { getScriptsPath = originalPath }()
+
+	// Run scripts with sh so the test does not depend on bun
+	originalRuntime := scriptRuntime
+	scriptRuntime = []string{"sh"}
+	defer func() { scriptRuntime = originalRuntime }()
+
+	files := map[string]string{
+		filepath.Join(tmpDir, "ok.js"):     "echo registered",
+		filepath.Join(tmpDir, "other.js"):  "echo unregistered",
+		filepath.Join(baseDir, "evil.js"):  "echo escaped",
+		filepath.Join(baseDir, "evil2.js"): "echo escaped",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	// A tampered scripts.json entry pointing outside the directory
+	scripts := []Script{
+		{ID: 1, File: "ok.js"},
+		{ID: 2, File: "../evil2.js"},
+	}
+	scriptsData, _ := json.MarshalIndent(scripts, "", "\t")
+	if err := os.WriteFile(filepath.Join(tmpDir, "scripts.json"), scriptsData, 0644); err != nil {
+		t.Fatalf("Failed to create scripts.json: %v", err)
+	}
+
+	historyMu.Lock()
+	original := runHistory
+	runHistory = nil
+	historyMu.Unlock()
+	defer func() {
+		historyMu.Lock()
+		runHistory = original
+		historyMu.Unlock()
+	}()
+
+	app := fiber.New()
+	app.Get("/scripts/:id", executeScript)
+
+	testCases := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{"registered by name", "/scripts/ok", 200},
+		{"registered by file", "/scripts/ok.js", 200},
+		{"registered by ID", "/scripts/1", 200},
+		{"unregistered file", "/scripts/other.js", 404},
+		{"encoded traversal", "/scripts/..%2Fevil.js", 404},
+		{"double encoded traversal", "/scripts/..%252Fevil.js", 404},
+		{"encoded absolute path", "/scripts/%2Fetc%2Fpasswd", 404},
+		{"tampered metadata", "/scripts/2", 404},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest("GET", tc.path, nil))
+			if err != nil {
+				t.Fatalf("Failed to test request: %v", err)
+			}
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("Expected status code %d, got %d", tc.wantStatus, resp.StatusCode)
+			}
+
+			body := make([]byte, 1024)
+			n, _ := resp.Body.Read(body)
+			if strings.Contains(string(body[:n]), "escaped") || strings.Contains(string(body[:n]), "unregistered") {
+				t.Errorf("Unregistered script was run: %q", body[:n])
+			}
+		})
+	}
+
+	// The tampered entry was rejected before a run was attempted
+	if runs := getRunHistory(func(r RunResult) bool { return r.ScriptID == 2 }); len(runs) != 0 {
+		t.Errorf("Expected no runs of the tampered script, got %d", len(runs))
+	}
+}
+
 func TestStartServer(t *testing.T) {
 	// Setup test directory
 	tmpDir := t.TempDir()
 	originalPath := getScriptsPath
 	getScriptsPath = func() string { return tmpDir }
 	defer func() { getScriptsPath = originalPath }()
+	originalDataPath := getDataPath
+	getDataPath = func() string { return tmpDir }
+	defer func() { getDataPath = originalDataPath }()
 
 	// Create test scripts.json
 	scripts := []Script{}
@@ -148,31 +259,45 @@ func TestStartServer(t *testing.T) {
 		t.Fatalf("Failed to create scripts.json: %v", err)
 	}
 
-	// Start server
-	StartServer()
-
-	// Wait for server to be ready with timeout
-	select {
-	case <-serverReady:
-		// Server is ready
-	case <-time.After(5 * time.Second):
-		t.Fatal("Server failed to start within timeout")
+	// Start server, it is listening once Start returns
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
 	}
+	defer server.Stop()
 
-	if fiberApp == nil {
+	if !server.Running() {
 		t.Error("Server did not start properly")
 	}
 
-	// Test if server is actually responding
-	resp, err := http.Get("http://localhost:9212/scripts")
+	// Test if server is actually responding over HTTPS with the generated
+	// self-signed certificate
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get("https://localhost:9212/scripts")
 	if err != nil {
 		t.Errorf("Server is not responding: %v", err)
 	} else {
 		resp.Body.Close()
 	}
 
-	// Cleanup
-	if fiberApp != nil {
-		fiberApp.Shutdown()
+	// A second server cannot take the port
+	other := &Server{}
+	if err := other.Start(); err == nil {
+		other.Stop()
+		t.Error("Expected an error when the port is in use")
+	} else if other.Err() == nil || other.Status() != err.Error() {
+		t.Errorf("Expected the error to be reported in the status, got %q", other.Status())
+	}
+
+	if err := server.Restart(); err != nil {
+		t.Fatalf("Failed to restart server: %v", err)
+	}
+	if err := server.Stop(); err != nil {
+		t.Errorf("Failed to stop server: %v", err)
+	}
+	if server.Running() {
+		t.Error("Expected server to be stopped")
+	}
+	if _, err := client.Get("https://localhost:9212/scripts"); err == nil {
+		t.Error("Expected stopped server not to respond")
 	}
 }
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Settings stores the server configuration. The GUI keeps it in the Fyne
+// preferences, which implement this interface, and headless servers in a
+// config file.
+type Settings interface {
+	String(key string) string
+	StringWithFallback(key, fallback string) string
+	SetString(key, value string)
+	Bool(key string) bool
+	BoolWithFallback(key string, fallback bool) bool
+	SetBool(key string, value bool)
+}
+
+// settings is the configuration of this process, set up by main
+var settings Settings
+
+// configFile is the default config file of headless servers
+func configFile() string {
+	return filepath.Join(getDataPath(), "config.json")
+}
+
+// fileSettings keeps settings in a JSON file. Every change is saved
+// immediately, the file is only readable by the owner since it holds the
+// API key.
+type fileSettings struct {
+	mu     sync.Mutex
+	path   string
+	values map[string]any
+}
+
+// loadFileSettings reads settings from path. A missing file is created on
+// the first change.
+func loadFileSettings(path string) (*fileSettings, error) {
+	s := &fileSettings{path: path, values: map[string]any{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.values); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *fileSettings) String(key string) string {
+	return s.StringWithFallback(key, "")
+}
+
+func (s *fileSettings) StringWithFallback(key, fallback string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch v := s.values[key].(type) {
+	case string:
+		return v
+	case float64:
+		// Numbers such as the port may be written without quotes
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fallback
+}
+
+func (s *fileSettings) Bool(key string) bool {
+	return s.BoolWithFallback(key, false)
+}
+
+func (s *fileSettings) BoolWithFallback(key string, fallback bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.values[key].(bool); ok {
+		return v
+	}
+	return fallback
+}
+
+func (s *fileSettings) SetString(key, value string) {
+	s.set(key, value)
+}
+
+func (s *fileSettings) SetBool(key string, value bool) {
+	s.set(key, value)
+}
+
+func (s *fileSettings) set(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+
+	data, err := json.MarshalIndent(s.values, "", "\t")
+	if err != nil {
+		fmt.Println("Failed to save settings:", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		fmt.Println("Failed to save settings:", err)
+		return
+	}
+	if err := os.WriteFile(s.path, data, 0600); err != nil {
+		fmt.Println("Failed to save settings:", err)
+	}
+}
+
+// overriddenSettings replaces some settings with values given on the
+// command line or in the environment. Overrides are never saved.
+type overriddenSettings struct {
+	Settings
+	overrides map[string]string
+}
+
+func (s overriddenSettings) String(key string) string {
+	if v, ok := s.overrides[key]; ok {
+		return v
+	}
+	return s.Settings.String(key)
+}
+
+func (s overriddenSettings) StringWithFallback(key, fallback string) string {
+	if v, ok := s.overrides[key]; ok {
+		return v
+	}
+	return s.Settings.StringWithFallback(key, fallback)
+}
+
+func (s overriddenSettings) Bool(key string) bool {
+	return s.BoolWithFallback(key, false)
+}
+
+func (s overriddenSettings) BoolWithFallback(key string, fallback bool) bool {
+	if v, ok := s.overrides[key]; ok {
+		// Overrides are checked when they are parsed
+		b, _ := strconv.ParseBool(v)
+		return b
+	}
+	return s.Settings.BoolWithFallback(key, fallback)
+}
+
+// withOverrides applies overrides to settings
+func withOverrides(s Settings, overrides map[string]string) Settings {
+	if len(overrides) == 0 {
+		return s
+	}
+	return overriddenSettings{Settings: s, overrides: overrides}
+}
+
+// settingOptions are the settings that can be given on the command line or
+// as OPENDECK_ environment variables, such as OPENDECK_PORT
+var settingOptions = []struct {
+	key, flag, usage string
+	isBool           bool
+}{
+	{"port", "port", "port to listen on", false},
+	{"bind_address", "bind", "address to listen on, every interface if empty", false},
+	{"unix_socket", "socket", "Unix socket to also listen on", false},
+	{"https", "https", "serve HTTPS", true},
+	{"auth_mode", "auth-mode", "how clients authenticate: token or mtls", false},
+	{"tls_cert", "tls-cert", "certificate file, a self-signed one is generated if empty", false},
+	{"tls_key", "tls-key", "key file of the certificate", false},
+	{"mdns", "mdns", "advertise the server on the local network", true},
+	{"rate_limit_client", "rate-limit-client", "runs a client may request per minute, 0 for no limit (default 120)", false},
+	{"rate_limit_script", "rate-limit-script", "runs of a task that may be requested per minute, 0 for no limit (default 60)", false},
+	{"max_processes", "max-processes", "scripts and action commands running at once, 0 for no limit (default 16)", false},
+	{"mqtt_broker", "mqtt-broker", "MQTT broker to bridge to, e.g. tcp://localhost:1883", false},
+	{"mqtt_username", "mqtt-username", "MQTT username", false},
+	{"mqtt_password", "mqtt-password", "MQTT password, prefer OPENDECK_MQTT_PASSWORD", false},
+	{"mqtt_prefix", "mqtt-prefix", "prefix of MQTT topics (default opendeck)", false},
+}
+
+// optionFlag is a flag of a setting. Flags of boolean settings can be given
+// without a value.
+type optionFlag struct {
+	value  string
+	isBool bool
+}
+
+func (f *optionFlag) String() string     { return f.value }
+func (f *optionFlag) Set(s string) error { f.value = s; return nil }
+func (f *optionFlag) IsBoolFlag() bool   { return f.isBool }
+
+// Options are the command line options of the server
+type Options struct {
+	Headless bool
+	// Config is the config file of headless servers
+	Config string
+	// Pair prints a pairing PIN on start in headless mode
+	Pair bool
+	// Overrides holds settings given on the command line or in the
+	// environment, flags take precedence
+	Overrides map[string]string
+}
+
+// parseOptions reads the command line and environment
+func parseOptions(args []string, getenv func(string) string) (Options, error) {
+	opts := Options{Overrides: map[string]string{}}
+	fs := flag.NewFlagSet("opendeck-server", flag.ContinueOnError)
+	fs.BoolVar(&opts.Headless, "headless", false, "run without the GUI")
+	fs.StringVar(&opts.Config, "config", "", "config file in headless mode (default ~/.opendeck/config.json)")
+	fs.BoolVar(&opts.Pair, "pair", false, "print a PIN to pair a client with on start")
+	flags := map[string]*optionFlag{}
+	for _, o := range settingOptions {
+		flags[o.key] = &optionFlag{isBool: o.isBool}
+		fs.Var(flags[o.key], o.flag, o.usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for _, o := range settingOptions {
+		value, source := getenv("OPENDECK_"+strings.ToUpper(o.key)), "OPENDECK_"+strings.ToUpper(o.key)
+		if set[o.flag] {
+			value, source = flags[o.key].value, "-"+o.flag
+		}
+		if value == "" {
+			continue
+		}
+		if o.isBool {
+			if _, err := strconv.ParseBool(value); err != nil {
+				return opts, fmt.Errorf("%s must be true or false, got %q", source, value)
+			}
+		}
+		opts.Overrides[o.key] = value
+	}
+	if headless, err := strconv.ParseBool(getenv("OPENDECK_HEADLESS")); err == nil && headless {
+		opts.Headless = true
+	}
+	return opts, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config", "config.json")
+	s, err := loadFileSettings(path)
+	if err != nil {
+		t.Fatalf("Failed to load missing config: %v", err)
+	}
+	if got := s.StringWithFallback("port", "9212"); got != "9212" {
+		t.Errorf("Expected fallback port, got %q", got)
+	}
+
+	s.SetString("api_key", "secret")
+	s.SetBool("https", false)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Expected config file to be written: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected config file to be private, got %v", info.Mode().Perm())
+	}
+
+	loaded, err := loadFileSettings(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if loaded.String("api_key") != "secret" || loaded.BoolWithFallback("https", true) {
+		t.Errorf("Expected saved settings, got %v", loaded.values)
+	}
+
+	// Hand written configs may give the port as a number
+	if err := os.WriteFile(path, []byte(`{"port": 8080}`), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if loaded, _ := loadFileSettings(path); loaded.String("port") != "8080" {
+		t.Errorf("Expected numeric port to be read, got %q", loaded.String("port"))
+	}
+
+	if err := os.WriteFile(path, []byte(`{"port":`), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if _, err := loadFileSettings(path); err == nil {
+		t.Error("Expected invalid config to fail")
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	env := map[string]string{
+		"OPENDECK_PORT":     "9000",
+		"OPENDECK_HTTPS":    "false",
+		"OPENDECK_HEADLESS": "1",
+	}
+	getenv := func(key string) string { return env[key] }
+
+	opts, err := parseOptions([]string{"-port", "9100", "-mdns", "-bind=127.0.0.1"}, getenv)
+	if err != nil {
+		t.Fatalf("Failed to parse options: %v", err)
+	}
+	if !opts.Headless {
+		t.Error("Expected OPENDECK_HEADLESS to enable headless mode")
+	}
+	want := map[string]string{"port": "9100", "https": "false", "mdns": "true", "bind_address": "127.0.0.1"}
+	if len(opts.Overrides) != len(want) {
+		t.Errorf("Expected overrides %v, got %v", want, opts.Overrides)
+	}
+	for key, value := range want {
+		if opts.Overrides[key] != value {
+			t.Errorf("Expected %s=%q, got %q", key, value, opts.Overrides[key])
+		}
+	}
+
+	if _, err := parseOptions([]string{"-https=maybe"}, getenv); err == nil {
+		t.Error("Expected invalid boolean flag to fail")
+	}
+	env["OPENDECK_MDNS"] = "sometimes"
+	if _, err := parseOptions(nil, getenv); err == nil {
+		t.Error("Expected invalid boolean variable to fail")
+	}
+}
+
+func TestOverriddenSettings(t *testing.T) {
+	base, err := loadFileSettings(filepath.Join(t.TempDir(), "config.json"))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	base.SetString("port", "9212")
+	base.SetBool("https", true)
+
+	s := withOverrides(base, map[string]string{"port": "9000", "https": "false"})
+	if s.String("port") != "9000" || s.BoolWithFallback("https", true) {
+		t.Errorf("Expected overrides to take precedence, got port %q https %v", s.String("port"), s.Bool("https"))
+	}
+
+	// Changes are saved but do not replace the overrides
+	s.SetString("port", "9300")
+	if base.String("port") != "9300" || s.String("port") != "9000" {
+		t.Errorf("Expected change to be saved behind the override, got %q and %q", base.String("port"), s.String("port"))
+	}
+}
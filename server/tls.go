@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// certificateValidity is how long generated certificates are valid for
+const certificateValidity = 10 * 365 * 24 * time.Hour
+
+// getTLSPath returns the directory generated certificates are kept in
+func getTLSPath() string {
+	return filepath.Join(getDataPath(), "tls")
+}
+
+// useHTTPS reports whether the server should serve HTTPS
+func useHTTPS() bool {
+	return settings.BoolWithFallback("https", true)
+}
+
+// tlsFiles returns the certificate and key the server uses. A certificate
+// configured in the settings takes precedence over the generated one.
+func tlsFiles() (string, string, error) {
+	certFile, keyFile := settings.String("tls_cert"), settings.String("tls_key")
+	if certFile != "" || keyFile != "" {
+		if err := checkKeyPair(certFile, keyFile); err != nil {
+			return "", "", err
+		}
+		return expandHome(certFile), expandHome(keyFile), nil
+	}
+	return ensureCertificate()
+}
+
+// checkKeyPair verifies that a certificate and key can be loaded and match
+func checkKeyPair(certFile, keyFile string) error {
+	if certFile == "" || keyFile == "" {
+		return fmt.Errorf("both a certificate and a key are required")
+	}
+	if _, err := tls.LoadX509KeyPair(expandHome(certFile), expandHome(keyFile)); err != nil {
+		return fmt.Errorf("invalid certificate or key: %w", err)
+	}
+	return nil
+}
+
+// ensureCertificate returns the generated self-signed certificate and key,
+// creating them on first use
+func ensureCertificate() (string, string, error) {
+	dir := getTLSPath()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := checkKeyPair(certFile, keyFile); err == nil {
+		return certFile, keyFile, nil
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", "", err
+	}
+	certPEM, keyPEM, err := generateCertificate()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate certificate: %w", err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		return "", "", fmt.Errorf("failed to write key: %w", err)
+	}
+	if err := os.WriteFile(certFile, certPEM, 0644); err != nil {
+		return "", "", fmt.Errorf("failed to write certificate: %w", err)
+	}
+	return certFile, keyFile, nil
+}
+
+// generateCertificate creates a self-signed certificate valid for this
+// machine's host name and addresses
+func generateCertificate() ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hostname, _ := os.Hostname()
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "OpenDeck " + hostname, Organization: []string{"OpenDeck"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(certificateValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if hostname != "" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
+				template.IPAddresses = append(template.IPAddresses, ipNet.IP)
+			}
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// formatFingerprint returns the SHA-256 fingerprint of a DER encoded
+// certificate as colon separated hex, the same format clients show
+func formatFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// certificateFingerprint returns the fingerprint of the first certificate
+// in a PEM file
+func certificateFingerprint(certFile string) (string, error) {
+	data, err := os.ReadFile(expandHome(certFile))
+	if err != nil {
+		return "", err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return "", fmt.Errorf("%s does not contain a certificate", certFile)
+	}
+	return formatFingerprint(block.Bytes), nil
+}
+
+// currentFingerprint describes the certificate the server presents, for
+// comparing with the fingerprint clients show
+func currentFingerprint() string {
+	certFile, _, err := tlsFiles()
+	if err != nil {
+		return err.Error()
+	}
+	fingerprint, err := certificateFingerprint(certFile)
+	if err != nil {
+		return err.Error()
+	}
+	return fingerprint
+}
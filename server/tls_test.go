@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/tls"
+	"os"
+	"testing"
+)
+
+func TestEnsureCertificate(t *testing.T) {
+	// Setup test directory
+	tmpDir := t.TempDir()
+	originalDataPath := getDataPath
+	getDataPath = func() string { return tmpDir }
+	defer func() { getDataPath = originalDataPath }()
+
+	certFile, keyFile, err := ensureCertificate()
+	if err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+	if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+		t.Fatalf("Generated certificate cannot be loaded: %v", err)
+	}
+	if info, _ := os.Stat(keyFile); info.Mode().Perm() != 0600 {
+		t.Errorf("Expected key to be private, got mode %v", info.Mode().Perm())
+	}
+
+	fingerprint, err := certificateFingerprint(certFile)
+	if err != nil {
+		t.Fatalf("Failed to read fingerprint: %v", err)
+	}
+	if len(fingerprint) != 95 {
+		t.Errorf("Expected colon separated SHA-256 fingerprint, got %q", fingerprint)
+	}
+
+	// The certificate is persisted and reused
+	if _, _, err := ensureCertificate(); err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+	if again, _ := certificateFingerprint(certFile); again != fingerprint {
+		t.Error("Expected the existing certificate to be reused")
+	}
+}
+
+func TestCheckKeyPair(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalDataPath := getDataPath
+	getDataPath = func() string { return tmpDir }
+	defer func() { getDataPath = originalDataPath }()
+
+	certFile, keyFile, err := ensureCertificate()
+	if err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+
+	if err := checkKeyPair(certFile, ""); err == nil {
+		t.Error("Expected error for missing key")
+	}
+	if err := checkKeyPair(keyFile, certFile); err == nil {
+		t.Error("Expected error for swapped files")
+	}
+	if err := checkKeyPair(certFile, keyFile); err != nil {
+		t.Errorf("Expected valid key pair, got %v", err)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// umask does nothing on platforms without a file mode creation mask
+func umask(mask int) int {
+	return 0
+}
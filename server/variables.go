@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+var variablesMu sync.Mutex
+
+// TemplateData is available to templated step and action fields
+type TemplateData struct {
+	Vars map[string]string
+	// ExitCode and Output describe the previous step of a macro
+	ExitCode int
+	Output   string
+}
+
+func variablesFile() string {
+	return filepath.Join(getDataPath(), "variables.json")
+}
+
+// getVariables returns a copy of all stored variables
+func getVariables() map[string]string {
+	variablesMu.Lock()
+	defer variablesMu.Unlock()
+	return readVariables()
+}
+
+func readVariables() map[string]string {
+	vars := map[string]string{}
+	data, err := os.ReadFile(variablesFile())
+	if err != nil {
+		return vars
+	}
+	if err := json.Unmarshal(data, &vars); err != nil {
+		fmt.Println("Failed to parse variables.json:", err)
+	}
+	return vars
+}
+
+// setVariable stores a variable, removing it if value is empty
+func setVariable(name, value string) error {
+	variablesMu.Lock()
+	defer variablesMu.Unlock()
+
+	vars := readVariables()
+	if value == "" {
+		delete(vars, name)
+	} else {
+		vars[name] = value
+	}
+
+	if err := os.MkdirAll(getDataPath(), 0755); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+	data, err := json.MarshalIndent(vars, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to marshal variables: %w", err)
+	}
+	if err := os.WriteFile(variablesFile(), data, 0644); err != nil {
+		return fmt.Errorf("failed to write variables.json: %w", err)
+	}
+	return nil
+}
+
+// variablesEnv exposes variables to scripts as OPENDECK_VAR_<NAME>
+func variablesEnv(vars map[string]string) []string {
+	var env []string
+	for _, name := range sortedKeys(vars) {
+		env = append(env, "OPENDECK_VAR_"+strings.ToUpper(name)+"="+vars[name])
+	}
+	return env
+}
+
+func sortedKeys(m map[string]string) []string {
+	return slices.Sorted(maps.Keys(m))
+}
+
+// renderTemplate expands a text/template against data
+func renderTemplate(text string, data TemplateData) (string, error) {
+	tmpl, err := template.New("").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render template: %w", err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,234 @@
+"use strict";
+
+// The browser deck. It talks to the same v1 API as the desktop client and
+// keeps its pairing token in localStorage.
+
+const api = "/api/v1";
+const tokenKey = "opendeck-token";
+const reconnectDelay = 5000;
+
+const grid = document.getElementById("grid");
+const pairing = document.getElementById("pairing");
+const connection = document.getElementById("connection");
+const statusBar = document.getElementById("status");
+const profileSelect = document.getElementById("profile");
+
+// buttons maps task IDs to their buttons, tags to their tags
+let buttons = new Map();
+let tags = new Map();
+// profile is the tag of the tasks shown, every task is shown if empty
+let profile = "";
+let events = null;
+
+class UnauthorizedError extends Error {}
+
+function token() {
+	return localStorage.getItem(tokenKey) || "";
+}
+
+async function request(method, path, body) {
+	const headers = { "Content-Type": "application/json" };
+	if (token()) {
+		headers.Authorization = "Bearer " + token();
+	}
+	const response = await fetch(api + path, {
+		method,
+		headers,
+		body: body === undefined ? undefined : JSON.stringify(body),
+	});
+	if (response.status === 401) {
+		throw new UnauthorizedError(await response.text());
+	}
+	if (!response.ok) {
+		throw new Error(response.status + " " + (await response.text()));
+	}
+	return response.status === 204 ? null : response.json();
+}
+
+function showPairing() {
+	closeEvents();
+	grid.replaceChildren();
+	buttons = new Map();
+	tags = new Map();
+	profileSelect.hidden = true;
+	pairing.hidden = false;
+	connection.textContent = "Not paired with " + location.host;
+}
+
+function addTask(task) {
+	const button = document.createElement("button");
+	button.textContent = task.title;
+	button.addEventListener("click", () => run(task.id, button));
+	buttons.set(task.id, button);
+	grid.append(button);
+	setTags(task);
+}
+
+// setTags records the tags of a task, they name the profiles it is part of
+function setTags(task) {
+	tags.set(task.id, task.metadata.tags || []);
+	showProfile();
+}
+
+// showProfile shows the tasks of the active profile and lists the
+// profiles that can be switched to
+function showProfile() {
+	buttons.forEach((button, id) => {
+		button.hidden = profile !== "" && !tags.get(id).includes(profile);
+	});
+
+	const names = [...new Set([...tags.values()].flat())].sort();
+	if (profile !== "" && !names.includes(profile)) {
+		names.push(profile);
+	}
+	const options = [new Option("All tasks", "")];
+	names.forEach((name) => options.push(new Option(name, name)));
+	profileSelect.replaceChildren(...options);
+	profileSelect.value = profile;
+	profileSelect.hidden = names.length === 0;
+}
+
+async function run(id, button) {
+	const title = button.textContent;
+	try {
+		const result = await request("POST", "/scripts/" + id + "/run");
+		if (result.exitCode !== 0) {
+			statusBar.textContent = title + " failed: " + [result.error, result.stderr].filter(Boolean).join(" ");
+		} else {
+			statusBar.textContent = title + ": " + result.stdout;
+		}
+	} catch (err) {
+		handleError(err);
+	}
+}
+
+function handleError(err) {
+	if (err instanceof UnauthorizedError) {
+		showPairing();
+		return;
+	}
+	statusBar.textContent = err.message;
+}
+
+async function load() {
+	try {
+		const tasks = await request("GET", "/scripts");
+		profile = (await request("GET", "/profile")).active;
+		pairing.hidden = true;
+		grid.replaceChildren();
+		buttons = new Map();
+		tags = new Map();
+		tasks.forEach(addTask);
+		showProfile();
+		connection.textContent = "Connected to " + location.host;
+		listen();
+	} catch (err) {
+		if (err instanceof UnauthorizedError) {
+			showPairing();
+			return;
+		}
+		connection.textContent = "Failed to load tasks, retrying";
+		statusBar.textContent = err.message;
+		setTimeout(load, reconnectDelay);
+	}
+}
+
+// handleEvent applies a change pushed by the server to the grid
+function handleEvent(event) {
+	const button = buttons.get(event.scriptId);
+	switch (event.type) {
+	case "script.added":
+		if (!button && event.script) {
+			addTask(event.script);
+		}
+		break;
+	case "script.updated":
+		if (button && event.script) {
+			button.textContent = event.script.title;
+			setTags(event.script);
+		}
+		break;
+	case "script.removed":
+		if (button) {
+			button.remove();
+			buttons.delete(event.scriptId);
+			tags.delete(event.scriptId);
+			showProfile();
+		}
+		break;
+	case "button.state":
+		if (button) {
+			button.classList.toggle("running", event.state === "running");
+		}
+		break;
+	case "run.finished":
+		// runs started here already show their result
+		if (event.run && event.run.trigger !== "client") {
+			statusBar.textContent = event.run.script + " ran (" + event.run.trigger + ")";
+		}
+		break;
+	case "profile.switched":
+		profile = event.profile || "";
+		showProfile();
+		break;
+	}
+}
+
+function closeEvents() {
+	if (events) {
+		events.onclose = null;
+		events.close();
+		events = null;
+	}
+}
+
+// listen opens the event stream. Browsers cannot send headers with
+// WebSockets, so the token is passed as a query parameter. Events sent
+// while disconnected are lost, so the tasks are reloaded on reconnect.
+function listen() {
+	closeEvents();
+	const scheme = location.protocol === "https:" ? "wss://" : "ws://";
+	const url = scheme + location.host + api + "/events?access_token=" + encodeURIComponent(token());
+	events = new WebSocket(url);
+	events.onmessage = (message) => handleEvent(JSON.parse(message.data));
+	events.onclose = () => {
+		events = null;
+		connection.textContent = "Disconnected from " + location.host;
+		setTimeout(load, reconnectDelay);
+	};
+}
+
+pairing.addEventListener("submit", async (e) => {
+	e.preventDefault();
+	const error = document.getElementById("pairing-error");
+	error.textContent = "";
+	try {
+		const paired = await request("POST", "/pair", {
+			pin: document.getElementById("pin").value.trim(),
+			name: document.getElementById("name").value.trim(),
+		});
+		if (!paired.token) {
+			throw new Error("the server requires client certificates, pair with the desktop client instead");
+		}
+		localStorage.setItem(tokenKey, paired.token);
+		load();
+	} catch (err) {
+		error.textContent = "Pairing failed: " + err.message;
+	}
+});
+
+profileSelect.addEventListener("change", async () => {
+	const selected = profileSelect.value;
+	// the select shows the active profile until the switch is pushed back
+	profileSelect.value = profile;
+	try {
+		await request("PUT", "/profile", { active: selected });
+	} catch (err) {
+		handleError(err);
+	}
+});
+
+document.getElementById("refresh").addEventListener("click", load);
+document.getElementById("name").value = navigator.platform ? "Browser on " + navigator.platform : "Browser";
+
+load();
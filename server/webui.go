@@ -0,0 +1,32 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/filesystem"
+)
+
+// webUIPath is where the browser deck is served
+const webUIPath = "/ui"
+
+//go:embed web
+var webFiles embed.FS
+
+// registerWebUI serves the browser deck. It uses the v1 API like the
+// desktop client, so the files themselves need no authentication.
+func registerWebUI(app *fiber.App) {
+	files, err := fs.Sub(webFiles, "web")
+	if err != nil {
+		panic(err)
+	}
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.Redirect(webUIPath+"/", fiber.StatusFound)
+	})
+	app.Use(webUIPath, filesystem.New(filesystem.Config{
+		Root:  http.FS(files),
+		Index: "index.html",
+	}))
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestWebUI(t *testing.T) {
+	originalKey := getAPIKey
+	getAPIKey = func() string { return "test-key" }
+	defer func() { getAPIKey = originalKey }()
+
+	app := newFiberApp()
+
+	testCases := []struct {
+		path        string
+		wantStatus  int
+		wantContent string
+	}{
+		{"/ui/", fiber.StatusOK, `<script src="app.js">`},
+		{"/ui/app.js", fiber.StatusOK, "/api/v1"},
+		{"/ui/style.css", fiber.StatusOK, "#grid"},
+		{"/ui/missing.js", fiber.StatusNotFound, ""},
+	}
+	for _, tc := range testCases {
+		resp, err := app.Test(httptest.NewRequest("GET", tc.path, nil))
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != tc.wantStatus || !strings.Contains(string(body), tc.wantContent) {
+			t.Errorf("GET %s: expected status %d with %q, got %d", tc.path, tc.wantStatus, tc.wantContent, resp.StatusCode)
+		}
+	}
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusFound || resp.Header.Get("Location") != "/ui/" {
+		t.Errorf("Expected redirect to the web UI, got %d to %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	// Tokens in the query are only accepted for WebSockets
+	resp, err = app.Test(httptest.NewRequest("GET", "/api/v1/scripts?access_token=test-key", nil))
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("Expected status 401 for token in query, got %d", resp.StatusCode)
+	}
+}